@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/example/app/internal/compose"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/drain"
+	"github.com/example/app/internal/manifests"
+	"github.com/example/app/internal/mock"
+	"github.com/example/app/internal/replay"
+	"github.com/example/app/internal/rules"
+	"github.com/example/app/internal/telemetry"
+	"github.com/gorilla/mux"
+)
+
+// runCommand executes a subcommand such as `/app drain`. Scratch and
+// distroless images have no shell or curl, so operational helpers live in
+// the binary itself.
+func runCommand(cfg *config.Config, name string, args []string) int {
+	switch name {
+	case "drain":
+		return drainCommand(cfg)
+	case "healthcheck":
+		return healthcheckCommand(cfg, args)
+	case "manifests":
+		return manifestsCommand(cfg, args)
+	case "compose":
+		return composeCommand(cfg, args)
+	case "mock":
+		return mockCommand(cfg, args)
+	case "rules":
+		return rulesCommand(cfg, args)
+	case "replay":
+		return replayCommand(args)
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	fmt.Fprintln(os.Stderr, "usage: app [drain|healthcheck|manifests|compose|mock|rules|replay]")
+	return 2
+}
+
+// drainCommand asks the local instance to drain; use it as a preStop hook.
+func drainCommand(cfg *config.Config) int {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Drain.Delay+cfg.Drain.Timeout+5*time.Second)
+	defer cancel()
+
+	res, err := drain.Request(ctx, "http://127.0.0.1:"+cfg.Admin.Port, cfg.Admin.Token)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	json.NewEncoder(os.Stdout).Encode(res)
+	return 0
+}
+
+// healthcheckCommand probes the local instance and exits non-zero unless it
+// answers 200; use it as a Docker HEALTHCHECK. The path defaults to /health.
+func healthcheckCommand(cfg *config.Config, args []string) int {
+	path := "/health"
+	if len(args) > 0 {
+		path = args[0]
+	}
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get("http://127.0.0.1:" + cfg.Port + path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, resp.Status)
+		return 1
+	}
+	return 0
+}
+
+// manifestsCommand prints Kubernetes manifests for this build and the
+// current configuration.
+func manifestsCommand(cfg *config.Config, args []string) int {
+	var opts manifests.Options
+	fs := flag.NewFlagSet("manifests", flag.ContinueOnError)
+	fs.StringVar(&opts.Name, "name", "", "resource name (default SERVICE_NAME)")
+	fs.StringVar(&opts.Namespace, "namespace", "", "namespace to set on every resource")
+	fs.StringVar(&opts.Image, "image", "", "container image (default SERVICE_NAME:version)")
+	fs.IntVar(&opts.Replicas, "replicas", 2, "Deployment replicas")
+	fs.StringVar(&opts.CPURequest, "cpu-request", "50m", "CPU request")
+	fs.StringVar(&opts.MemoryRequest, "memory-request", "32Mi", "memory request")
+	fs.StringVar(&opts.CPULimit, "cpu-limit", "", "CPU limit (none by default)")
+	fs.StringVar(&opts.MemoryLimit, "memory-limit", "128Mi", "memory limit, also exported as GOMEMLIMIT")
+	fs.IntVar(&opts.RunAsUser, "run-as-user", 65534, "UID of the image user (65532 for the distroless image)")
+	fs.BoolVar(&opts.HPA, "hpa", false, "emit a HorizontalPodAutoscaler")
+	fs.IntVar(&opts.HPAMin, "hpa-min", 0, "HPA minimum replicas (default --replicas)")
+	fs.IntVar(&opts.HPAMax, "hpa-max", 10, "HPA maximum replicas")
+	fs.IntVar(&opts.HPATarget, "hpa-cpu", 70, "HPA target average CPU utilization in percent")
+	fs.BoolVar(&opts.PDB, "pdb", false, "emit a PodDisruptionBudget")
+	fs.StringVar(&opts.PDBMaxUnavailable, "pdb-max-unavailable", "1", "PDB maxUnavailable (number or percentage)")
+	fs.Var((*listFlag)(&opts.Overlays), "overlay", "YAML file merged into the output (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := manifests.Write(os.Stdout, cfg, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// composeCommand prints a Docker Compose file for this build, the current
+// configuration and the backing services it depends on.
+func composeCommand(cfg *config.Config, args []string) int {
+	var opts compose.Options
+	fs := flag.NewFlagSet("compose", flag.ContinueOnError)
+	fs.StringVar(&opts.Name, "name", "", "service name (default SERVICE_NAME)")
+	fs.StringVar(&opts.Image, "image", "", "container image (default SERVICE_NAME:version)")
+	fs.StringVar(&opts.HostPort, "host-port", "", "host port published for the public listener (default PORT)")
+	fs.IntVar(&opts.RunAsUser, "run-as-user", 65534, "UID of the image user (65532 for the distroless image)")
+	fs.Var((*listFlag)(&opts.With), "with", "add a dependency: postgres, redis, otel-collector (repeatable)")
+	fs.Var((*listFlag)(&opts.Overlays), "overlay", "YAML file merged into the output (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if err := compose.Write(os.Stdout, cfg, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// mockCommand serves the operations of an OpenAPI document with example
+// responses, standing in for handlers that don't exist yet.
+func mockCommand(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("mock", flag.ContinueOnError)
+	port := fs.String("port", cfg.Port, "port to listen on")
+	validate := fs.Bool("validate", true, "answer 400 to requests that don't match the document")
+	cors := fs.Bool("cors", true, "allow cross-origin requests from browser applications")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: app mock [flags] openapi.yaml")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	spec, err := mock.Load(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	r := mux.NewRouter()
+	r.Use(telemetry.AccessLog(slog.Default()))
+	mock.New(spec, mock.Options{Validate: *validate}).Register(r)
+	// After the document's routes, so a documented /health wins.
+	r.HandleFunc("/health", healthHandler).Methods("GET")
+	var h http.Handler = r
+	if *cors {
+		h = mock.CORS(h)
+	}
+
+	srv := &http.Server{Addr: ":" + *port, Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("mock server starting", "api", spec.Title, "version", spec.Version, "operations", len(spec.Operations), "addr", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// listFlag collects a repeatable flag.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// rulesCommand compiles a rules file, RULES_FILE by default, and lists its
+// rules; it exits non-zero when any fails to compile.
+func rulesCommand(cfg *config.Config, args []string) int {
+	path := cfg.Rules.File
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "usage: app rules <file> (or set RULES_FILE)")
+		return 2
+	}
+	list, err := rules.Check(path, cfg.RateLimit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, r := range list {
+		fmt.Printf("%-24s %-10s %s\n", r.Name, r.Action, r.When)
+	}
+	return 0
+}
+
+// replayCommand re-sends the requests of captured HAR files to a target
+// and reports the responses that differ from the recorded ones; it exits
+// non-zero when any differs or fails.
+func replayCommand(args []string) int {
+	var (
+		opts    replay.Options
+		hosts   listFlag
+		headers listFlag
+		ignore  listFlag
+		values  listFlag
+	)
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	target := fs.String("target", "http://127.0.0.1:8080", "base URL requests are sent to")
+	fs.Var(&hosts, "host", "Host header to send, or recorded=sent to rewrite one host (repeatable)")
+	fs.Var(&headers, "H", "header replacing the recorded one, as Name: value, e.g. for credentials (repeatable)")
+	fs.Var(&values, "set", "value for a redacted query parameter or body field, as name=value (repeatable)")
+	fs.Var(&ignore, "ignore", "JSON field or header left out of the comparison; body skips bodies (repeatable)")
+	fs.Float64Var(&opts.Speed, "speed", 1, "1 keeps the recorded timing, 10 is ten times faster, 0 sends without waiting")
+	fs.IntVar(&opts.Concurrency, "concurrency", 8, "requests in flight at most")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of each request")
+	verbose := fs.Bool("v", false, "also list requests that match")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: app replay [flags] captures.har...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	u, err := url.Parse(*target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		fmt.Fprintf(os.Stderr, "-target %q: want a URL such as http://host:port\n", *target)
+		return 2
+	}
+	opts.Target = u
+	opts.Hosts = map[string]string{}
+	for _, h := range hosts {
+		if from, to, ok := strings.Cut(h, "="); ok {
+			opts.Hosts[from] = to
+		} else {
+			opts.Hosts["*"] = h
+		}
+	}
+	opts.Headers = http.Header{}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			fmt.Fprintf(os.Stderr, "-H %q: want Name: value\n", h)
+			return 2
+		}
+		opts.Headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	opts.Values = map[string]string{}
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			fmt.Fprintf(os.Stderr, "-set %q: want name=value\n", v)
+			return 2
+		}
+		opts.Values[strings.ToLower(name)] = value
+	}
+	opts.Ignore = ignore
+	opts.Client = &http.Client{Timeout: *timeout}
+
+	entries, err := replay.Load(fs.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sum := replay.Run(ctx, entries, opts, func(r replay.Result) {
+		e := r.Entry
+		line := fmt.Sprintf("#%d %s %s", e.ID, e.Request.Method, e.Request.URL)
+		switch {
+		case r.Skipped != "":
+			fmt.Printf("%s SKIP %s\n", line, r.Skipped)
+		case r.Err != nil:
+			fmt.Printf("%s FAIL %s\n", line, r.Err)
+		case len(r.Diffs) > 0:
+			fmt.Printf("%s DIFF %d in %s (recorded %d in %.0fms)\n", line, r.Status, r.Elapsed.Round(time.Millisecond), e.Response.Status, e.Time)
+			for _, d := range r.Diffs {
+				fmt.Printf("    %s\n", d)
+			}
+		case *verbose:
+			fmt.Printf("%s ok %d in %s (recorded %.0fms)\n", line, r.Status, r.Elapsed.Round(time.Millisecond), e.Time)
+		}
+	})
+	fmt.Printf("%d sent: %d matched, %d differed, %d failed; %d skipped, %d of them for redacted values\n",
+		sum.Sent, sum.Matched, sum.Differed, sum.Failed, sum.Skipped, sum.Redacted)
+	if sum.Differed > 0 || sum.Failed > 0 || ctx.Err() != nil {
+		return 1
+	}
+	return 0
+}
@@ -1,19 +1,56 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/audit"
+	"github.com/example/app/internal/auth"
+	"github.com/example/app/internal/canary"
+	"github.com/example/app/internal/capture"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/discovery"
+	"github.com/example/app/internal/drain"
+	"github.com/example/app/internal/errreport"
+	"github.com/example/app/internal/health"
+	"github.com/example/app/internal/inspect"
+	"github.com/example/app/internal/instance"
+	"github.com/example/app/internal/lifecycle"
+	"github.com/example/app/internal/maintenance"
+	"github.com/example/app/internal/netdiag"
+	"github.com/example/app/internal/plugins"
+	"github.com/example/app/internal/proxy"
+	"github.com/example/app/internal/ratelimit"
+	"github.com/example/app/internal/remotecfg"
+	"github.com/example/app/internal/rules"
+	"github.com/example/app/internal/secrets"
+	"github.com/example/app/internal/shadow"
+	"github.com/example/app/internal/sites"
+	"github.com/example/app/internal/telemetry"
+	"github.com/example/app/internal/usage"
+	"github.com/example/app/internal/waitfor"
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
 type Response struct {
 	Message     string `json:"message"`
 	GoVersion   string `json:"go_version"`
 	Environment string `json:"environment"`
+	Version     string `json:"version,omitempty"`
+
+	*instance.Identity
 }
 
 type HealthResponse struct {
@@ -21,35 +58,478 @@ type HealthResponse struct {
 }
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1], os.Args[2:]))
+	}
+
+	// Fleet-wide settings from the KV store, under the environment
+	var remote *remotecfg.Source
+	if cfg.Remote.Enabled() {
+		if remote, err = remotecfg.New(cfg.Remote, cfg.DataDir); err != nil {
+			log.Fatal(err)
+		}
+		loadCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		values, err := remote.Load(loadCtx)
+		cancel()
+		if err != nil {
+			log.Printf("%v; starting with the environment only", err)
+		} else if cfg, err = config.LoadWith(values); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	self := instance.New(cfg.Instance)
+	tel, err := telemetry.Setup(cfg, self)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	errs, err := errreport.New(cfg, tel.Registry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tel.WrapLogger(errs.LogHandler)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	auditLog := audit.New(200)
+
+	life := lifecycle.New(cfg.Lifecycle)
+	life.Add("telemetry", lifecycle.Hooks{OnStop: tel.Shutdown}, lifecycle.Options{})
+	life.Add("errors", lifecycle.Hooks{OnStop: errs.Flush}, lifecycle.Options{DependsOn: []string{"telemetry"}})
+
+	ready := health.NewReadiness()
+	ready.Add("lifecycle", life.ReadinessCheck)
+	maint := maintenance.New(cfg, tel.Registry)
+	ready.Add("maintenance", maint.ReadinessCheck)
+	life.Add("maintenance", lifecycle.Background(maint.Run), lifecycle.Options{})
+
+	deps, err := waitfor.New(cfg.Wait)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ready.Add("dependencies", deps.ReadinessCheck)
+
+	secretStore, err := secrets.New(cfg.Secrets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Leased once Vault is logged in, below; the database pool connects
+	// with whichever credentials are current.
+	var dbCreds *secrets.Credentials
+	if vault, ok := secretStore.(*secrets.Vault); ok && cfg.Secrets.Vault.DBCreds != "" {
+		dbCreds = secrets.NewCredentials(vault, cfg.Secrets.Vault.DBCreds, tel.Registry)
+	}
+
+	drainer := drain.New(cfg.Drain, tel.Registry)
+	ready.Add("drain", drainer.ReadinessCheck)
+
 	r := mux.NewRouter()
+	r.Use(tel.HTTP.Middleware, telemetry.AccessLog(tel.Logger), errs.Middleware)
+	// Recorded for /debug/requests, which needs the admin listener
+	var inspector *inspect.Inspector
+	if cfg.Admin.Enabled() && cfg.Inspect.Enabled() {
+		inspector = inspect.New(cfg.Inspect)
+		r.Use(inspector.Middleware)
+	}
+
+	// Opened lazily; WAIT_FOR can wait for it to accept connections.
+	var db *sql.DB
+	if cfg.Database.Enabled() {
+		var connector driver.Connector
+		var dbAfter []string
+		if dbCreds != nil {
+			connector = &secrets.Connector{Base: &pq.Driver{}, Creds: dbCreds, DSN: databaseDSN(cfg.Database.URL)}
+			dbAfter = []string{"db-credentials"}
+		} else if connector, err = pq.NewConnector(cfg.Database.URL); err != nil {
+			log.Fatal(err)
+		}
+		if inspector != nil {
+			connector = inspect.Connector(connector)
+		}
+		db = sql.OpenDB(connector)
+		db.SetMaxOpenConns(cfg.Database.MaxConns)
+		if dbCreds != nil {
+			// Connections retire well before the lease they were opened
+			// with expires, so rotation never breaks one in use.
+			dbCreds.OnRotate(func(s *secrets.Secret) {
+				if s.LeaseDuration > 0 {
+					db.SetConnMaxLifetime(s.LeaseDuration / 4)
+				}
+			})
+		}
+		hooks := lifecycle.Hooks{OnStop: func(context.Context) error { return db.Close() }}
+		if dbCreds == nil {
+			deps.Add(waitfor.SQL("database", db))
+		} else {
+			// Leased credentials only exist after the WAIT_FOR checks, so
+			// the pool is waited for once they are.
+			wait := cfg.Wait
+			wait.Targets = nil
+			ping, err := waitfor.New(wait)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ping.Add(waitfor.SQL("database", db))
+			hooks.OnStart = ping.Wait
+		}
+		life.Add("database", hooks, lifecycle.Options{DependsOn: dbAfter, StartTimeout: cfg.Wait.Timeout + time.Second})
+	}
 
-	r.HandleFunc("/", homeHandler).Methods("GET")
 	r.HandleFunc("/health", healthHandler).Methods("GET")
+	r.Handle("/ready", ready.Handler()).Methods("GET")
+	r.Handle("/metrics", tel.Registry.Handler()).Methods("GET")
+
+	canaries, err := canary.New(cfg.Canary, tel.Registry)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	upstreams, err := discovery.NewUpstreams(cfg, tel.Registry)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Add("upstreams", lifecycle.Background(upstreams.Run), lifecycle.Options{DependsOn: []string{"telemetry"}})
+	var outbound http.RoundTripper = upstreams
+	if inspector != nil {
+		outbound = inspect.Transport(upstreams)
+	}
+
+	// Canary routes are registered before the rules, which may route to them.
+	home := canaries.Handle("home",
+		canary.Variant{Name: "v1", Handler: homeHandler(self)},
+		canary.Variant{Name: "v2", Handler: homeHandlerV2(cfg, self)},
+	)
+
+	vhosts, err := sites.New(cfg.Sites)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Drain and maintenance turn requests away first, on every site, so
+	// no site keeps serving during maintenance or escapes the drain count.
+	always := []sites.Middleware{
+		{Name: "drain", Func: drainer.Middleware},
+		{Name: "maintenance", Func: maint.Middleware},
+	}
+	// Public middleware, in order. Each site runs the parts SITE_MIDDLEWARE
+	// selects.
+	var stack []sites.Middleware
+	// Rules run before rate limiting, which honours the class they assign.
+	var ruleEngine *rules.Engine
+	if cfg.Rules.Enabled() {
+		if ruleEngine, err = rules.New(cfg, canaries, tel.Registry); err != nil {
+			log.Fatal(err)
+		}
+		stack = append(stack, sites.Middleware{Name: "rules", Func: ruleEngine.Middleware})
+	}
+	var authn *auth.Authenticator
+	if cfg.Auth.Enabled() {
+		authn = auth.New(cfg.Auth, tel.Registry)
+	}
+	// Captures come after rules, which may tag requests for capture, and
+	// record what rate limiting, auth and plugins answered.
+	var capturer *capture.Capturer
+	if cfg.Capture.Enabled() {
+		if capturer, err = capture.New(cfg, authn, tel.Registry); err != nil {
+			log.Fatal(err)
+		}
+		stack = append(stack, sites.Middleware{Name: "capture", Func: capturer.Middleware})
+		life.Add("capture", lifecycle.Background(capturer.Run), lifecycle.Options{})
+	}
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled() {
+		if limiter, err = ratelimit.New(cfg.RateLimit, tel.Registry); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Limits by IP come before auth, so they also cover guessing tokens.
+	// Limits by token or header come after it: a client can send any
+	// value, so only those auth has let through get buckets of their own.
+	if limiter != nil && cfg.RateLimit.Key == "ip" {
+		stack = append(stack, sites.Middleware{Name: "ratelimit", Func: limiter.Middleware})
+	}
+	if authn != nil {
+		stack = append(stack, sites.Middleware{Name: "auth", Func: authn.Middleware})
+	}
+	if limiter != nil && cfg.RateLimit.Key != "ip" {
+		stack = append(stack, sites.Middleware{Name: "ratelimit", Func: limiter.Middleware})
+	}
+	// Metered after auth, so only authenticated requests are billed; the
+	// config requires auth when quotas are set.
+	var meter *usage.Meter
+	if cfg.Usage.Enabled() {
+		if meter, err = usage.New(cfg.Usage, db, tel.Registry); err != nil {
+			log.Fatal(err)
+		}
+		stack = append(stack, sites.Middleware{Name: "usage", Func: meter.Middleware})
+		ready.Add("usage", meter.ReadinessCheck)
+	}
+	var pluginHost *plugins.Host
+	if cfg.Plugins.Enabled() {
+		if pluginHost, err = plugins.New(ctx, cfg.Plugins, tel.Registry); err != nil {
+			log.Fatal(err)
+		}
+		stack = append(stack, sites.Middleware{Name: "plugins", Func: pluginHost.Middleware})
+		life.Add("plugins", lifecycle.Hooks{OnStop: pluginHost.Close}, lifecycle.Options{})
+	}
+	if cfg.Shadow.Enabled() {
+		stack = append(stack, sites.Middleware{Name: "shadow", Func: shadow.New(cfg.Shadow, outbound, tel.Registry).Middleware})
+	}
+
+	if inspector != nil {
+		for n, m := range always {
+			always[n].Func = inspect.Wrap(m.Name, m.Func)
+		}
+		for n, m := range stack {
+			stack[n].Func = inspect.Wrap(m.Name, m.Func)
+		}
+	}
+
+	// Public routes, in groups each site serves as SITE_ROUTES selects
+	groups := []sites.Group{
+		{Name: "home", Register: func(api *mux.Router) { api.Handle("/", home).Methods("GET") }},
+	}
+
+	var gateway *proxy.Proxy
+	if cfg.Proxy.Enabled() {
+		gateway, err = proxy.New(cfg.Proxy, outbound, tel.Registry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		groups = append(groups, sites.Group{Name: "proxy", Register: gateway.Register})
+	}
+	if err := vhosts.Mount(r, always, stack, groups); err != nil {
+		log.Fatal(err)
+	}
+
+	var registrar *discovery.Registrar
+	if cfg.Discovery.Enabled() {
+		registrar, err = discovery.NewRegistrar(cfg, tel.Registry)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if remote != nil {
+		rl := &reloader{cfg: cfg, tel: tel, canaries: canaries, audit: auditLog}
+		life.Add("remote-config", lifecycle.Background(func(ctx context.Context) { remote.Watch(ctx, rl.apply) }),
+			lifecycle.Options{DependsOn: []string{"telemetry"}})
+	}
+
+	// Secrets come after the dependency waits, so a Vault that is still
+	// starting can be listed in WAIT_FOR.
+	var leases []*secrets.Credentials
+	after := []string{"dependencies"}
+	if vault, ok := secretStore.(*secrets.Vault); ok {
+		renew := lifecycle.Background(vault.Run)
+		life.Add("vault", lifecycle.Hooks{
+			OnStart: func(ctx context.Context) error {
+				if err := vault.Login(ctx); err != nil {
+					return err
+				}
+				return renew.Start(ctx)
+			},
+			OnStop: renew.Stop,
+		}, lifecycle.Options{DependsOn: after})
+		after = []string{"vault"}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+		if dbCreds != nil {
+			vault.OnLogin(dbCreds.RotateSoon)
+			rotate := lifecycle.Background(dbCreds.Run)
+			life.Add("db-credentials", lifecycle.Hooks{
+				OnStart: func(ctx context.Context) error {
+					if err := dbCreds.Start(ctx); err != nil {
+						return err
+					}
+					return rotate.Start(ctx)
+				},
+				OnStop: rotate.Stop,
+			}, lifecycle.Options{DependsOn: after})
+			after = []string{"db-credentials"}
+			leases = append(leases, dbCreds)
+		}
 	}
 
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	if meter != nil {
+		// Loaded with the listener up, like the WAIT_FOR targets, so probes
+		// see the instance alive but not ready while the database starts;
+		// until then metered routes answer 503. Loading is retried like a
+		// WAIT_FOR target. Usage is flushed once more on shutdown.
+		wait := cfg.Wait
+		wait.Targets = nil
+		load, err := waitfor.New(wait)
+		if err != nil {
+			log.Fatal(err)
+		}
+		load.Add(waitfor.Check{Name: "usage", Probe: meter.Start})
+		flush := lifecycle.Background(meter.Run)
+		usageAfter := []string{"http"}
+		if db != nil {
+			usageAfter = append(usageAfter, "database")
+		}
+		life.Add("usage", lifecycle.Hooks{
+			OnStart: func(ctx context.Context) error {
+				if err := load.Wait(ctx); err != nil {
+					return err
+				}
+				return flush.Start(ctx)
+			},
+			OnStop: func(ctx context.Context) error {
+				flush.Stop(ctx)
+				return meter.Flush(ctx)
+			},
+		}, lifecycle.Options{DependsOn: usageAfter, StartTimeout: cfg.Wait.Timeout + time.Second})
+	}
+
+	var adm *admin.Server
+	if cfg.Admin.Enabled() {
+		adm = admin.New(cfg.Admin)
+		life.RegisterAdmin(adm.Router())
+		auditLog.RegisterAdmin(adm.Router())
+		maint.RegisterAdmin(adm.Router())
+		drainer.RegisterAdmin(adm.Router())
+		canaries.RegisterAdmin(adm.Router())
+		if registrar != nil {
+			registrar.RegisterAdmin(adm.Router())
+			discovery.NewConsulResolver(cfg.Discovery).RegisterAdmin(adm.Router())
+		}
+		upstreams.RegisterAdmin(adm.Router())
+		if gateway != nil {
+			gateway.RegisterAdmin(adm.Router())
+		}
+		if pluginHost != nil {
+			pluginHost.RegisterAdmin(adm.Router())
+		}
+		if ruleEngine != nil {
+			ruleEngine.RegisterAdmin(adm.Router())
+		}
+		if capturer != nil {
+			capturer.RegisterAdmin(adm.Router())
+		}
+		if inspector != nil {
+			inspector.RegisterAdmin(adm.Router())
+		}
+		if meter != nil {
+			meter.RegisterAdmin(adm.Router())
+		}
+		secrets.RegisterAdmin(adm.Router(), secretStore, leases...)
+		if cfg.Diagnostics.Enabled() {
+			netdiag.New(cfg.Diagnostics).RegisterAdmin(adm.Router())
+		}
+		life.Add("admin", lifecycle.Server(adm.HTTPServer(), func(err error) { log.Fatal(err) }),
+			lifecycle.Options{DependsOn: []string{"telemetry"}})
+	} else {
+		log.Printf("Admin API disabled: ADMIN_TOKEN is not set")
+	}
+
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           self.Middleware(r),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveAfter := []string{"errors", "maintenance", "upstreams"}
+	if pluginHost != nil {
+		serveAfter = append(serveAfter, "plugins")
+	}
+	life.Add("http", lifecycle.Server(srv, func(err error) { log.Fatal(err) }),
+		lifecycle.Options{DependsOn: serveAfter})
+	if tlsConfig := vhosts.TLSConfig(); tlsConfig != nil {
+		https := &http.Server{
+			Addr:              ":" + cfg.Sites.TLSPort,
+			Handler:           srv.Handler,
+			TLSConfig:         tlsConfig,
+			ReadHeaderTimeout: srv.ReadHeaderTimeout,
+		}
+		life.Add("https", lifecycle.Server(https, func(err error) { log.Fatal(err) }),
+			lifecycle.Options{DependsOn: serveAfter})
+	}
+	// Waited for with the listener up, so probes see the instance alive
+	// but not ready instead of a crash loop.
+	life.Add("dependencies", lifecycle.Hooks{OnStart: deps.Wait},
+		lifecycle.Options{DependsOn: []string{"http"}, StartTimeout: cfg.Wait.Timeout + time.Second})
+
+	if registrar != nil {
+		// Registered only once the listener is up; deregistered before
+		// it stops, since stopping runs in reverse.
+		run := lifecycle.Background(registrar.Run)
+		life.Add("registration", lifecycle.Hooks{
+			OnStart: run.Start,
+			OnStop: func(ctx context.Context) error {
+				run.Stop(ctx)
+				return registrar.Deregister(ctx)
+			},
+		}, lifecycle.Options{DependsOn: append([]string{"http"}, after...)})
+	}
+
+	if err := life.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Server started on port %s", cfg.Port)
+
+	// Wait for interrupt
+	<-ctx.Done()
+	stop()
+
+	// Graceful shutdown in reverse start order, flushing telemetry last
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := life.Stop(shutdownCtx); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
 }
 
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+func homeHandler(self *instance.Identity) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		env := os.Getenv("ENVIRONMENT")
+		if env == "" {
+			env = "development"
+		}
+
+		response := Response{
+			Message:     "Go Docker Template",
+			GoVersion:   runtime.Version(),
+			Environment: env,
+			Identity:    self,
+		}
 
-	env := os.Getenv("ENVIRONMENT")
-	if env == "" {
-		env = "development"
+		json.NewEncoder(w).Encode(response)
 	}
+}
 
-	response := Response{
-		Message:     "Go Docker Template",
-		GoVersion:   runtime.Version(),
-		Environment: env,
+// homeHandlerV2 takes the environment from the loaded configuration instead
+// of reading it again, and reports the build version. It is served to the
+// share of traffic configured with CANARY_WEIGHTS=home.v2=<percent>.
+func homeHandlerV2(cfg *config.Config, self *instance.Identity) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Response{
+			Message:     "Go Docker Template",
+			GoVersion:   runtime.Version(),
+			Environment: cfg.Environment,
+			Version:     cfg.Version,
+			Identity:    self,
+		})
 	}
+}
 
-	json.NewEncoder(w).Encode(response)
+// databaseDSN puts leased credentials into DATABASE_URL, in place of any
+// it has. The config checks that it parses.
+func databaseDSN(raw string) func(user, password string) string {
+	return func(user, password string) string {
+		u, _ := url.Parse(raw)
+		u.User = url.UserPassword(user, password)
+		return u.String()
+	}
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log/slog"
+
+	"github.com/example/app/internal/audit"
+	"github.com/example/app/internal/canary"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// reloader applies remote configuration changes to the running service.
+// LOG_LEVEL and CANARY_WEIGHTS take effect immediately; other changes are
+// recorded and wait for the next restart.
+type reloader struct {
+	cfg      *config.Config
+	tel      *telemetry.Telemetry
+	canaries *canary.Router
+	audit    *audit.Log
+}
+
+func (rl *reloader) apply(values map[string]string) {
+	next, err := config.LoadWith(values)
+	if err != nil {
+		slog.Error("remote configuration rejected", "error", err)
+		rl.audit.Record(audit.Event{Action: "config.rejected", Source: "remote", Details: map[string]any{"error": err.Error()}})
+		return
+	}
+	for _, c := range config.Diff(rl.cfg, next) {
+		var err error
+		applied := true
+		switch c.Name {
+		case "LOG_LEVEL":
+			rl.tel.SetLevel(next.LogLevel)
+		case "CANARY_WEIGHTS":
+			err = rl.canaries.ReloadWeights(next.Canary.Weights)
+		default:
+			applied = false
+		}
+		details := map[string]any{"name": c.Name, "old": c.Old, "new": c.New, "applied": applied && err == nil}
+		if err != nil {
+			details["error"] = err.Error()
+		} else if !applied {
+			slog.Warn("configuration change takes effect after a restart", "name", c.Name)
+		}
+		rl.audit.Record(audit.Event{Action: "config.changed", Source: "remote", Details: details})
+	}
+	rl.cfg = next
+}
@@ -0,0 +1,59 @@
+// Package admin runs the operational HTTP listener. It is separate from the
+// public listener so it can be firewalled independently, and every route
+// on it requires the admin bearer token.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+type Server struct {
+	router *mux.Router
+	srv    *http.Server
+	token  string
+}
+
+func New(cfg config.AdminConfig) *Server {
+	s := &Server{router: mux.NewRouter(), token: cfg.Token}
+	s.router.Use(s.authenticate)
+	s.srv = &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           s.router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Router is where features register their admin endpoints.
+func (s *Server) Router() *mux.Router { return s.router }
+
+// HTTPServer is the listener, to be run with lifecycle.Server like the
+// public one, so a port conflict fails startup.
+func (s *Server) HTTPServer() *http.Server { return s.srv }
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			problem.Write(w, http.StatusUnauthorized, "a valid admin bearer token is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WriteJSON is a small helper for admin handlers.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,79 @@
+// Package audit records changes made to the running service, such as
+// configuration updates, so operators can tell what changed, when and
+// where it came from. Events are logged with audit=true and the most
+// recent ones are kept for the admin API.
+package audit
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/admin"
+	"github.com/gorilla/mux"
+)
+
+// Event is one recorded change.
+type Event struct {
+	Time    time.Time      `json:"time"`
+	Action  string         `json:"action"` // e.g. config.changed
+	Source  string         `json:"source"` // where the change came from
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Log keeps the most recent events.
+type Log struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+// New returns a log keeping the last size events.
+func New(size int) *Log {
+	return &Log{events: make([]Event, size)}
+}
+
+// Record logs e and keeps it.
+func (l *Log) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	attrs := []any{"audit", true, "action", e.Action, "source", e.Source}
+	keys := make([]string, 0, len(e.Details))
+	for k := range e.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		attrs = append(attrs, k, e.Details[k])
+	}
+	slog.Info("audit", attrs...)
+
+	l.mu.Lock()
+	l.events[l.next] = e
+	l.next = (l.next + 1) % len(l.events)
+	l.full = l.full || l.next == 0
+	l.mu.Unlock()
+}
+
+// Events returns the kept events, oldest first.
+func (l *Log) Events() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]Event{}, l.events[:l.next]...)
+	}
+	return append(append([]Event{}, l.events[l.next:]...), l.events[:l.next]...)
+}
+
+// RegisterAdmin adds the audit endpoint to the admin router:
+//
+//	GET /audit  recent events, oldest first
+func (l *Log) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/audit", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, l.Events())
+	}).Methods(http.MethodGet)
+}
@@ -0,0 +1,336 @@
+// Package canary routes requests between versions of a handler, so a new
+// implementation can take a slice of traffic next to the current one.
+//
+// For every request the variant is chosen by, in order: the override
+// header, a variant assigned through the request context (WithVariant),
+// the configured rules, the client's sticky cookie, and finally the
+// route's weights applied to a hash of the user (or client IP), which keeps
+// a client on the same variant across requests.
+package canary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Variant is one version of a route's handler.
+type Variant struct {
+	Name    string
+	Handler http.Handler
+}
+
+// Router holds the canary routes and their current weights.
+type Router struct {
+	cfg      config.CanaryConfig
+	weights  map[string]map[string]int // configured, by route and variant
+	rules    map[string]map[string][]rule
+	requests *telemetry.Counter
+
+	mu     sync.RWMutex
+	routes map[string]*route
+}
+
+type route struct {
+	name     string
+	variants []Variant // the first one is the baseline
+	weights  map[string]int
+}
+
+type rule struct {
+	kind  string // header, cookie, user
+	key   string
+	value string
+}
+
+// ErrUnknownRoute is returned when adjusting a route that was never registered.
+var ErrUnknownRoute = errors.New("unknown route")
+
+// Reasons a variant was chosen, as recorded in logs and metrics.
+const (
+	ReasonHeader   = "header"
+	ReasonRule     = "rule"
+	ReasonSticky   = "sticky"
+	ReasonWeight   = "weight"
+	ReasonBaseline = "baseline"
+)
+
+func New(cfg config.CanaryConfig, reg *telemetry.Registry) (*Router, error) {
+	c := &Router{
+		cfg:      cfg,
+		rules:    map[string]map[string][]rule{},
+		routes:   map[string]*route{},
+		requests: reg.Counter("canary_requests_total", "Requests to canary routes by chosen variant and the reason it was chosen.", "route", "variant", "reason"),
+	}
+	var err error
+	if c.weights, err = parseWeights(cfg.Weights); err != nil {
+		return nil, err
+	}
+	for key, raw := range cfg.Rules {
+		name, variant, err := splitKey("CANARY_RULES", key)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range strings.Split(raw, "|") {
+			ru, err := parseRule(s)
+			if err != nil {
+				return nil, fmt.Errorf("canary: CANARY_RULES %s: %w", key, err)
+			}
+			if c.rules[name] == nil {
+				c.rules[name] = map[string][]rule{}
+			}
+			c.rules[name][variant] = append(c.rules[name][variant], ru)
+		}
+	}
+	return c, nil
+}
+
+// parseWeights parses CANARY_WEIGHTS into weights by route and variant.
+func parseWeights(raw map[string]string) (map[string]map[string]int, error) {
+	weights := map[string]map[string]int{}
+	for key, value := range raw {
+		name, variant, err := splitKey("CANARY_WEIGHTS", key)
+		if err != nil {
+			return nil, err
+		}
+		w, err := strconv.Atoi(value)
+		if err != nil || w < 0 || w > 100 {
+			return nil, fmt.Errorf("canary: CANARY_WEIGHTS %s: want a percentage, got %q", key, value)
+		}
+		if weights[name] == nil {
+			weights[name] = map[string]int{}
+		}
+		weights[name][variant] = w
+	}
+	for name, w := range weights {
+		if err := checkSum(name, w); err != nil {
+			return nil, err
+		}
+	}
+	return weights, nil
+}
+
+// ReloadWeights applies a new CANARY_WEIGHTS to the registered routes,
+// replacing weights set through the admin API. They also become the
+// weights DELETE /canary/{route} restores.
+func (c *Router) ReloadWeights(raw map[string]string) error {
+	weights, err := parseWeights(raw)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.weights = weights
+	for name, rt := range c.routes {
+		next := map[string]int{}
+		for v, w := range weights[name] {
+			if rt.variant(v) != nil && v != rt.variants[0].Name {
+				next[v] = w
+			}
+		}
+		rt.weights = next
+	}
+	return nil
+}
+
+// Handle registers a route and returns the handler dispatching between its
+// variants. The first variant is the baseline that receives all traffic not
+// assigned elsewhere.
+func (c *Router) Handle(name string, variants ...Variant) http.Handler {
+	if len(variants) == 0 {
+		panic("canary: route " + name + " has no variants")
+	}
+	rt := &route{name: name, variants: variants, weights: map[string]int{}}
+	for v, w := range c.weights[name] {
+		if rt.variant(v) == nil {
+			slog.Warn("canary weight for unknown variant ignored", "route", name, "variant", v)
+			continue
+		}
+		if v != variants[0].Name {
+			rt.weights[v] = w
+		}
+	}
+	for v := range c.rules[name] {
+		if rt.variant(v) == nil {
+			slog.Warn("canary rule for unknown variant ignored", "route", name, "variant", v)
+		}
+	}
+
+	c.mu.Lock()
+	c.routes[name] = rt
+	c.mu.Unlock()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, reason := c.choose(rt, r)
+		if reason == ReasonWeight && c.cfg.StickyTTL > 0 {
+			http.SetCookie(w, &http.Cookie{
+				Name:     cookieName(name),
+				Value:    v.Name,
+				Path:     "/",
+				MaxAge:   int(c.cfg.StickyTTL.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		w.Header().Set(c.cfg.Header, v.Name)
+		c.requests.Inc(name, v.Name, reason)
+		telemetry.AddLogAttrs(r.Context(), slog.Group("canary",
+			slog.String("route", name),
+			slog.String("variant", v.Name),
+			slog.String("reason", reason),
+		))
+		v.Handler.ServeHTTP(w, r)
+	})
+}
+
+type assignedKey struct{}
+
+// WithVariant sends the request to variant on route, unless the override
+// header names another. It is recorded with ReasonRule.
+func WithVariant(ctx context.Context, route, variant string) context.Context {
+	assigned := map[string]string{route: variant}
+	if prev, ok := ctx.Value(assignedKey{}).(map[string]string); ok {
+		for r, v := range prev {
+			if r != route {
+				assigned[r] = v
+			}
+		}
+	}
+	return context.WithValue(ctx, assignedKey{}, assigned)
+}
+
+func (c *Router) choose(rt *route, r *http.Request) (Variant, string) {
+	if v := rt.variant(r.Header.Get(c.cfg.Header)); v != nil {
+		return *v, ReasonHeader
+	}
+	if assigned, ok := r.Context().Value(assignedKey{}).(map[string]string); ok {
+		if v := rt.variant(assigned[rt.name]); v != nil {
+			return *v, ReasonRule
+		}
+	}
+
+	user := r.Header.Get(c.cfg.UserHeader)
+	for _, v := range rt.variants {
+		for _, ru := range c.rules[rt.name][v.Name] {
+			if ru.match(r, user) {
+				return v, ReasonRule
+			}
+		}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// A sticky assignment holds until its variant is weighted down to 0.
+	if ck, err := r.Cookie(cookieName(rt.name)); err == nil {
+		if v := rt.variant(ck.Value); v != nil && (v.Name == rt.variants[0].Name || rt.weights[v.Name] > 0) {
+			return *v, ReasonSticky
+		}
+	}
+
+	if len(rt.weights) == 0 {
+		return rt.variants[0], ReasonBaseline
+	}
+	key := user
+	if key == "" {
+		key, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(rt.name + "/" + key))
+	bucket := int(h.Sum32() % 100)
+	for _, v := range rt.variants[1:] {
+		if bucket < rt.weights[v.Name] {
+			return v, ReasonWeight
+		}
+		bucket -= rt.weights[v.Name]
+	}
+	return rt.variants[0], ReasonWeight
+}
+
+// CheckVariant reports whether variant is a variant of the registered
+// route, so configuration naming one can be rejected when it is loaded.
+func (c *Router) CheckVariant(route, variant string) error {
+	c.mu.RLock()
+	rt := c.routes[route]
+	c.mu.RUnlock()
+	if rt == nil {
+		return fmt.Errorf("%w %q", ErrUnknownRoute, route)
+	}
+	if rt.variant(variant) == nil {
+		return fmt.Errorf("route %q has no variant %q", route, variant)
+	}
+	return nil
+}
+
+func (rt *route) variant(name string) *Variant {
+	for i := range rt.variants {
+		if rt.variants[i].Name == name {
+			return &rt.variants[i]
+		}
+	}
+	return nil
+}
+
+func (ru rule) match(r *http.Request, user string) bool {
+	switch ru.kind {
+	case "header":
+		return r.Header.Get(ru.key) == ru.value
+	case "cookie":
+		ck, err := r.Cookie(ru.key)
+		return err == nil && ck.Value == ru.value
+	case "user":
+		return user != "" && user == ru.value
+	}
+	return false
+}
+
+func parseRule(s string) (rule, error) {
+	kind, spec, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return rule{}, fmt.Errorf("rule %q: want kind:spec", s)
+	}
+	switch kind {
+	case "header", "cookie":
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok || key == "" {
+			return rule{}, fmt.Errorf("rule %q: want %s:name=value", s, kind)
+		}
+		return rule{kind: kind, key: key, value: value}, nil
+	case "user":
+		return rule{kind: kind, value: spec}, nil
+	}
+	return rule{}, fmt.Errorf("rule %q: unknown kind %q", s, kind)
+}
+
+func splitKey(env, key string) (name, variant string, err error) {
+	name, variant, ok := strings.Cut(key, ".")
+	if !ok || name == "" || variant == "" {
+		return "", "", fmt.Errorf("canary: %s key %q: want route.variant", env, key)
+	}
+	return name, variant, nil
+}
+
+func checkSum(route string, weights map[string]int) error {
+	sum := 0
+	for _, w := range weights {
+		sum += w
+	}
+	if sum > 100 {
+		return fmt.Errorf("canary: weights of route %s add up to %d%%", route, sum)
+	}
+	return nil
+}
+
+func cookieName(route string) string {
+	return "canary_" + route
+}
@@ -0,0 +1,113 @@
+package canary
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+// RouteStatus describes a canary route for the admin API.
+type RouteStatus struct {
+	Route    string         `json:"route"`
+	Baseline string         `json:"baseline"`
+	Variants []string       `json:"variants"`
+	Weights  map[string]int `json:"weights"`
+}
+
+// Routes reports every registered route with its current weights.
+func (c *Router) Routes() []RouteStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]RouteStatus, 0, len(c.routes))
+	for _, rt := range c.routes {
+		out = append(out, rt.status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+	return out
+}
+
+func (rt *route) status() RouteStatus {
+	st := RouteStatus{Route: rt.name, Baseline: rt.variants[0].Name, Weights: map[string]int{}}
+	rest := 100
+	for _, v := range rt.variants {
+		st.Variants = append(st.Variants, v.Name)
+		if v.Name != st.Baseline {
+			st.Weights[v.Name] = rt.weights[v.Name]
+			rest -= rt.weights[v.Name]
+		}
+	}
+	st.Weights[st.Baseline] = rest
+	return st
+}
+
+// SetWeights replaces the weights of a route's non-baseline variants;
+// variants left out get 0. nil restores the configured weights.
+func (c *Router) SetWeights(name string, weights map[string]int) (RouteStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rt := c.routes[name]
+	if rt == nil {
+		return RouteStatus{}, fmt.Errorf("%w %q", ErrUnknownRoute, name)
+	}
+	if weights == nil {
+		weights = c.weights[name]
+	}
+	next := map[string]int{}
+	for v, w := range weights {
+		if rt.variant(v) == nil {
+			return RouteStatus{}, fmt.Errorf("route %s has no variant %q", name, v)
+		}
+		if w < 0 || w > 100 {
+			return RouteStatus{}, fmt.Errorf("weight of %s must be 0-100, got %d", v, w)
+		}
+		if v != rt.variants[0].Name {
+			next[v] = w
+		}
+	}
+	if err := checkSum(name, next); err != nil {
+		return RouteStatus{}, err
+	}
+	rt.weights = next
+	return rt.status(), nil
+}
+
+// RegisterAdmin adds the canary endpoints to the admin router:
+//
+//	GET    /canary          all routes and their weights
+//	PUT    /canary/{route}  set weights, body {"v2": 25}
+//	DELETE /canary/{route}  restore the configured weights
+func (c *Router) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/canary", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, c.Routes())
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/canary/{route}", func(w http.ResponseWriter, r *http.Request) {
+		var weights map[string]int
+		if err := json.NewDecoder(r.Body).Decode(&weights); err != nil || weights == nil {
+			problem.Write(w, http.StatusBadRequest, "body must be a JSON object of variant weights")
+			return
+		}
+		c.setWeights(w, mux.Vars(r)["route"], weights)
+	}).Methods(http.MethodPut)
+	r.HandleFunc("/canary/{route}", func(w http.ResponseWriter, r *http.Request) {
+		c.setWeights(w, mux.Vars(r)["route"], nil)
+	}).Methods(http.MethodDelete)
+}
+
+func (c *Router) setWeights(w http.ResponseWriter, name string, weights map[string]int) {
+	st, err := c.SetWeights(name, weights)
+	if errors.Is(err, ErrUnknownRoute) {
+		problem.Write(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	admin.WriteJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,226 @@
+// Package capture records full requests and responses for debugging, for
+// a sampled share of traffic, for requests carrying the debug header and
+// for requests a rule tags. Captures are redacted and size-capped, kept
+// in a ring buffer of files in the data directory, and downloaded as HAR
+// from the admin listener.
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/example/app/internal/auth"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/rules"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Reasons a request was captured.
+const (
+	ReasonHeader = "header"
+	ReasonRule   = "rule"
+	ReasonSample = "sample"
+)
+
+// Capturer is the capture middleware and the writer of the ring buffer.
+type Capturer struct {
+	cfg     config.CaptureConfig
+	service string
+	version string
+	store   *store
+	redact  *redactor
+	authn   *auth.Authenticator // nil ignores CAPTURE_HEADER
+	queue   chan *Entry
+
+	captured *telemetry.Counter
+	dropped  *telemetry.Counter
+}
+
+// New opens the ring buffer in CAPTURE_DIR, relative to DATA_DIR. authn
+// decides which requests may ask for a capture with CAPTURE_HEADER.
+func New(cfg *config.Config, authn *auth.Authenticator, reg *telemetry.Registry) (*Capturer, error) {
+	dir := cfg.Capture.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cfg.DataDir, dir)
+	}
+	st, err := openStore(dir, cfg.Capture.Entries)
+	if err != nil {
+		return nil, err
+	}
+	return &Capturer{
+		cfg:      cfg.Capture,
+		service:  cfg.ServiceName,
+		version:  cfg.Version,
+		store:    st,
+		redact:   newRedactor(cfg.Capture.RedactHeaders, cfg.Capture.RedactFields),
+		authn:    authn,
+		queue:    make(chan *Entry, 64),
+		captured: reg.Counter("capture_entries_total", "Requests captured by reason (sample, header, rule).", "reason"),
+		dropped:  reg.Counter("capture_dropped_total", "Captures dropped because the writer fell behind or failed."),
+	}, nil
+}
+
+// reason decides whether r is captured. CAPTURE_HEADER is only honoured
+// with a valid token, as capture runs before auth and anyone could
+// otherwise fill the ring and push real captures out.
+func (c *Capturer) reason(r *http.Request) string {
+	switch {
+	case c.cfg.Header != "" && r.Header.Get(c.cfg.Header) != "" && c.authn != nil && c.authn.Authenticated(r):
+		return ReasonHeader
+	case c.cfg.Tag != "" && slices.Contains(rules.Tags(r.Context()), c.cfg.Tag):
+		return ReasonRule
+	case c.cfg.SampleRate > 0 && rand.Float64() < c.cfg.SampleRate:
+		return ReasonSample
+	}
+	return ""
+}
+
+// Middleware records the requests picked for capture. The handler still
+// sees the whole request body; only the first CAPTURE_MAX_BODY bytes of
+// each body are kept.
+func (c *Capturer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reason := c.reason(r)
+		if reason == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		var reqBody []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			reqBody, _ = io.ReadAll(io.LimitReader(r.Body, int64(c.cfg.MaxBody)+1))
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+		}
+		// Captured before the handler runs, as handlers and later
+		// middleware may change it.
+		entry := c.request(r, reqBody)
+
+		rec := &recorder{ResponseRecorder: telemetry.NewResponseRecorder(w), max: c.cfg.MaxBody}
+		next.ServeHTTP(rec, r)
+
+		entry.Reason = reason
+		entry.Site = telemetry.Site(r.Context())
+		entry.StartedDateTime = start
+		entry.Time = ms(time.Since(start))
+		entry.Timings = Timings{Wait: entry.Time}
+		entry.Response = c.response(rec)
+		select {
+		case c.queue <- entry:
+			c.captured.Inc(reason)
+		default:
+			c.dropped.Inc()
+		}
+	})
+}
+
+func (c *Capturer) request(r *http.Request, body []byte) *Entry {
+	u := *r.URL
+	u.Host = r.Host
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	url, query := c.redact.query(&u)
+	e := &Entry{Request: Request{
+		Method:      r.Method,
+		URL:         url,
+		HTTPVersion: r.Proto,
+		Headers:     c.redact.header(r.Header),
+		QueryString: query,
+		Cookies:     []NameValue{},
+		HeadersSize: -1,
+		BodySize:    r.ContentLength,
+	}}
+	if len(body) > 0 {
+		mime := r.Header.Get("Content-Type")
+		pd := &PostData{MimeType: mime}
+		body, pd.Truncated = c.cap(body)
+		if utf8.Valid(body) {
+			pd.Text = c.redact.body(mime, string(body))
+		} else {
+			pd.Text, pd.Comment = base64.StdEncoding.EncodeToString(body), "base64"
+		}
+		e.Request.PostData = pd
+	}
+	return e
+}
+
+func (c *Capturer) response(rec *recorder) Response {
+	mime := rec.Header().Get("Content-Type")
+	body, truncated := c.cap(rec.body.Bytes())
+	content := Content{Size: rec.Written(), MimeType: mime, Truncated: truncated || rec.truncated}
+	if utf8.Valid(body) {
+		content.Text = c.redact.body(mime, string(body))
+	} else {
+		content.Text, content.Encoding = base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return Response{
+		Status:      rec.Status(),
+		StatusText:  http.StatusText(rec.Status()),
+		HTTPVersion: "HTTP/1.1",
+		Headers:     c.redact.header(rec.Header()),
+		Cookies:     []NameValue{},
+		Content:     content,
+		HeadersSize: -1,
+		BodySize:    rec.Written(),
+	}
+}
+
+func (c *Capturer) cap(b []byte) ([]byte, bool) {
+	if len(b) > c.cfg.MaxBody {
+		return b[:c.cfg.MaxBody], true
+	}
+	return b, false
+}
+
+// Run writes queued captures until ctx ends. Disk writes stay off the
+// request path.
+func (c *Capturer) Run(ctx context.Context) {
+	for {
+		select {
+		case e := <-c.queue:
+			if err := c.store.add(e); err != nil {
+				c.dropped.Inc()
+				slog.Warn("capture not written", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// recorder keeps the first max bytes of the response body.
+type recorder struct {
+	*telemetry.ResponseRecorder
+	max       int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if room := r.max - r.body.Len(); room > 0 {
+		r.body.Write(b[:min(room, len(b))])
+		r.truncated = r.truncated || len(b) > room
+	} else if len(b) > 0 {
+		r.truncated = true
+	}
+	return r.ResponseRecorder.Write(b)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,94 @@
+package capture
+
+import "time"
+
+// The HAR 1.2 subset captures are stored and exported in, so they open in
+// browser dev tools and HAR viewers. See http://www.softwareishard.com/blog/har-12-spec/.
+
+// HAR is the top-level document.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is one captured exchange. Fields starting with an underscore are
+// HAR custom fields.
+type Entry struct {
+	ID              uint64    `json:"_id"`
+	Reason          string    `json:"_reason"` // sample, header or rule
+	Site            string    `json:"_site,omitempty"`
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"` // milliseconds
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	Cookies     []NameValue `json:"cookies"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+	PostData    *PostData   `json:"postData,omitempty"`
+}
+
+type PostData struct {
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text"`
+	Comment   string `json:"comment,omitempty"`
+	Truncated bool   `json:"_truncated,omitempty"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Headers     []NameValue `json:"headers"`
+	Cookies     []NameValue `json:"cookies"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type Content struct {
+	Size      int64  `json:"size"`
+	MimeType  string `json:"mimeType"`
+	Text      string `json:"text,omitempty"`
+	Encoding  string `json:"encoding,omitempty"` // base64 for binary bodies
+	Truncated bool   `json:"_truncated,omitempty"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Timings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// NewHAR wraps entries in a HAR document created by the named service.
+func NewHAR(service, version string, entries []Entry) HAR {
+	if entries == nil {
+		entries = []Entry{}
+	}
+	return HAR{Log: HARLog{Version: "1.2", Creator: Creator{Name: service, Version: version}, Entries: entries}}
+}
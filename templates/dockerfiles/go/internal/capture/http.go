@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+// Summary describes a capture in the admin listing.
+type Summary struct {
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	Reason  string    `json:"reason"`
+	Method  string    `json:"method"`
+	URL     string    `json:"url"`
+	Status  int       `json:"status"`
+	Elapsed float64   `json:"elapsed_ms"`
+}
+
+// RegisterAdmin adds the capture endpoints to the admin router:
+//
+//	GET    /captures       captured requests, oldest first
+//	GET    /captures/har   every capture as a HAR file
+//	GET    /captures/{id}  one capture as a HAR file
+//	DELETE /captures       remove every capture
+func (c *Capturer) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/captures", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := c.store.list()
+		if err != nil {
+			problem.Write(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		out := make([]Summary, 0, len(entries))
+		for _, e := range entries {
+			out = append(out, Summary{
+				ID:      e.ID,
+				Time:    e.StartedDateTime,
+				Reason:  e.Reason,
+				Method:  e.Request.Method,
+				URL:     e.Request.URL,
+				Status:  e.Response.Status,
+				Elapsed: e.Time,
+			})
+		}
+		admin.WriteJSON(w, http.StatusOK, out)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/captures/har", func(w http.ResponseWriter, r *http.Request) {
+		entries, err := c.store.list()
+		if err != nil {
+			problem.Write(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.writeHAR(w, "captures.har", entries)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/captures/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+		e, err := c.store.get(id)
+		if errors.Is(err, os.ErrNotExist) {
+			problem.Write(w, http.StatusNotFound, fmt.Sprintf("no capture %d", id))
+			return
+		}
+		if err != nil {
+			problem.Write(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.writeHAR(w, fmt.Sprintf("capture-%d.har", id), []Entry{e})
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/captures", func(w http.ResponseWriter, r *http.Request) {
+		if err := c.store.clear(); err != nil {
+			problem.Write(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods(http.MethodDelete)
+}
+
+func (c *Capturer) writeHAR(w http.ResponseWriter, name string, entries []Entry) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	admin.WriteJSON(w, http.StatusOK, NewHAR(c.service, c.version, entries))
+}
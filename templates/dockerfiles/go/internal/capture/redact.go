@@ -0,0 +1,117 @@
+package capture
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Redacted replaces values that must not be stored.
+const Redacted = "[REDACTED]"
+
+// redactor removes credentials and configured fields from captures before
+// they reach the disk.
+type redactor struct {
+	headers map[string]bool // canonical names
+	fields  map[string]bool // lower case
+	pattern *regexp.Regexp  // "field": "value" pairs in JSON that doesn't parse
+}
+
+func newRedactor(headers, fields []string) *redactor {
+	r := &redactor{headers: map[string]bool{}, fields: map[string]bool{}}
+	var names []string
+	for _, h := range headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, f := range fields {
+		r.fields[strings.ToLower(f)] = true
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	if len(names) > 0 {
+		r.pattern = regexp.MustCompile(`(?i)("(?:` + strings.Join(names, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\s]+)`)
+	}
+	return r
+}
+
+// header lists h sorted by name, with redacted values.
+func (r *redactor) header(h http.Header) []NameValue {
+	out := []NameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			if r.headers[name] {
+				v = Redacted
+			}
+			out = append(out, NameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// query redacts sensitive parameters of a URL's query.
+func (r *redactor) query(u *url.URL) (string, []NameValue) {
+	q := u.Query()
+	out := []NameValue{}
+	for name, values := range q {
+		for i := range values {
+			if r.fields[strings.ToLower(name)] {
+				values[i] = Redacted
+			}
+			out = append(out, NameValue{Name: name, Value: values[i]})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	c := *u
+	c.RawQuery = q.Encode()
+	return c.String(), out
+}
+
+// body redacts fields of JSON and form bodies. JSON that doesn't parse,
+// e.g. because it was truncated, is redacted by pattern instead.
+func (r *redactor) body(mimeType, text string) string {
+	switch {
+	case strings.Contains(mimeType, "json"):
+		var v any
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			if r.pattern == nil {
+				return text
+			}
+			return r.pattern.ReplaceAllString(text, `$1"`+Redacted+`"`)
+		}
+		b, _ := json.Marshal(r.walk(v))
+		return string(b)
+	case strings.HasPrefix(mimeType, "application/x-www-form-urlencoded"):
+		form, err := url.ParseQuery(text)
+		if err != nil {
+			return text
+		}
+		for name := range form {
+			if r.fields[strings.ToLower(name)] {
+				form[name] = []string{Redacted}
+			}
+		}
+		return form.Encode()
+	}
+	return text
+}
+
+func (r *redactor) walk(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if r.fields[strings.ToLower(k)] {
+				v[k] = Redacted
+			} else {
+				v[k] = r.walk(child)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = r.walk(child)
+		}
+	}
+	return v
+}
@@ -0,0 +1,136 @@
+package capture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// store is a ring buffer of entries on disk, one file per entry named by
+// its sequence number. Writing entry n removes entry n-size, so the
+// directory never holds more than size captures, across restarts too.
+type store struct {
+	dir  string
+	size uint64
+
+	mu   sync.Mutex
+	next uint64
+}
+
+func openStore(dir string, size int) (*store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+	s := &store{dir: dir, size: uint64(max(size, 1)), next: 1}
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		s.next = ids[len(ids)-1] + 1
+	}
+	// CAPTURE_ENTRIES may have been lowered since the last run.
+	for _, id := range ids {
+		if id+s.size < s.next {
+			os.Remove(s.path(id))
+		}
+	}
+	return s, nil
+}
+
+// add assigns e the next ID and writes it, replacing the oldest entry.
+func (s *store) add(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ID = s.next
+	s.next++
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp := s.path(e.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path(e.ID)); err != nil {
+		return err
+	}
+	if e.ID > s.size {
+		os.Remove(s.path(e.ID - s.size))
+	}
+	return nil
+}
+
+// get reads one entry.
+func (s *store) get(id uint64) (Entry, error) {
+	var e Entry
+	b, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return e, err
+	}
+	return e, json.Unmarshal(b, &e)
+}
+
+// list reads every entry, oldest first. Entries removed while listing are
+// skipped.
+func (s *store) list() ([]Entry, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		e, err := s.get(id)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// clear removes every entry.
+func (s *store) clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		os.Remove(s.path(id))
+	}
+	return nil
+}
+
+func (s *store) ids() ([]uint64, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+	var ids []uint64
+	for _, f := range files {
+		name, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if id, err := strconv.ParseUint(name, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *store) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%012d.json", id))
+}
@@ -0,0 +1,236 @@
+// Package compose generates a Docker Compose definition for the service and
+// the backing services its configuration depends on.
+package compose
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/yamldoc"
+	"gopkg.in/yaml.v3"
+)
+
+// Options tune the generated file. Zero values fall back to defaults
+// derived from the configuration.
+type Options struct {
+	Name      string
+	Image     string
+	HostPort  string
+	RunAsUser int
+	// With adds dependencies from the catalog (postgres, redis,
+	// otel-collector) on top of those the configuration declares.
+	With []string
+	// Overlays are YAML files merged into the generated document.
+	Overlays []string
+}
+
+// Write generates the compose file and writes it as YAML.
+func Write(w io.Writer, cfg *config.Config, opts Options) error {
+	doc, err := Generate(cfg, opts)
+	if err != nil {
+		return err
+	}
+	return yamldoc.Encode(w, doc)
+}
+
+// Generate builds the compose document and applies overlays.
+func Generate(cfg *config.Config, opts Options) (*yaml.Node, error) {
+	opts = withDefaults(cfg, opts)
+
+	deps, err := resolve(cfg, opts.With)
+	if err != nil {
+		return nil, err
+	}
+
+	services := yamldoc.Map(opts.Name, app(cfg, opts, deps))
+	volumes := yamldoc.Map()
+	secrets := yamldoc.Map()
+	for _, s := range appSecrets(cfg, deps) {
+		secrets.Content = append(secrets.Content, yamldoc.Str(s), yamldoc.Map("file", "./secrets/"+s))
+	}
+	for _, d := range deps {
+		services.Content = append(services.Content, yamldoc.Str(d.Name), d.Service)
+		for _, v := range d.Volumes {
+			volumes.Content = append(volumes.Content, yamldoc.Str(v), yamldoc.Map())
+		}
+		for _, s := range d.Secrets {
+			if yamldoc.Get(secrets, s) == nil {
+				secrets.Content = append(secrets.Content, yamldoc.Str(s), yamldoc.Map("file", "./secrets/"+s))
+			}
+		}
+	}
+
+	doc := yamldoc.Map("services", services, "volumes", nonEmpty(volumes), "secrets", nonEmpty(secrets))
+	doc.HeadComment = fmt.Sprintf("Generated by `app compose` for %s %s.\n"+
+		"Put one secret per file in ./secrets before `docker compose up`, e.g.\n"+
+		"  mkdir -p secrets && openssl rand -hex 32 > secrets/admin_token",
+		opts.Name, cfg.Version)
+
+	for _, path := range opts.Overlays {
+		overlays, err := yamldoc.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range overlays {
+			yamldoc.Merge(doc, o)
+		}
+	}
+	return doc, nil
+}
+
+func withDefaults(cfg *config.Config, o Options) Options {
+	if o.Name == "" {
+		o.Name = cfg.ServiceName
+	}
+	if o.Image == "" {
+		o.Image = cfg.ServiceName + ":" + cfg.Version
+	}
+	if o.HostPort == "" {
+		o.HostPort = cfg.Port
+	}
+	if o.RunAsUser == 0 {
+		o.RunAsUser = 65534
+	}
+	return o
+}
+
+func app(cfg *config.Config, opts Options, deps []Dependency) *yaml.Node {
+	// Only variables that differ from their defaults are listed; the image
+	// already knows the rest.
+	env := yamldoc.Map()
+	overridden := map[string]bool{}
+	for _, d := range deps {
+		for k := range d.Env {
+			overridden[k] = true
+		}
+	}
+	for _, v := range config.Vars(cfg) {
+		if v.Secret || overridden[v.Name] || v.Value == v.Default || v.Name == "SERVICE_VERSION" {
+			continue
+		}
+		env.Content = append(env.Content, yamldoc.Str(v.Name), yamldoc.Comment(yamldoc.Str(v.Value), v.Description))
+	}
+	for _, d := range deps {
+		for _, k := range sortedKeys(d.Env) {
+			env.Content = append(env.Content, yamldoc.Str(k), yamldoc.Comment(yamldoc.Str(d.Env[k]), "provided by "+d.Name))
+		}
+	}
+	secrets := appSecrets(cfg, deps)
+	for _, s := range secrets {
+		env.Content = append(env.Content, yamldoc.Str(strings.ToUpper(s)+"_FILE"), yamldoc.Str("/run/secrets/"+s))
+	}
+
+	dependsOn := yamldoc.Map()
+	for _, d := range deps {
+		condition := "service_healthy"
+		if yamldoc.Get(d.Service, "healthcheck") == nil {
+			condition = "service_started"
+		}
+		dependsOn.Content = append(dependsOn.Content, yamldoc.Str(d.Name), yamldoc.Map("condition", condition))
+	}
+	if len(dependsOn.Content) == 0 {
+		dependsOn = nil
+	}
+
+	grace := int(math.Ceil((cfg.Drain.Delay + cfg.Drain.Timeout).Seconds())) + 10
+	uid := fmt.Sprintf("%d:%d", opts.RunAsUser, opts.RunAsUser)
+
+	var envNode any = env
+	if len(env.Content) == 0 {
+		envNode = nil
+	}
+
+	return yamldoc.Map(
+		"image", opts.Image,
+		"restart", "unless-stopped",
+		"user", uid,
+		"ports", []string{
+			opts.HostPort + ":" + cfg.Port,
+			// The admin API stays on the loopback interface of the host.
+			"127.0.0.1:" + cfg.Admin.Port + ":" + cfg.Admin.Port,
+		},
+		"environment", envNode,
+		"secrets", secretsNode(secrets),
+		"read_only", true,
+		// A named volume would be owned by root; tmpfs mounts can be owned
+		// by the image user.
+		"tmpfs", []string{"/tmp", fmt.Sprintf("%s:uid=%d,gid=%d", cfg.DataDir, opts.RunAsUser, opts.RunAsUser)},
+		"cap_drop", []string{"ALL"},
+		"security_opt", []string{"no-new-privileges:true"},
+		"healthcheck", yamldoc.Map(
+			// Scratch and distroless images have no curl; the binary checks itself.
+			"test", []string{"CMD", "/app", "healthcheck"},
+			"interval", "10s",
+			"timeout", "3s",
+			"retries", 3,
+			"start_period", "5s",
+		),
+		"stop_grace_period", fmt.Sprintf("%ds", grace),
+		"depends_on", dependsOn,
+	)
+}
+
+// appSecrets are the secrets mounted into the app: ADMIN_TOKEN, which the
+// drain and healthcheck helpers share with the server, any secret that is
+// set, and secrets dependencies hand to the app.
+func appSecrets(cfg *config.Config, deps []Dependency) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	for _, v := range config.Vars(cfg) {
+		if v.Secret && (v.Value != "" || v.Name == "ADMIN_TOKEN") {
+			add(strings.ToLower(v.Name))
+		}
+	}
+	for _, d := range deps {
+		for _, s := range d.AppSecrets {
+			add(s)
+		}
+	}
+	return out
+}
+
+func nonEmpty(m *yaml.Node) any {
+	if len(m.Content) == 0 {
+		return nil
+	}
+	return m
+}
+
+func secretsNode(names []string) any {
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// endpointHost returns the host of a host:port or URL endpoint.
+func endpointHost(endpoint string) string {
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		endpoint = endpoint[i+3:]
+	}
+	endpoint, _, _ = strings.Cut(endpoint, "/")
+	if host, _, err := net.SplitHostPort(endpoint); err == nil {
+		return host
+	}
+	return endpoint
+}
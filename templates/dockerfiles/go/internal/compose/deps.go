@@ -0,0 +1,139 @@
+package compose
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/yamldoc"
+	"gopkg.in/yaml.v3"
+)
+
+// Dependency is a backing service added next to the app.
+type Dependency struct {
+	Name    string
+	Service *yaml.Node
+	// Env is set on the app so it finds the dependency.
+	Env map[string]string
+	// Secrets are declared at the top level for the dependency itself;
+	// AppSecrets are additionally mounted into the app as NAME_FILE.
+	Secrets    []string
+	AppSecrets []string
+	Volumes    []string
+}
+
+// entry describes a catalog dependency. declared reports whether the
+// configuration needs it, e.g. because an endpoint points at its service
+// name; entries without declared are only added with --with.
+type entry struct {
+	build    func(cfg *config.Config) Dependency
+	declared func(cfg *config.Config) bool
+}
+
+var catalog = map[string]entry{
+	"postgres": {
+		build: func(*config.Config) Dependency {
+			return Dependency{
+				Name: "postgres",
+				Service: yamldoc.Map(
+					"image", "postgres:16-alpine",
+					"restart", "unless-stopped",
+					"environment", yamldoc.Map(
+						"POSTGRES_USER", "app",
+						"POSTGRES_DB", "app",
+						"POSTGRES_PASSWORD_FILE", "/run/secrets/postgres_password",
+					),
+					"secrets", []string{"postgres_password"},
+					"volumes", []string{"postgres-data:/var/lib/postgresql/data"},
+					"healthcheck", yamldoc.Map(
+						"test", []string{"CMD", "pg_isready", "-U", "app", "-d", "app"},
+						"interval", "5s",
+						"timeout", "3s",
+						"retries", 10,
+					),
+				),
+				// The connection string carries the password, so it is a secret
+				// file as well: postgres://app:<password>@postgres:5432/app?sslmode=disable
+				Secrets:    []string{"postgres_password"},
+				AppSecrets: []string{"database_url"},
+				Volumes:    []string{"postgres-data"},
+			}
+		},
+		declared: func(cfg *config.Config) bool {
+			return cfg.Database.Enabled()
+		},
+	},
+	"redis": {build: func(*config.Config) Dependency {
+		return Dependency{
+			Name: "redis",
+			Service: yamldoc.Map(
+				"image", "redis:7-alpine",
+				"restart", "unless-stopped",
+				"command", []string{"redis-server", "--save", "60", "1", "--appendonly", "no"},
+				"volumes", []string{"redis-data:/data"},
+				"read_only", true,
+				"healthcheck", yamldoc.Map(
+					"test", []string{"CMD", "redis-cli", "ping"},
+					"interval", "5s",
+					"timeout", "3s",
+					"retries", 10,
+				),
+			),
+			Volumes: []string{"redis-data"},
+		}
+	}},
+	"otel-collector": {
+		build: func(cfg *config.Config) Dependency {
+			endpoint := "otel-collector:4317"
+			if cfg.OTLP.Protocol == "http" {
+				endpoint = "http://otel-collector:4318"
+			}
+			return Dependency{
+				Name: "otel-collector",
+				Service: yamldoc.Map(
+					"image", "otel/opentelemetry-collector:0.104.0",
+					"restart", "unless-stopped",
+				),
+				Env: map[string]string{"OTLP_ENDPOINT": endpoint, "OTLP_INSECURE": "true"},
+			}
+		},
+		declared: func(cfg *config.Config) bool {
+			return cfg.OTLP.Enabled() && endpointHost(cfg.OTLP.Endpoint) == "otel-collector"
+		},
+	},
+}
+
+// resolve returns the dependencies declared by the configuration plus those
+// requested explicitly, in a stable order.
+func resolve(cfg *config.Config, with []string) ([]Dependency, error) {
+	want := map[string]bool{}
+	for name, e := range catalog {
+		if e.declared != nil && e.declared(cfg) {
+			want[name] = true
+		}
+	}
+	for _, name := range with {
+		if _, ok := catalog[name]; !ok {
+			return nil, fmt.Errorf("unknown dependency %q (known: %s)", name, strings.Join(known(), ", "))
+		}
+		want[name] = true
+	}
+
+	var deps []Dependency
+	for _, name := range known() {
+		if want[name] {
+			deps = append(deps, catalog[name].build(cfg))
+		}
+	}
+	return deps, nil
+}
+
+func known() []string {
+	names := make([]string, 0, len(catalog))
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
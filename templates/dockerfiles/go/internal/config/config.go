@@ -0,0 +1,508 @@
+// Package config loads the service configuration from environment
+// variables, following the twelve-factor style used throughout the
+// Docker examples.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// buildVersion is set at build time with
+// -ldflags "-X github.com/example/app/internal/config.buildVersion=1.2.3".
+var buildVersion = "dev"
+
+type Config struct {
+	ServiceName string `env:"SERVICE_NAME" default:"go-app" desc:"Service name reported in logs and telemetry"`
+	Version     string `env:"SERVICE_VERSION" desc:"Service version; defaults to the version baked in at build time"`
+	Environment string `env:"ENVIRONMENT" default:"development" desc:"Deployment environment (development, staging, production)"`
+	Port        string `env:"PORT" default:"8080" desc:"Port of the public HTTP listener"`
+	DataDir     string `env:"DATA_DIR" default:"/data" desc:"Writable directory for runtime state (mount a volume or tmpfs)"`
+
+	LogLevel  string `env:"LOG_LEVEL" default:"info" desc:"Minimum log level (debug, info, warn, error)"`
+	LogFormat string `env:"LOG_FORMAT" default:"text" desc:"Log output format (text, json)"`
+
+	Admin       AdminConfig
+	Maintenance MaintenanceConfig
+	Drain       DrainConfig
+	OTLP        OTLPConfig
+	Errors      ErrorsConfig
+	Discovery   DiscoveryConfig
+	Upstreams   UpstreamsConfig
+	Canary      CanaryConfig
+	Shadow      ShadowConfig
+	Auth        AuthConfig
+	RateLimit   RateLimitConfig
+	Proxy       ProxyConfig
+	Diagnostics DiagnosticsConfig
+	Instance    InstanceConfig
+	Lifecycle   LifecycleConfig
+	Wait        WaitConfig
+	Secrets     SecretsConfig
+	Remote      RemoteConfig
+	Plugins     PluginsConfig
+	Rules       RulesConfig
+	Sites       SitesConfig
+	Capture     CaptureConfig
+	Inspect     InspectConfig
+	Database    DatabaseConfig
+	Usage       UsageConfig
+}
+
+// AdminConfig controls the separate admin listener used for operational
+// endpoints. It is only started when a token is configured.
+type AdminConfig struct {
+	Port  string `env:"ADMIN_PORT" default:"8081" desc:"Port of the admin HTTP listener"`
+	Token string `env:"ADMIN_TOKEN" secret:"true" desc:"Bearer token required by the admin API; the admin listener is disabled when empty"`
+}
+
+// Enabled reports whether the admin listener should run.
+func (c AdminConfig) Enabled() bool {
+	return c.Token != ""
+}
+
+// MaintenanceConfig controls maintenance mode, in which public routes answer
+// 503 while health, metrics and admin endpoints keep working.
+type MaintenanceConfig struct {
+	File          string        `env:"MAINTENANCE_FILE" default:"maintenance" desc:"Maintenance is on while this file exists; relative paths are resolved against DATA_DIR"`
+	PollInterval  time.Duration `env:"MAINTENANCE_POLL_INTERVAL" default:"5s" desc:"How often the maintenance file is checked"`
+	RetryAfter    time.Duration `env:"MAINTENANCE_RETRY_AFTER" default:"5m" desc:"Retry-After sent with maintenance responses"`
+	FailReadiness bool          `env:"MAINTENANCE_FAIL_READINESS" default:"false" desc:"Report not-ready while in maintenance so load balancers drain the instance"`
+}
+
+// DrainConfig controls the drain sequence run before shutdown (preStop).
+type DrainConfig struct {
+	Delay   time.Duration `env:"DRAIN_DELAY" default:"5s" desc:"Time for load balancers to notice the failed readiness before waiting on in-flight requests"`
+	Timeout time.Duration `env:"DRAIN_TIMEOUT" default:"30s" desc:"Maximum time to wait for in-flight requests to finish"`
+}
+
+// OTLPConfig controls push-based export of metrics and logs to an
+// OpenTelemetry collector. Prometheus scraping of /metrics keeps working
+// whether or not export is enabled.
+type OTLPConfig struct {
+	Endpoint       string            `env:"OTLP_ENDPOINT" desc:"Collector endpoint, host:port for grpc or a base URL for http"`
+	Protocol       string            `env:"OTLP_PROTOCOL" default:"grpc" desc:"Export protocol (grpc, http)"`
+	Insecure       bool              `env:"OTLP_INSECURE" default:"false" desc:"Disable TLS towards the collector"`
+	Headers        map[string]string `env:"OTLP_HEADERS" secret:"true" desc:"Extra request headers as key=value pairs"`
+	Metrics        bool              `env:"OTLP_METRICS" default:"false" desc:"Export metrics over OTLP"`
+	Logs           bool              `env:"OTLP_LOGS" default:"false" desc:"Export logs over OTLP"`
+	ExportInterval time.Duration     `env:"OTLP_EXPORT_INTERVAL" default:"30s" desc:"Interval between metric collections"`
+	BatchSize      int               `env:"OTLP_BATCH_SIZE" default:"512" desc:"Maximum records per export request"`
+	QueueSize      int               `env:"OTLP_QUEUE_SIZE" default:"4096" desc:"Records buffered while the collector is unreachable"`
+	Timeout        time.Duration     `env:"OTLP_TIMEOUT" default:"10s" desc:"Timeout of a single export request"`
+	MaxRetries     int               `env:"OTLP_MAX_RETRIES" default:"5" desc:"Retries of a failed export before the batch is dropped"`
+}
+
+// Enabled reports whether any signal is exported.
+func (c OTLPConfig) Enabled() bool {
+	return c.Metrics || c.Logs
+}
+
+// ErrorsConfig controls reporting of panics and 5xx responses to a
+// Sentry-compatible service.
+type ErrorsConfig struct {
+	DSN           string   `env:"SENTRY_DSN" secret:"true" desc:"Sentry-compatible DSN; error reporting is disabled when empty"`
+	RateLimit     int      `env:"SENTRY_RATE_LIMIT" default:"30" desc:"Maximum error reports sent per minute"`
+	Breadcrumbs   int      `env:"SENTRY_BREADCRUMBS" default:"50" desc:"Log records kept as breadcrumbs per report"`
+	Report5xx     bool     `env:"SENTRY_REPORT_5XX" default:"true" desc:"Report 5xx responses that did not panic"`
+	RedactHeaders []string `env:"SENTRY_REDACT_HEADERS" desc:"Extra request headers to redact, comma separated"`
+}
+
+// DiscoveryConfig controls registration with a Consul-compatible agent and
+// resolution of upstreams through the same registry. The variable names
+// match the ones the consul CLI reads.
+type DiscoveryConfig struct {
+	Addr            string            `env:"CONSUL_HTTP_ADDR" desc:"Agent API address, e.g. http://127.0.0.1:8500; discovery is disabled when empty"`
+	Token           string            `env:"CONSUL_HTTP_TOKEN" secret:"true" desc:"ACL token sent as X-Consul-Token"`
+	Address         string            `env:"CONSUL_SERVICE_ADDRESS" desc:"Address registered for this instance; the first private interface address when empty"`
+	Tags            []string          `env:"CONSUL_TAGS" desc:"Tags registered with the service, comma separated"`
+	Meta            map[string]string `env:"CONSUL_META" desc:"Extra service metadata as key=value pairs; version and environment are always set"`
+	CheckPath       string            `env:"CONSUL_CHECK_PATH" default:"/ready" desc:"Path of the HTTP check the agent runs against the instance"`
+	CheckInterval   time.Duration     `env:"CONSUL_CHECK_INTERVAL" default:"10s" desc:"Interval of the agent's health check"`
+	CheckTimeout    time.Duration     `env:"CONSUL_CHECK_TIMEOUT" default:"2s" desc:"Timeout of the agent's health check"`
+	DeregisterAfter time.Duration     `env:"CONSUL_DEREGISTER_AFTER" default:"1m" desc:"The agent removes the instance after its check has been critical this long"`
+	ResolveTTL      time.Duration     `env:"CONSUL_RESOLVE_TTL" default:"10s" desc:"How long resolved upstream instances are cached"`
+}
+
+// Enabled reports whether an agent is configured.
+func (c DiscoveryConfig) Enabled() bool {
+	return c.Addr != ""
+}
+
+// UpstreamsConfig controls how the outbound HTTP client resolves and
+// balances requests to sibling services.
+type UpstreamsConfig struct {
+	Targets          map[string]string `env:"UPSTREAMS" desc:"Upstream hosts as name=target pairs; targets are dns:host:port, srv:_service._proto.name or consul:[tag.]service"`
+	Balancer         string            `env:"UPSTREAM_BALANCER" default:"round_robin" desc:"Load balancing policy (round_robin, least_requests, p2c)"`
+	DNSServer        string            `env:"UPSTREAM_DNS_SERVER" desc:"DNS server as host:port; the system resolver when empty"`
+	DNSRefresh       time.Duration     `env:"UPSTREAM_DNS_REFRESH" default:"10s" desc:"Interval at which DNS targets are resolved again"`
+	EjectFailures    int               `env:"UPSTREAM_EJECT_FAILURES" default:"5" desc:"Consecutive failures (errors or 5xx) after which an instance is ejected; 0 disables ejection"`
+	EjectDuration    time.Duration     `env:"UPSTREAM_EJECT_DURATION" default:"30s" desc:"Base ejection time, multiplied by the number of times the instance was ejected"`
+	MaxEjectDuration time.Duration     `env:"UPSTREAM_MAX_EJECT_DURATION" default:"5m" desc:"Upper bound of a single ejection"`
+}
+
+// CanaryConfig controls routing between handler versions registered with
+// the canary router. Keys are route.variant, e.g. home.v2.
+type CanaryConfig struct {
+	Weights    map[string]string `env:"CANARY_WEIGHTS" desc:"Traffic percentage per route.variant, e.g. home.v2=10; the first variant of a route gets the rest"`
+	Rules      map[string]string `env:"CANARY_RULES" desc:"Requests matching any rule go to route.variant; rules are header:Name=value, cookie:name=value or user:id, separated by |"`
+	Header     string            `env:"CANARY_HEADER" default:"X-Canary" desc:"Request header forcing a variant by name; the chosen variant is echoed in this response header"`
+	UserHeader string            `env:"CANARY_USER_HEADER" default:"X-User-ID" desc:"Request header identifying the user for sticky assignment and user rules; the client IP is used when absent"`
+	StickyTTL  time.Duration     `env:"CANARY_STICKY_TTL" default:"24h" desc:"Lifetime of the cookie keeping a client on its variant; 0 disables the cookie"`
+}
+
+// ShadowConfig controls mirroring of sampled requests to a shadow target and
+// the comparison of its responses with the primary ones.
+type ShadowConfig struct {
+	Target         string        `env:"SHADOW_TARGET" desc:"Base URL requests are mirrored to, e.g. http://app-v2:8080 or http://<UPSTREAMS name>; mirroring is disabled when empty"`
+	SampleRate     float64       `env:"SHADOW_SAMPLE_RATE" default:"0.1" desc:"Fraction of requests mirrored, from 0 to 1"`
+	Methods        []string      `env:"SHADOW_METHODS" default:"GET,HEAD" desc:"Methods that are mirrored; add unsafe methods only if the shadow has its own data"`
+	MaxBody        int           `env:"SHADOW_MAX_BODY" default:"1048576" desc:"Requests with larger bodies are not mirrored and larger responses are not compared"`
+	Timeout        time.Duration `env:"SHADOW_TIMEOUT" default:"5s" desc:"Timeout of a mirrored request"`
+	Concurrency    int           `env:"SHADOW_CONCURRENCY" default:"16" desc:"Mirrored requests in flight; samples beyond it are dropped"`
+	CompareHeaders []string      `env:"SHADOW_COMPARE_HEADERS" default:"Content-Type" desc:"Response headers that must match"`
+	IgnoreFields   []string      `env:"SHADOW_IGNORE_FIELDS" desc:"JSON body fields left out of the comparison as dotted paths, e.g. timestamp,items.*.id"`
+}
+
+// Enabled reports whether requests are mirrored.
+func (c ShadowConfig) Enabled() bool {
+	return c.Target != "" && c.SampleRate > 0
+}
+
+// AuthConfig protects the public routes with bearer tokens. Health,
+// readiness and metrics stay open.
+type AuthConfig struct {
+	Tokens []string `env:"API_TOKENS" secret:"true" desc:"Bearer tokens accepted on public routes; authentication is off when empty"`
+}
+
+// Enabled reports whether public routes require a token.
+func (c AuthConfig) Enabled() bool {
+	return len(c.Tokens) > 0
+}
+
+// RateLimitConfig limits the request rate of each client on public routes.
+type RateLimitConfig struct {
+	Rate  float64 `env:"RATE_LIMIT" default:"0" desc:"Requests per second allowed per client; rate limiting is off when 0"`
+	Burst int     `env:"RATE_LIMIT_BURST" default:"20" desc:"Requests a client may send at once above the rate"`
+	Key   string  `env:"RATE_LIMIT_KEY" default:"ip" desc:"What identifies a client (ip, token, header:<name>)"`
+
+	Classes map[string]string `env:"RATE_LIMIT_CLASSES" desc:"Rate and burst of each class requests can be put in by rules, e.g. heavy=1/5; each class has its own buckets"`
+}
+
+// Enabled reports whether requests are rate limited.
+func (c RateLimitConfig) Enabled() bool {
+	return c.Rate > 0 || len(c.Classes) > 0
+}
+
+// ProxyConfig maps public path prefixes to upstream URLs, so the service can
+// front other services as a small gateway.
+type ProxyConfig struct {
+	Routes          map[string]string `env:"PROXY_ROUTES" desc:"Path prefixes proxied to upstream URLs, e.g. /legacy=http://legacy:8080/api; the prefix is replaced by the URL's path"`
+	RequestHeaders  map[string]string `env:"PROXY_REQUEST_HEADERS" desc:"Headers set on proxied requests; an empty value removes the header"`
+	ResponseHeaders map[string]string `env:"PROXY_RESPONSE_HEADERS" desc:"Headers set on proxied responses; an empty value removes the header"`
+	Timeout         time.Duration     `env:"PROXY_TIMEOUT" default:"30s" desc:"Time to wait for an upstream's response headers; streamed bodies are not limited"`
+	Retries         int               `env:"PROXY_RETRIES" default:"2" desc:"Retries of idempotent requests without a body after a connection error, 502, 503 or 504"`
+	RetryBackoff    time.Duration     `env:"PROXY_RETRY_BACKOFF" default:"100ms" desc:"Wait before the first retry, doubled for each further one"`
+	BreakerFailures int               `env:"PROXY_BREAKER_FAILURES" default:"5" desc:"Consecutive failures that open a route's circuit breaker; 0 disables it"`
+	BreakerCooldown time.Duration     `env:"PROXY_BREAKER_COOLDOWN" default:"30s" desc:"How long an open breaker rejects requests before letting a probe through"`
+}
+
+// Enabled reports whether any routes are proxied.
+func (c ProxyConfig) Enabled() bool {
+	return len(c.Routes) > 0
+}
+
+// DiagnosticsConfig controls the network troubleshooting endpoints on the
+// admin listener, which stand in for the tools scratch images lack.
+type DiagnosticsConfig struct {
+	Endpoints   []string      `env:"DIAGNOSTICS" desc:"/diag endpoints served on the admin listener, from echo, resolve, dial and interfaces; off when empty"`
+	DialTimeout time.Duration `env:"DIAGNOSTICS_TIMEOUT" default:"5s" desc:"Longest lookup or dial a /diag request may ask for"`
+}
+
+// Enabled reports whether any /diag endpoints are served.
+func (c DiagnosticsConfig) Enabled() bool {
+	return len(c.Endpoints) > 0
+}
+
+// InstanceConfig describes this replica in responses, so load-balanced
+// requests show which one answered. Zone and region must be passed in, as a
+// container cannot see its node's topology labels.
+type InstanceConfig struct {
+	ID     string `env:"INSTANCE_ID" desc:"Identifier of this replica; the short container ID, else the hostname, when empty"`
+	Zone   string `env:"INSTANCE_ZONE" desc:"Availability zone reported in responses, e.g. the node's topology.kubernetes.io/zone label"`
+	Region string `env:"INSTANCE_REGION" desc:"Region reported in responses"`
+	Header string `env:"SERVED_BY_HEADER" default:"X-Served-By" desc:"Response header carrying the instance ID; empty disables it"`
+}
+
+// LifecycleConfig bounds the start and stop steps of each component.
+// Components may set their own limits.
+type LifecycleConfig struct {
+	StartTimeout time.Duration `env:"COMPONENT_START_TIMEOUT" default:"30s" desc:"Time a component may take to start before startup is abandoned"`
+	StopTimeout  time.Duration `env:"COMPONENT_STOP_TIMEOUT" default:"10s" desc:"Time a component may take to stop before shutdown moves on"`
+}
+
+// WaitConfig lists the dependencies startup waits for. Targets may carry
+// credentials, so WAIT_FOR_FILE can point at the same secret as the
+// application's connection string.
+type WaitConfig struct {
+	Targets    []string      `env:"WAIT_FOR" secret:"true" desc:"Dependencies to wait for at startup, comma separated: tcp://host:port, http(s)://host/path, postgres://user@host/db, mysql://host:port"`
+	Timeout    time.Duration `env:"WAIT_TIMEOUT" default:"60s" desc:"Startup fails if a dependency is still not ready after this long"`
+	Backoff    time.Duration `env:"WAIT_BACKOFF" default:"250ms" desc:"Wait before the second attempt, doubled after every further one"`
+	MaxBackoff time.Duration `env:"WAIT_MAX_BACKOFF" default:"5s" desc:"Upper bound of the wait between attempts"`
+}
+
+// SecretsConfig selects where application secrets are read from, in
+// addition to the NAME_FILE variables every setting accepts.
+type SecretsConfig struct {
+	Provider string `env:"SECRETS_PROVIDER" default:"file" desc:"Where application secrets are read from (file, env, vault)"`
+	Dir      string `env:"SECRETS_DIR" default:"/run/secrets" desc:"Directory read by the file provider"`
+	Vault    VaultConfig
+}
+
+// VaultConfig connects to a Vault-compatible server. The variable names
+// match the ones the vault CLI reads.
+type VaultConfig struct {
+	Addr         string `env:"VAULT_ADDR" desc:"Vault API address, e.g. https://vault:8200"`
+	Token        string `env:"VAULT_TOKEN" secret:"true" desc:"Token to authenticate with when AppRole is not configured"`
+	Namespace    string `env:"VAULT_NAMESPACE" desc:"Namespace sent as X-Vault-Namespace"`
+	RoleID       string `env:"VAULT_ROLE_ID" desc:"AppRole role ID; AppRole login is used when set"`
+	SecretID     string `env:"VAULT_SECRET_ID" secret:"true" desc:"AppRole secret ID"`
+	AppRoleMount string `env:"VAULT_APPROLE_MOUNT" default:"approle" desc:"Mount path of the AppRole auth method"`
+	KVMount      string `env:"VAULT_KV_MOUNT" default:"secret" desc:"Mount path of the KV secrets engine"`
+	KVVersion    int    `env:"VAULT_KV_VERSION" default:"2" desc:"Version of the KV secrets engine (1, 2)"`
+	DBCreds      string `env:"VAULT_DB_CREDS" desc:"Path of dynamic database credentials, e.g. database/creds/app; they are leased, renewed and rotated while the service runs and replace those in DATABASE_URL"`
+}
+
+// RemoteConfig points at a key/value store holding settings shared by a
+// fleet, one key per variable below a prefix, e.g. config/go-app/LOG_LEVEL.
+type RemoteConfig struct {
+	URL   string        `env:"REMOTE_CONFIG_URL" desc:"Key prefix in Consul KV or etcd, e.g. consul://consul:8500/config/go-app or etcd://etcd:2379/config/go-app; remote configuration is off when empty"`
+	Token string        `env:"REMOTE_CONFIG_TOKEN" secret:"true" desc:"Consul ACL token, or etcd auth token"`
+	Cache string        `env:"REMOTE_CONFIG_CACHE" default:"remote-config.json" desc:"Last values read, used when the store is down at startup; relative paths are resolved against DATA_DIR"`
+	Wait  time.Duration `env:"REMOTE_CONFIG_WAIT" default:"5m" desc:"Longest a watch request is held open by the store before it is renewed"`
+}
+
+// Enabled reports whether a remote store is configured.
+func (c RemoteConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// PluginsConfig loads WebAssembly middleware that runs on public requests.
+// Each call is bounded in time and each instance in memory, so a faulty
+// plugin can fail requests but not take the process down.
+type PluginsConfig struct {
+	Modules     []string          `env:"PLUGINS" desc:"WebAssembly modules run in order on public requests, comma separated; relative paths are resolved against PLUGINS_DIR"`
+	Dir         string            `env:"PLUGINS_DIR" default:"/plugins" desc:"Directory holding the plugin modules"`
+	Config      map[string]string `env:"PLUGIN_CONFIG" secret:"true" desc:"Settings plugins read with get_config, as plugin.key=value pairs"`
+	MemoryLimit int               `env:"PLUGIN_MEMORY_LIMIT" default:"16" desc:"Memory a plugin instance may use, in MiB"`
+	Timeout     time.Duration     `env:"PLUGIN_TIMEOUT" default:"20ms" desc:"Time a plugin may spend on one request before it is stopped"`
+	Instances   int               `env:"PLUGIN_INSTANCES" default:"8" desc:"Idle instances kept per plugin for reuse"`
+	FailOpen    bool              `env:"PLUGIN_FAIL_OPEN" default:"false" desc:"Let requests through when a plugin fails or times out instead of answering 500"`
+}
+
+// Enabled reports whether any plugins are configured.
+func (c PluginsConfig) Enabled() bool {
+	return len(c.Modules) > 0
+}
+
+// RulesConfig points at declarative request rules: CEL expressions over the
+// request, each with an action such as deny or route.
+type RulesConfig struct {
+	File string `env:"RULES_FILE" desc:"YAML file of request rules evaluated in order on public requests; rules are off when empty"`
+}
+
+// Enabled reports whether a rules file is configured.
+func (c RulesConfig) Enabled() bool {
+	return c.File != ""
+}
+
+// SitesConfig serves several hostnames from one deployment, each with its
+// own routes, middleware and certificate. Keys are site names.
+type SitesConfig struct {
+	Hosts      map[string]string `env:"SITES" desc:"Sites by host name, as name=host|host; hosts are gorilla/mux templates such as {tenant}.example.com"`
+	Default    string            `env:"SITE_DEFAULT" default:"default" desc:"Site serving hosts no site matches, a name from SITES or default; empty answers them 404"`
+	Routes     map[string]string `env:"SITE_ROUTES" desc:"Route groups each site serves, as name=home|proxy; a site not listed serves all of them"`
+	Middleware map[string]string `env:"SITE_MIDDLEWARE" desc:"Middleware each site runs, as name=auth|ratelimit; a site not listed runs all of it, and drain and maintenance run on every site"`
+	TLS        map[string]string `env:"SITE_TLS" desc:"Certificate and key file of each site, as name=cert.pem|key.pem; chosen by SNI"`
+	TLSPort    string            `env:"TLS_PORT" default:"8443" desc:"Port of the HTTPS listener, started when any site has a certificate"`
+}
+
+// CaptureConfig controls recording of full requests and responses for
+// debugging. Captured bodies may hold personal data, so it is opt-in and
+// credentials are redacted before anything is written.
+type CaptureConfig struct {
+	SampleRate    float64  `env:"CAPTURE_SAMPLE_RATE" default:"0" desc:"Fraction of public requests captured, from 0 to 1"`
+	Header        string   `env:"CAPTURE_HEADER" desc:"Requests carrying this header and a valid API_TOKENS token are captured"`
+	Tag           string   `env:"CAPTURE_TAG" desc:"Requests a rule tags with this tag are captured"`
+	MaxBody       int      `env:"CAPTURE_MAX_BODY" default:"65536" desc:"Bytes kept of each request and response body"`
+	Entries       int      `env:"CAPTURE_ENTRIES" default:"500" desc:"Captures kept; the oldest is removed when a new one is written"`
+	Dir           string   `env:"CAPTURE_DIR" default:"captures" desc:"Directory of the captures; relative paths are resolved against DATA_DIR"`
+	RedactHeaders []string `env:"CAPTURE_REDACT_HEADERS" default:"Authorization,Proxy-Authorization,Cookie,Set-Cookie,X-Api-Key" desc:"Headers whose values are never stored"`
+	RedactFields  []string `env:"CAPTURE_REDACT_FIELDS" default:"password,secret,token,access_token,refresh_token,api_key,client_secret" desc:"Query parameters and JSON or form fields whose values are never stored"`
+}
+
+// Enabled reports whether any way of picking requests to capture is set.
+func (c CaptureConfig) Enabled() bool {
+	return c.SampleRate > 0 || c.Header != "" || c.Tag != ""
+}
+
+// InspectConfig sizes the in-memory request inspector served at
+// /debug/requests on the admin listener.
+type InspectConfig struct {
+	Requests  int      `env:"DEBUG_REQUESTS" default:"100" desc:"Finished requests /debug/requests keeps; 0 turns the inspector off"`
+	PerBucket int      `env:"DEBUG_REQUESTS_PER_BUCKET" default:"5" desc:"Requests kept per route and latency bucket, so slow ones outlive the recent list"`
+	Events    int      `env:"DEBUG_REQUESTS_EVENTS" default:"64" desc:"Events kept per request"`
+	Exclude   []string `env:"DEBUG_REQUESTS_EXCLUDE" default:"/health,/ready,/metrics" desc:"Routes not recorded, such as probes"`
+}
+
+// Enabled reports whether requests are recorded for /debug/requests.
+func (c InspectConfig) Enabled() bool {
+	return c.Requests > 0
+}
+
+// DatabaseConfig is the service's PostgreSQL database.
+type DatabaseConfig struct {
+	URL      string `env:"DATABASE_URL" secret:"true" desc:"PostgreSQL connection string, e.g. postgres://app:pw@postgres:5432/app?sslmode=disable"`
+	MaxConns int    `env:"DATABASE_MAX_CONNS" default:"10" desc:"Open connections to the database at most"`
+}
+
+// Enabled reports whether a database is configured.
+func (c DatabaseConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// UsageConfig controls metering of public requests per consumer, for
+// billing, and the quotas enforced on it.
+type UsageConfig struct {
+	Consumer     string            `env:"USAGE_CONSUMER" desc:"What identifies a consumer (token, header:<name>); metering and quotas are off when empty"`
+	Names        map[string]string `env:"USAGE_CONSUMERS" secret:"true" desc:"Consumer names for bearer tokens, as name=token; other tokens are named by a hash"`
+	Bucket       time.Duration     `env:"USAGE_BUCKET" default:"1h" desc:"Length of the time buckets usage is aggregated in; must divide a day"`
+	Flush        time.Duration     `env:"USAGE_FLUSH_INTERVAL" default:"1m" desc:"How often usage is written to the database"`
+	DailyQuota   int64             `env:"USAGE_DAILY_QUOTA" default:"0" desc:"Requests per consumer per UTC day; 0 is unlimited"`
+	MonthlyQuota int64             `env:"USAGE_MONTHLY_QUOTA" default:"0" desc:"Requests per consumer per UTC month; 0 is unlimited"`
+	Quotas       map[string]string `env:"USAGE_QUOTAS" desc:"Quotas of single consumers, as name=daily/monthly, e.g. search=10000/250000; 0 is unlimited"`
+	MaxConsumers int               `env:"USAGE_MAX_CONSUMERS" default:"10000" desc:"Consumers tracked in memory in a month; further ones are metered together as other"`
+}
+
+// Enabled reports whether requests are metered per consumer.
+func (c UsageConfig) Enabled() bool {
+	return c.Consumer != ""
+}
+
+// Load reads the configuration from the process environment.
+func Load() (*Config, error) {
+	return LoadWith(nil)
+}
+
+// LoadWith reads the configuration from the process environment layered
+// over remote values, keyed by variable name. The environment wins, so a
+// single instance can still be overridden.
+func LoadWith(remote map[string]string) (*Config, error) {
+	cfg := &Config{}
+	lookup := func(key string) (string, bool) {
+		if v, ok := os.LookupEnv(key); ok {
+			return v, true
+		}
+		if _, ok := os.LookupEnv(key + "_FILE"); ok {
+			return "", false // resolved from the file
+		}
+		v, ok := remote[key]
+		return v, ok
+	}
+	if err := process(cfg, lookup); err != nil {
+		return nil, err
+	}
+	if cfg.Version == "" {
+		cfg.Version = buildVersion
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.OTLP.Enabled() {
+		if c.OTLP.Endpoint == "" {
+			return fmt.Errorf("config: OTLP_ENDPOINT is required when OTLP export is enabled")
+		}
+		if c.OTLP.Protocol != "grpc" && c.OTLP.Protocol != "http" {
+			return fmt.Errorf("config: OTLP_PROTOCOL must be grpc or http, got %q", c.OTLP.Protocol)
+		}
+		if c.OTLP.BatchSize <= 0 || c.OTLP.QueueSize < c.OTLP.BatchSize {
+			return fmt.Errorf("config: OTLP_QUEUE_SIZE must be at least OTLP_BATCH_SIZE")
+		}
+	}
+	if len(c.Wait.Targets) > 0 && (c.Wait.Backoff <= 0 || c.Wait.MaxBackoff < c.Wait.Backoff) {
+		return fmt.Errorf("config: WAIT_BACKOFF must be positive and at most WAIT_MAX_BACKOFF")
+	}
+	if c.Shadow.Enabled() && (c.Shadow.SampleRate > 1 || c.Shadow.Concurrency <= 0) {
+		return fmt.Errorf("config: SHADOW_SAMPLE_RATE must be in 0-1 and SHADOW_CONCURRENCY positive")
+	}
+	if c.RateLimit.Enabled() {
+		if c.RateLimit.Burst <= 0 {
+			return fmt.Errorf("config: RATE_LIMIT_BURST must be positive")
+		}
+		if k := c.RateLimit.Key; k != "ip" && k != "token" && !strings.HasPrefix(k, "header:") {
+			return fmt.Errorf("config: RATE_LIMIT_KEY must be ip, token or header:<name>, got %q", k)
+		}
+		if c.RateLimit.Key == "token" && !c.Auth.Enabled() {
+			return fmt.Errorf("config: RATE_LIMIT_KEY=token needs API_TOKENS, or any made-up token gets a burst of its own")
+		}
+	}
+	if c.Capture.Header != "" && !c.Auth.Enabled() {
+		return fmt.Errorf("config: CAPTURE_HEADER needs API_TOKENS, so only authenticated clients can ask for captures")
+	}
+	if c.Usage.Enabled() {
+		if c.Usage.Bucket <= 0 || 24*time.Hour%c.Usage.Bucket != 0 {
+			return fmt.Errorf("config: USAGE_BUCKET must divide a day, got %s", c.Usage.Bucket)
+		}
+		if c.Usage.Flush <= 0 {
+			return fmt.Errorf("config: USAGE_FLUSH_INTERVAL must be positive")
+		}
+		if c.Usage.MaxConsumers <= 0 {
+			return fmt.Errorf("config: USAGE_MAX_CONSUMERS must be positive")
+		}
+		if k := c.Usage.Consumer; k != "token" && !strings.HasPrefix(k, "header:") {
+			return fmt.Errorf("config: USAGE_CONSUMER must be token or header:<name>, got %q", k)
+		}
+		quotas := c.Usage.DailyQuota > 0 || c.Usage.MonthlyQuota > 0 || len(c.Usage.Quotas) > 0
+		if quotas && !c.Auth.Enabled() {
+			return fmt.Errorf("config: usage quotas need API_TOKENS, or a client escapes its quota by sending another token or header")
+		}
+	}
+	for _, e := range c.Diagnostics.Endpoints {
+		switch e {
+		case "echo", "resolve", "dial", "interfaces":
+		default:
+			return fmt.Errorf("config: DIAGNOSTICS entries must be echo, resolve, dial or interfaces, got %q", e)
+		}
+	}
+	switch c.Secrets.Provider {
+	case "file", "env":
+	case "vault":
+		v := c.Secrets.Vault
+		if v.Addr == "" || (v.Token == "" && (v.RoleID == "" || v.SecretID == "")) {
+			return fmt.Errorf("config: the vault secrets provider needs VAULT_ADDR and VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID")
+		}
+		if v.KVVersion != 1 && v.KVVersion != 2 {
+			return fmt.Errorf("config: VAULT_KV_VERSION must be 1 or 2, got %d", v.KVVersion)
+		}
+		if v.DBCreds != "" {
+			if u, err := url.Parse(c.Database.URL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+				return fmt.Errorf("config: VAULT_DB_CREDS needs DATABASE_URL as a postgres:// URL of the database to connect to")
+			}
+		}
+	default:
+		return fmt.Errorf("config: SECRETS_PROVIDER must be file, env or vault, got %q", c.Secrets.Provider)
+	}
+	switch c.Upstreams.Balancer {
+	case "round_robin", "least_requests", "p2c":
+	default:
+		return fmt.Errorf("config: UPSTREAM_BALANCER must be round_robin, least_requests or p2c, got %q", c.Upstreams.Balancer)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lookupFunc matches os.LookupEnv so the loader can be fed from any source.
+type lookupFunc func(key string) (string, bool)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// process fills the struct pointed to by dst from lookup. Fields are
+// described with `env:"NAME"` and an optional `default:"value"` tag.
+// Nested structs without an env tag are processed recursively.
+//
+// Any variable can also be supplied as NAME_FILE pointing at a file whose
+// contents are used as the value, which is how Docker and Kubernetes
+// secrets are mounted (/run/secrets/...).
+func process(dst any, lookup lookupFunc) error {
+	return walk(reflect.ValueOf(dst).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		name := f.Tag.Get("env")
+		raw, ok, err := resolve(name, lookup)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			raw, ok = f.Tag.Lookup("default")
+		}
+		if !ok {
+			return nil
+		}
+		if err := set(v, raw); err != nil {
+			return fmt.Errorf("config: %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// walk calls fn for every env-tagged field below v.
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		if _, ok := f.Tag.Lookup("env"); !ok {
+			if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+				if err := walk(fv, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := fn(f, fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolve(name string, lookup lookupFunc) (string, bool, error) {
+	if raw, ok := lookup(name); ok {
+		return raw, true, nil
+	}
+	path, ok := lookup(name + "_FILE")
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("config: %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), true, nil
+}
+
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		if raw == "" {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if raw == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		if raw == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(splitList(raw)))
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		m, err := splitPairs(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// splitList parses "a, b,c" into [a b c].
+func splitList(raw string) []string {
+	var out []string
+	for _, s := range strings.Split(raw, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// splitPairs parses "k1=v1,k2=v2" into a map.
+func splitPairs(raw string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, s := range splitList(raw) {
+		k, val, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", s)
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+	}
+	return m, nil
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Var describes one environment variable understood by the service.
+type Var struct {
+	Name        string
+	Default     string // formatted like Value, so the two compare equal
+	Description string
+	Secret      bool
+	Value       string // the value in the Config passed to Vars
+}
+
+// Vars lists every variable in declaration order together with its value
+// in cfg. Generators (manifests, compose files) use it so their output
+// always matches what the binary actually reads.
+func Vars(cfg *Config) []Var {
+	var out []Var
+	walk(reflect.ValueOf(cfg).Elem(), func(f reflect.StructField, v reflect.Value) error {
+		out = append(out, Var{
+			Name:        f.Tag.Get("env"),
+			Default:     normalize(f, v.Type()),
+			Description: f.Tag.Get("desc"),
+			Secret:      f.Tag.Get("secret") == "true",
+			Value:       format(v),
+		})
+		return nil
+	})
+	return out
+}
+
+// normalize formats the default of f the way format renders values, e.g.
+// "5m" becomes "5m0s".
+func normalize(f reflect.StructField, t reflect.Type) string {
+	def := f.Tag.Get("default")
+	zero := reflect.New(t).Elem()
+	if set(zero, def) != nil {
+		return def
+	}
+	return format(zero)
+}
+
+// format is the inverse of set.
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	case reflect.Map:
+		m := v.Interface().(map[string]string)
+		pairs := make([]string, 0, len(m))
+		for k, val := range m {
+			pairs = append(pairs, k+"="+val)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	}
+	return ""
+}
+
+// Change is a variable whose value differs between two configurations.
+// Values of secret variables are redacted.
+type Change struct {
+	Name   string `json:"name"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+// Diff lists the variables whose values differ between a and b, in
+// declaration order.
+func Diff(a, b *Config) []Change {
+	before, after := Vars(a), Vars(b)
+	var out []Change
+	for i, v := range before {
+		if v.Value == after[i].Value {
+			continue
+		}
+		c := Change{Name: v.Name, Old: v.Value, New: after[i].Value, Secret: v.Secret}
+		if c.Secret {
+			c.Old, c.New = "(redacted)", "(redacted)"
+		}
+		out = append(out, c)
+	}
+	return out
+}
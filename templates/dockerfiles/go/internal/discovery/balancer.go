@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer picks instances of one upstream and tracks their load and
+// failures. Instances failing EjectFailures times in a row are ejected for
+// a growing period (passive health checking); if every instance is ejected
+// the balancer ignores ejections rather than failing all requests.
+type Balancer struct {
+	policy        string
+	ejectFailures int
+	ejectBase     time.Duration
+	ejectMax      time.Duration
+	onEject       func(Instance)
+
+	next atomic.Uint64
+
+	mu    sync.Mutex
+	stats map[string]*endpoint
+}
+
+// endpoint is the balancer's view of one instance.
+type endpoint struct {
+	inFlight atomic.Int64
+
+	// guarded by Balancer.mu
+	failures     int
+	ejections    int
+	ejectedUntil time.Time
+}
+
+// EndpointStatus is reported by the admin API.
+type EndpointStatus struct {
+	Instance
+	InFlight     int64      `json:"in_flight"`
+	Failures     int        `json:"consecutive_failures"`
+	Ejections    int        `json:"ejections"`
+	EjectedUntil *time.Time `json:"ejected_until,omitempty"`
+}
+
+func newBalancer(policy string, ejectFailures int, ejectBase, ejectMax time.Duration, onEject func(Instance)) *Balancer {
+	return &Balancer{
+		policy:        policy,
+		ejectFailures: ejectFailures,
+		ejectBase:     ejectBase,
+		ejectMax:      ejectMax,
+		onEject:       onEject,
+		stats:         map[string]*endpoint{},
+	}
+}
+
+// Pick chooses an instance and marks a request in flight on it. Call the
+// returned done with whether the request failed.
+func (b *Balancer) Pick(instances []Instance) (Instance, func(failed bool)) {
+	candidates, eps := b.available(instances)
+
+	var i int
+	switch {
+	case len(candidates) == 1:
+	case b.policy == "least_requests":
+		// Start at a rotating offset so ties do not always favour the
+		// first instance.
+		start := int(b.next.Add(1) % uint64(len(candidates)))
+		i = start
+		for j := range candidates {
+			k := (start + j) % len(candidates)
+			if eps[k].inFlight.Load() < eps[i].inFlight.Load() {
+				i = k
+			}
+		}
+	case b.policy == "p2c":
+		a := rand.Intn(len(candidates))
+		c := rand.Intn(len(candidates) - 1)
+		if c >= a {
+			c++
+		}
+		i = a
+		if eps[c].inFlight.Load() < eps[a].inFlight.Load() {
+			i = c
+		}
+	default: // round_robin
+		i = int(b.next.Add(1) % uint64(len(candidates)))
+	}
+
+	inst, ep := candidates[i], eps[i]
+	ep.inFlight.Add(1)
+	return inst, func(failed bool) {
+		ep.inFlight.Add(-1)
+		b.record(inst, ep, failed)
+	}
+}
+
+// available returns the instances that are not ejected, or all of them if
+// every instance is ejected, together with their endpoints.
+func (b *Balancer) available(instances []Instance) ([]Instance, []*endpoint) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	candidates := make([]Instance, 0, len(instances))
+	eps := make([]*endpoint, 0, len(instances))
+	all := make([]*endpoint, len(instances))
+	for i, inst := range instances {
+		ep := b.stats[inst.HostPort()]
+		if ep == nil {
+			ep = &endpoint{}
+			b.stats[inst.HostPort()] = ep
+		}
+		all[i] = ep
+		if now.Before(ep.ejectedUntil) {
+			continue
+		}
+		candidates = append(candidates, inst)
+		eps = append(eps, ep)
+	}
+	if len(candidates) == 0 {
+		return instances, all
+	}
+	return candidates, eps
+}
+
+func (b *Balancer) record(inst Instance, ep *endpoint, failed bool) {
+	b.mu.Lock()
+	if !failed {
+		ep.failures = 0
+		b.mu.Unlock()
+		return
+	}
+	ep.failures++
+	eject := b.ejectFailures > 0 && ep.failures >= b.ejectFailures && !time.Now().Before(ep.ejectedUntil)
+	if eject {
+		ep.failures = 0
+		ep.ejections++
+		d := min(b.ejectBase*time.Duration(ep.ejections), b.ejectMax)
+		ep.ejectedUntil = time.Now().Add(d)
+	}
+	b.mu.Unlock()
+
+	if eject && b.onEject != nil {
+		b.onEject(inst)
+	}
+}
+
+// Status reports the balancer state of the given instances.
+func (b *Balancer) Status(instances []Instance) []EndpointStatus {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]EndpointStatus, 0, len(instances))
+	for _, inst := range instances {
+		st := EndpointStatus{Instance: inst}
+		if ep := b.stats[inst.HostPort()]; ep != nil {
+			st.InFlight = ep.inFlight.Load()
+			st.Failures = ep.failures
+			st.Ejections = ep.ejections
+			if now.Before(ep.ejectedUntil) {
+				until := ep.ejectedUntil
+				st.EjectedUntil = &until
+			}
+		}
+		out = append(out, st)
+	}
+	return out
+}
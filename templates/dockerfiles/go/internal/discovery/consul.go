@@ -0,0 +1,159 @@
+// Package discovery registers the instance with a Consul-compatible agent
+// and resolves upstream services through the same registry.
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// errNotFound is returned for 404 responses of the agent API.
+var errNotFound = errors.New("not found")
+
+// consul is a minimal client for the parts of the agent HTTP API that
+// registration and resolution need.
+type consul struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func newConsul(cfg config.DiscoveryConfig) *consul {
+	base := cfg.Addr
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return &consul{
+		base:  strings.TrimRight(base, "/"),
+		token: cfg.Token,
+		http:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// service is the body of PUT /v1/agent/service/register.
+type service struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   *check            `json:"Check,omitempty"`
+}
+
+type check struct {
+	HTTP                           string `json:"HTTP"`
+	Method                         string `json:"Method"`
+	Interval                       string `json:"Interval"`
+	Timeout                        string `json:"Timeout"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+// serviceEntry is one element of GET /v1/health/service/:name.
+type serviceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string            `json:"ID"`
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Tags    []string          `json:"Tags"`
+		Meta    map[string]string `json:"Meta"`
+	} `json:"Service"`
+}
+
+func (c *consul) register(ctx context.Context, svc service) error {
+	return c.do(ctx, http.MethodPut, "/v1/agent/service/register", svc, nil)
+}
+
+func (c *consul) deregister(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(id), nil, nil)
+}
+
+// registered reports whether the local agent still knows the service, e.g.
+// after an agent restart without persisted state.
+func (c *consul) registered(ctx context.Context, id string) (bool, error) {
+	err := c.do(ctx, http.MethodGet, "/v1/agent/service/"+url.PathEscape(id), nil, nil)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// healthy returns the instances of name whose checks are all passing,
+// optionally filtered by tag.
+func (c *consul) healthy(ctx context.Context, name, tag string) ([]Instance, error) {
+	q := url.Values{"passing": {"true"}}
+	if tag != "" {
+		q.Set("tag", tag)
+	}
+	var entries []serviceEntry
+	if err := c.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(name)+"?"+q.Encode(), nil, &entries); err != nil {
+		return nil, err
+	}
+	out := make([]Instance, 0, len(entries))
+	for _, e := range entries {
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		out = append(out, Instance{
+			ID:      e.Service.ID,
+			Address: addr,
+			Port:    e.Service.Port,
+			Tags:    e.Service.Tags,
+			Meta:    e.Service.Meta,
+		})
+	}
+	return out, nil
+}
+
+func (c *consul) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(io.Discard, resp.Body)
+		return errNotFound
+	case resp.StatusCode/100 != 2:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("consul: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	case out != nil:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
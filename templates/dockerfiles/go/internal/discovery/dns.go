@@ -0,0 +1,151 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSResolver resolves A/AAAA and SRV records, as served by Docker's
+// embedded DNS on custom networks or by Consul and CoreDNS. Names are
+// resolved once on first use and then refreshed in the background by Run,
+// so requests never wait on DNS after warm-up. A failed refresh keeps the
+// last known instances.
+//
+// Names are "host:port" for address records and "_service._proto.name" for
+// SRV records.
+type DNSResolver struct {
+	net     *net.Resolver
+	refresh time.Duration
+
+	mu    sync.Mutex
+	names map[string][]Instance
+}
+
+// NewDNSResolver uses server (host:port) for queries, or the system
+// resolver when server is empty.
+func NewDNSResolver(server string, refresh time.Duration) *DNSResolver {
+	r := &DNSResolver{net: net.DefaultResolver, refresh: refresh, names: map[string][]Instance{}}
+	if server != "" {
+		d := net.Dialer{Timeout: 2 * time.Second}
+		r.net = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return r
+}
+
+// Resolve implements Resolver; tags do not apply to DNS and must be empty.
+func (r *DNSResolver) Resolve(ctx context.Context, name, tag string) ([]Instance, error) {
+	if tag != "" {
+		return nil, fmt.Errorf("dns: tags are not supported (%s.%s)", tag, name)
+	}
+	r.mu.Lock()
+	instances, ok := r.names[name]
+	r.mu.Unlock()
+	if ok {
+		return instances, nil
+	}
+
+	instances, err := r.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.names[name] = instances
+	r.mu.Unlock()
+	return instances, nil
+}
+
+// Run refreshes every name resolved so far until ctx ends.
+func (r *DNSResolver) Run(ctx context.Context) {
+	t := time.NewTicker(r.refresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		r.mu.Lock()
+		names := make([]string, 0, len(r.names))
+		for name := range r.names {
+			names = append(names, name)
+		}
+		r.mu.Unlock()
+
+		for _, name := range names {
+			lctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			instances, err := r.lookup(lctx, name)
+			cancel()
+			if err != nil {
+				slog.Warn("dns refresh failed, keeping last known instances", "name", name, "err", err)
+				continue
+			}
+			r.mu.Lock()
+			r.names[name] = instances
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *DNSResolver) lookup(ctx context.Context, name string) ([]Instance, error) {
+	if strings.HasPrefix(name, "_") {
+		return r.lookupSRV(ctx, name)
+	}
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, fmt.Errorf("dns: %q: want host:port or an SRV name", name)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("dns: %q: invalid port", name)
+	}
+	addrs, err := r.net.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Instance, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, Instance{Address: a.IP.String(), Port: p})
+	}
+	return out, nil
+}
+
+// lookupSRV returns the targets of the lowest priority present, as SRV
+// clients should only fall back to higher priorities when those are gone.
+func (r *DNSResolver) lookupSRV(ctx context.Context, name string) ([]Instance, error) {
+	_, records, err := r.net.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	var out []Instance
+	for _, srv := range records {
+		if srv.Priority != records[0].Priority {
+			break
+		}
+		target := strings.TrimSuffix(srv.Target, ".")
+		addrs, err := r.net.LookupIPAddr(ctx, target)
+		if err != nil {
+			return nil, fmt.Errorf("dns: resolve SRV target %s: %w", target, err)
+		}
+		for _, a := range addrs {
+			out = append(out, Instance{
+				ID:      target,
+				Address: a.IP.String(),
+				Port:    int(srv.Port),
+				Meta:    map[string]string{"weight": strconv.Itoa(int(srv.Weight))},
+			})
+		}
+	}
+	return out, nil
+}
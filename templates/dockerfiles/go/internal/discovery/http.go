@@ -0,0 +1,60 @@
+package discovery
+
+import (
+	"net/http"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+// Registration is the status reported by GET /discovery.
+type Registration struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Address    string   `json:"address"`
+	Port       int      `json:"port"`
+	Tags       []string `json:"tags,omitempty"`
+	Check      string   `json:"check"`
+	Registered bool     `json:"registered"`
+}
+
+// RegisterAdmin adds the registration status to the admin router:
+//
+//	GET /discovery  what this instance registers and whether it is registered
+func (r *Registrar) RegisterAdmin(router *mux.Router) {
+	router.HandleFunc("/discovery", func(w http.ResponseWriter, req *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, Registration{
+			ID:         r.svc.ID,
+			Name:       r.svc.Name,
+			Address:    r.svc.Address,
+			Port:       r.svc.Port,
+			Tags:       r.svc.Tags,
+			Check:      r.svc.Check.HTTP,
+			Registered: r.registered.Load(),
+		})
+	}).Methods(http.MethodGet)
+}
+
+// RegisterAdmin adds upstream lookups to the admin router:
+//
+//	GET /discovery/{service}?tag=  healthy instances as the client sees them
+func (r *ConsulResolver) RegisterAdmin(router *mux.Router) {
+	router.HandleFunc("/discovery/{service}", func(w http.ResponseWriter, req *http.Request) {
+		instances, err := r.Resolve(req.Context(), mux.Vars(req)["service"], req.URL.Query().Get("tag"))
+		if err != nil {
+			problem.Write(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, instances)
+	}).Methods(http.MethodGet)
+}
+
+// RegisterAdmin adds the upstream status to the admin router:
+//
+//	GET /upstreams  configured upstreams, their instances and balancer state
+func (u *Upstreams) RegisterAdmin(router *mux.Router) {
+	router.HandleFunc("/upstreams", func(w http.ResponseWriter, req *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, u.Status(req.Context()))
+	}).Methods(http.MethodGet)
+}
@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Registrar keeps the instance registered with the agent while the process
+// runs. The agent's HTTP check against the readiness endpoint takes the
+// instance out of rotation during maintenance and drain.
+type Registrar struct {
+	client  *consul
+	svc     service
+	recheck time.Duration // how often an existing registration is verified
+	gauge   *telemetry.Gauge
+
+	registered atomic.Bool
+}
+
+func NewRegistrar(cfg *config.Config, reg *telemetry.Registry) (*Registrar, error) {
+	d := cfg.Discovery
+	port, err := strconv.Atoi(cfg.Port)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: invalid PORT %q", cfg.Port)
+	}
+	addr := d.Address
+	if addr == "" {
+		if addr, err = privateAddress(); err != nil {
+			return nil, fmt.Errorf("discovery: %w; set CONSUL_SERVICE_ADDRESS", err)
+		}
+	}
+	host, _ := os.Hostname()
+
+	meta := map[string]string{}
+	for k, v := range d.Meta {
+		meta[k] = v
+	}
+	meta["version"] = cfg.Version
+	meta["environment"] = cfg.Environment
+
+	r := &Registrar{
+		client: newConsul(d),
+		svc: service{
+			ID:      fmt.Sprintf("%s-%s-%d", cfg.ServiceName, host, port),
+			Name:    cfg.ServiceName,
+			Tags:    d.Tags,
+			Address: addr,
+			Port:    port,
+			Meta:    meta,
+			Check: &check{
+				HTTP:                           "http://" + net.JoinHostPort(addr, cfg.Port) + d.CheckPath,
+				Method:                         "GET",
+				Interval:                       d.CheckInterval.String(),
+				Timeout:                        d.CheckTimeout.String(),
+				DeregisterCriticalServiceAfter: d.DeregisterAfter.String(),
+			},
+		},
+		recheck: 3 * max(d.CheckInterval, time.Second),
+		gauge:   reg.Gauge("discovery_registered", "1 while the instance is registered with the service registry."),
+	}
+	r.gauge.Set(0)
+	return r, nil
+}
+
+// ID is the service ID the instance registers under.
+func (r *Registrar) ID() string { return r.svc.ID }
+
+// Run registers the instance, retrying with backoff while the agent is
+// unreachable, and re-registers if the agent forgets it. It returns when ctx
+// ends; call Deregister afterwards.
+func (r *Registrar) Run(ctx context.Context) {
+	backoff := time.Second
+	registered := false
+	for {
+		var err error
+		if registered {
+			registered, err = r.client.registered(ctx, r.svc.ID)
+			if err == nil && !registered {
+				slog.Warn("service registration lost, registering again", "id", r.svc.ID)
+			}
+		}
+		if err == nil && !registered {
+			if err = r.client.register(ctx, r.svc); err == nil {
+				registered = true
+				slog.Info("registered with service registry", "id", r.svc.ID, "address", r.svc.Address, "port", r.svc.Port)
+			}
+		}
+
+		wait := r.recheck
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("service registration failed", "id", r.svc.ID, "err", err, "retry_in", backoff)
+			wait = backoff
+			backoff = min(backoff*2, 30*time.Second)
+		} else {
+			backoff = time.Second
+		}
+		r.setRegistered(registered)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Deregister removes the instance from the registry. Call it first during
+// shutdown so clients stop resolving the instance before it closes.
+func (r *Registrar) Deregister(ctx context.Context) error {
+	r.setRegistered(false)
+	if err := r.client.deregister(ctx, r.svc.ID); err != nil {
+		return err
+	}
+	slog.Info("deregistered from service registry", "id", r.svc.ID)
+	return nil
+}
+
+func (r *Registrar) setRegistered(on bool) {
+	r.registered.Store(on)
+	if on {
+		r.gauge.Set(1)
+	} else {
+		r.gauge.Set(0)
+	}
+}
+
+// privateAddress returns the first non-loopback IPv4 interface address,
+// which is what other hosts reach the container on.
+func privateAddress() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no non-loopback IPv4 address found")
+}
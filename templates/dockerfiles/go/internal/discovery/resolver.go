@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// Instance is one resolved upstream endpoint.
+type Instance struct {
+	ID      string            `json:"id,omitempty"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// HostPort returns the instance address in host:port form.
+func (i Instance) HostPort() string {
+	return net.JoinHostPort(i.Address, strconv.Itoa(i.Port))
+}
+
+// Resolver finds the healthy instances of a service. The tag may be empty.
+type Resolver interface {
+	Resolve(ctx context.Context, service, tag string) ([]Instance, error)
+}
+
+// ConsulResolver resolves services through the agent's health endpoint.
+// Results are cached for CONSUL_RESOLVE_TTL; when the agent is unreachable
+// the last known instances are served instead of failing.
+type ConsulResolver struct {
+	client *consul
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	instances []Instance
+	fetched   time.Time
+}
+
+func NewConsulResolver(cfg config.DiscoveryConfig) *ConsulResolver {
+	return &ConsulResolver{client: newConsul(cfg), ttl: cfg.ResolveTTL, cache: map[string]cached{}}
+}
+
+func (r *ConsulResolver) Resolve(ctx context.Context, service, tag string) ([]Instance, error) {
+	key := service + "\x00" + tag
+	r.mu.Lock()
+	c, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Since(c.fetched) < r.ttl {
+		return c.instances, nil
+	}
+
+	instances, err := r.client.healthy(ctx, service, tag)
+	if err != nil {
+		if ok {
+			slog.Warn("service resolution failed, using cached instances", "service", service, "err", err)
+			return c.instances, nil
+		}
+		return nil, err
+	}
+	r.mu.Lock()
+	r.cache[key] = cached{instances: instances, fetched: time.Now()}
+	r.mu.Unlock()
+	return instances, nil
+}
@@ -0,0 +1,227 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// ConsulDomain is the pseudo top-level domain resolved through the Consul
+// registry without configuration, following Consul DNS:
+// [tag.]service.service.consul.
+const ConsulDomain = ".service.consul"
+
+// Upstreams is an http.RoundTripper for calling sibling services. Requests
+// whose host names a configured upstream (UPSTREAMS) or ends in
+// .service.consul are sent to an instance picked by the upstream's
+// balancer; all other requests pass through to the base transport.
+type Upstreams struct {
+	cfg    config.UpstreamsConfig
+	base   http.RoundTripper
+	dns    *DNSResolver
+	consul Resolver // nil when discovery is disabled
+	routes map[string]route
+
+	requests  *telemetry.Counter
+	ejections *telemetry.Counter
+
+	mu        sync.Mutex
+	balancers map[string]*Balancer
+}
+
+// route maps a request host to a resolver name.
+type route struct {
+	resolver Resolver
+	name     string
+	tag      string
+	target   string
+}
+
+func NewUpstreams(cfg *config.Config, reg *telemetry.Registry) (*Upstreams, error) {
+	u := &Upstreams{
+		cfg:       cfg.Upstreams,
+		base:      http.DefaultTransport,
+		dns:       NewDNSResolver(cfg.Upstreams.DNSServer, cfg.Upstreams.DNSRefresh),
+		routes:    map[string]route{},
+		balancers: map[string]*Balancer{},
+		requests:  reg.Counter("upstream_requests_total", "Outbound requests to upstreams by outcome.", "upstream", "outcome"),
+		ejections: reg.Counter("upstream_ejections_total", "Instances ejected after consecutive failures.", "upstream"),
+	}
+	if cfg.Discovery.Enabled() {
+		u.consul = NewConsulResolver(cfg.Discovery)
+	}
+
+	for host, target := range cfg.Upstreams.Targets {
+		kind, name, _ := strings.Cut(target, ":")
+		rt := route{name: name, target: target}
+		switch kind {
+		case "dns", "srv":
+			rt.resolver = u.dns
+			if (kind == "srv") != strings.HasPrefix(name, "_") {
+				return nil, fmt.Errorf("discovery: upstream %s: srv targets are _service._proto.name, dns targets host:port", host)
+			}
+		case "consul":
+			if u.consul == nil {
+				return nil, fmt.Errorf("discovery: upstream %s needs CONSUL_HTTP_ADDR", host)
+			}
+			rt.resolver = u.consul
+			rt.name, rt.tag = splitName(name)
+		default:
+			return nil, fmt.Errorf("discovery: upstream %s: unknown target %q", host, target)
+		}
+		u.routes[host] = rt
+	}
+	return u, nil
+}
+
+// Run refreshes DNS targets until ctx ends.
+func (u *Upstreams) Run(ctx context.Context) {
+	u.dns.Run(ctx)
+}
+
+// Client returns an HTTP client using u as its transport.
+func (u *Upstreams) Client() *http.Client {
+	return &http.Client{Transport: u, Timeout: 30 * time.Second}
+}
+
+func (u *Upstreams) route(host string) (route, bool) {
+	if rt, ok := u.routes[host]; ok {
+		return rt, true
+	}
+	if u.consul != nil && strings.HasSuffix(host, ConsulDomain) {
+		name, tag := splitName(strings.TrimSuffix(host, ConsulDomain))
+		return route{resolver: u.consul, name: name, tag: tag, target: "consul:" + name}, true
+	}
+	return route{}, false
+}
+
+func (u *Upstreams) balancer(host string) *Balancer {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	b := u.balancers[host]
+	if b == nil {
+		c := u.cfg
+		b = newBalancer(c.Balancer, c.EjectFailures, c.EjectDuration, c.MaxEjectDuration, func(inst Instance) {
+			u.ejections.Inc(host)
+			slog.Warn("upstream instance ejected", "upstream", host, "instance", inst.HostPort())
+		})
+		u.balancers[host] = b
+	}
+	return b
+}
+
+func (u *Upstreams) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	rt, ok := u.route(host)
+	if !ok {
+		return u.base.RoundTrip(req)
+	}
+
+	instances, err := rt.resolver.Resolve(req.Context(), rt.name, rt.tag)
+	if err != nil {
+		u.requests.Inc(host, "unresolved")
+		return nil, fmt.Errorf("discovery: resolve %s: %w", host, err)
+	}
+	if len(instances) == 0 {
+		u.requests.Inc(host, "unresolved")
+		return nil, fmt.Errorf("discovery: no instances of %s", host)
+	}
+	inst, done := u.balancer(host).Pick(instances)
+
+	// The upstream still sees the name it was called by.
+	out := req.Clone(req.Context())
+	out.URL.Host = inst.HostPort()
+	if out.Host == "" {
+		out.Host = req.URL.Host
+	}
+
+	resp, err := u.base.RoundTrip(out)
+	if err != nil {
+		done(true)
+		u.requests.Inc(host, "error")
+		return nil, err
+	}
+	failed := resp.StatusCode >= 500
+	if failed {
+		u.requests.Inc(host, "5xx")
+	} else {
+		u.requests.Inc(host, "success")
+	}
+	// The request stays in flight for least_requests and p2c until the
+	// body has been consumed.
+	body := &doneBody{ReadCloser: resp.Body, done: func() { done(failed) }}
+	if w, ok := resp.Body.(io.Writer); ok {
+		// A 101 Switching Protocols body is also the connection's writer.
+		resp.Body = doneRWBody{body, w}
+	} else {
+		resp.Body = body
+	}
+	return resp, nil
+}
+
+type doneBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *doneBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+type doneRWBody struct {
+	*doneBody
+	io.Writer
+}
+
+// UpstreamStatus is reported by GET /upstreams.
+type UpstreamStatus struct {
+	Name      string           `json:"name"`
+	Target    string           `json:"target"`
+	Balancer  string           `json:"balancer"`
+	Instances []EndpointStatus `json:"instances"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// Status resolves every configured upstream and reports its instances
+// with their balancer state.
+func (u *Upstreams) Status(ctx context.Context) []UpstreamStatus {
+	hosts := make([]string, 0, len(u.routes))
+	for host := range u.routes {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	out := make([]UpstreamStatus, 0, len(hosts))
+	for _, host := range hosts {
+		rt := u.routes[host]
+		st := UpstreamStatus{Name: host, Target: rt.target, Balancer: u.cfg.Balancer, Instances: []EndpointStatus{}}
+		instances, err := rt.resolver.Resolve(ctx, rt.name, rt.tag)
+		if err != nil {
+			st.Error = err.Error()
+		} else {
+			st.Instances = u.balancer(host).Status(instances)
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// splitName splits "tag.service" into its parts; a plain name has no tag.
+func splitName(name string) (service, tag string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:], name[:i]
+	}
+	return name, ""
+}
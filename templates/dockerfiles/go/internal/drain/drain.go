@@ -0,0 +1,130 @@
+// Package drain takes an instance out of rotation ahead of shutdown.
+//
+// A drain marks the instance not-ready, waits DRAIN_DELAY for load balancers
+// and endpoint controllers to stop sending new requests, then waits for
+// in-flight requests to finish. Run from a preStop hook it lets SIGTERM
+// arrive at an idle process, so deploys cause no 5xx.
+package drain
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// ErrDraining is reported by the readiness check once draining started.
+var ErrDraining = errors.New("draining")
+
+type Drainer struct {
+	cfg      config.DrainConfig
+	inFlight atomic.Int64
+	gauge    *telemetry.Gauge
+
+	mu       sync.Mutex
+	draining bool
+	started  time.Time
+	done     chan struct{} // closed when the current drain has finished
+}
+
+// Result reports the outcome of a drain.
+type Result struct {
+	Draining bool       `json:"draining"`
+	Started  *time.Time `json:"started,omitempty"`
+	Waited   string     `json:"waited,omitempty"`
+	InFlight int64      `json:"in_flight"`
+	Idle     bool       `json:"idle"`
+}
+
+func New(cfg config.DrainConfig, reg *telemetry.Registry) *Drainer {
+	d := &Drainer{cfg: cfg, gauge: reg.Gauge("draining", "1 while the instance is draining.")}
+	d.gauge.Set(0)
+	return d
+}
+
+// Middleware counts in-flight requests. Install it on the public routes;
+// probes and scrapes should not hold a drain open.
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.inFlight.Add(1)
+		defer d.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReadinessCheck fails once draining has started.
+func (d *Drainer) ReadinessCheck() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return ErrDraining
+	}
+	return nil
+}
+
+// Drain runs the drain sequence and blocks until the instance is idle, the
+// drain timeout passes or ctx ends. Concurrent calls wait on the same drain.
+func (d *Drainer) Drain(ctx context.Context) Result {
+	d.mu.Lock()
+	if !d.draining {
+		d.draining = true
+		d.started = time.Now()
+		d.done = make(chan struct{})
+		d.gauge.Set(1)
+		slog.Warn("draining started", "delay", d.cfg.Delay, "in_flight", d.inFlight.Load())
+		go d.run(d.done)
+	}
+	done := d.done
+	d.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return d.Status()
+}
+
+func (d *Drainer) run(done chan struct{}) {
+	defer close(done)
+
+	// Keep serving normally while the load balancer catches up.
+	time.Sleep(d.cfg.Delay)
+
+	deadline := time.Now().Add(d.cfg.Timeout)
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+	for d.inFlight.Load() > 0 && time.Now().Before(deadline) {
+		<-t.C
+	}
+	slog.Warn("draining finished", "in_flight", d.inFlight.Load(), "waited", time.Since(d.started).Round(time.Millisecond))
+}
+
+// Cancel puts the instance back into rotation, e.g. after an aborted deploy.
+func (d *Drainer) Cancel() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		d.draining = false
+		d.gauge.Set(0)
+		slog.Warn("draining cancelled")
+	}
+}
+
+func (d *Drainer) Status() Result {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res := Result{Draining: d.draining, InFlight: d.inFlight.Load()}
+	res.Idle = res.InFlight == 0
+	if d.draining {
+		started := d.started
+		res.Started = &started
+		res.Waited = time.Since(d.started).Round(time.Millisecond).String()
+	}
+	return res
+}
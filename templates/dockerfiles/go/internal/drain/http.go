@@ -0,0 +1,49 @@
+package drain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/example/app/internal/admin"
+	"github.com/gorilla/mux"
+)
+
+// RegisterAdmin adds the drain endpoints to the admin router:
+//
+//	POST   /drain  start draining and block until idle or timed out
+//	GET    /drain  current status
+//	DELETE /drain  cancel draining
+func (d *Drainer) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, d.Drain(r.Context()))
+	}).Methods(http.MethodPost)
+	r.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, d.Status())
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		d.Cancel()
+		admin.WriteJSON(w, http.StatusOK, d.Status())
+	}).Methods(http.MethodDelete)
+}
+
+// Request asks the instance listening on adminURL to drain. It backs the
+// `drain` subcommand, which preStop hooks can exec in images without curl.
+func Request(ctx context.Context, adminURL, token string) (Result, error) {
+	var res Result
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, adminURL+"/drain", nil)
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("drain: admin API returned %s", resp.Status)
+	}
+	return res, json.NewDecoder(resp.Body).Decode(&res)
+}
@@ -0,0 +1,143 @@
+package errreport
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Breadcrumb is a log record leading up to an error.
+type Breadcrumb struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Type      string         `json:"type"`
+	Category  string         `json:"category"`
+	Level     string         `json:"level"`
+	Message   string         `json:"message"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// Trail is a fixed-size ring of the most recent breadcrumbs. Storage grows
+// on demand so that per-request trails stay cheap.
+type Trail struct {
+	mu    sync.Mutex
+	size  int
+	items []Breadcrumb
+	next  int
+}
+
+func NewTrail(size int) *Trail {
+	return &Trail{size: max(size, 1)}
+}
+
+func (t *Trail) Add(b Breadcrumb) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.items) < t.size {
+		t.items = append(t.items, b)
+		return
+	}
+	t.items[t.next] = b
+	t.next = (t.next + 1) % t.size
+}
+
+// Snapshot returns the breadcrumbs oldest first.
+func (t *Trail) Snapshot() []Breadcrumb {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Breadcrumb, 0, len(t.items))
+	out = append(out, t.items[t.next:]...)
+	return append(out, t.items[:t.next]...)
+}
+
+// BreadcrumbHandler records every log record as a breadcrumb before passing
+// it on. Records logged with a request context land in that request's
+// trail; everything else goes to the process-wide trail.
+type BreadcrumbHandler struct {
+	next   slog.Handler
+	global *Trail
+	attrs  map[string]any
+	prefix string
+}
+
+func NewBreadcrumbHandler(next slog.Handler, global *Trail) *BreadcrumbHandler {
+	return &BreadcrumbHandler{next: next, global: global}
+}
+
+func (h *BreadcrumbHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *BreadcrumbHandler) Handle(ctx context.Context, r slog.Record) error {
+	data := make(map[string]any, len(h.attrs)+r.NumAttrs())
+	for k, v := range h.attrs {
+		data[k] = v
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		flatten(data, h.prefix, a)
+		return true
+	})
+	b := Breadcrumb{
+		Timestamp: r.Time.UTC(),
+		Type:      "default",
+		Category:  "log",
+		Level:     level(r.Level),
+		Message:   r.Message,
+		Data:      data,
+	}
+	if s := scopeFrom(ctx); s != nil && s.trail != nil {
+		s.trail.Add(b)
+	} else {
+		h.global.Add(b)
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *BreadcrumbHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	attrs := make(map[string]any, len(h.attrs)+len(as))
+	for k, v := range h.attrs {
+		attrs[k] = v
+	}
+	for _, a := range as {
+		flatten(attrs, h.prefix, a)
+	}
+	return &BreadcrumbHandler{next: h.next.WithAttrs(as), global: h.global, attrs: attrs, prefix: h.prefix}
+}
+
+func (h *BreadcrumbHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &BreadcrumbHandler{next: h.next.WithGroup(name), global: h.global, attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+func flatten(dst map[string]any, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		for _, ga := range v.Group() {
+			flatten(dst, prefix+a.Key+".", ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	switch v.Kind() {
+	case slog.KindString, slog.KindInt64, slog.KindUint64, slog.KindFloat64, slog.KindBool:
+		dst[prefix+a.Key] = v.Any()
+	default:
+		dst[prefix+a.Key] = v.String()
+	}
+}
+
+func level(l slog.Level) string {
+	switch {
+	case l < slog.LevelInfo:
+		return "debug"
+	case l < slog.LevelWarn:
+		return "info"
+	case l < slog.LevelError:
+		return "warning"
+	}
+	return "error"
+}
@@ -0,0 +1,90 @@
+package errreport
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Client ties a Reporter to the HTTP middleware and the breadcrumb log handler.
+type Client struct {
+	Reporter
+	builder   *Builder
+	global    *Trail
+	crumbs    int
+	report5xx bool
+}
+
+// New returns a Client reporting to the Sentry-compatible DSN in cfg, or one
+// that only recovers and logs panics when no DSN is set.
+func New(cfg *config.Config, reg *telemetry.Registry) (*Client, error) {
+	var rep Reporter = Nop{}
+	if cfg.Errors.DSN != "" {
+		s, err := NewSentry(cfg, reg)
+		if err != nil {
+			return nil, err
+		}
+		rep = s
+	}
+	global := NewTrail(cfg.Errors.Breadcrumbs)
+	return &Client{
+		Reporter:  rep,
+		builder:   NewBuilder(cfg, global),
+		global:    global,
+		crumbs:    cfg.Errors.Breadcrumbs,
+		report5xx: cfg.Errors.Report5xx,
+	}, nil
+}
+
+// LogHandler wraps next so that log records become breadcrumbs.
+func (c *Client) LogHandler(next slog.Handler) slog.Handler {
+	return NewBreadcrumbHandler(next, c.global)
+}
+
+// Middleware recovers panics, answers them with a 500 problem response and
+// reports them; 5xx responses are reported too unless disabled. It should
+// be installed inside the metrics and access log middleware so those see
+// the final status code.
+func (c *Client) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := &requestScope{reporter: c.Reporter, builder: c.builder, trail: NewTrail(c.crumbs)}
+		r = r.WithContext(withScope(r.Context(), scope))
+		scope.req = r
+		rec := telemetry.NewResponseRecorder(w)
+
+		defer func() {
+			v := recover()
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			route := telemetry.RouteName(r)
+			if v != nil {
+				ev := c.builder.FromPanic(v)
+				ev.Tags["route"] = route
+				c.builder.AttachRequest(ev, r, scope.trail)
+				c.Report(ev)
+				slog.ErrorContext(r.Context(), "panic recovered", "panic", v, "route", route, "event_id", ev.EventID)
+				if !rec.WroteHeader() {
+					problem.WriteDetails(rec, problem.Details{
+						Title:    http.StatusText(http.StatusInternalServerError),
+						Status:   http.StatusInternalServerError,
+						Detail:   "An unexpected error occurred.",
+						Instance: "urn:event:" + ev.EventID,
+					})
+				}
+				return
+			}
+			if c.report5xx && rec.Status() >= 500 {
+				ev := c.builder.FromStatus(r, route, rec.Status())
+				ev.Tags["route"] = route
+				c.builder.AttachRequest(ev, r, scope.trail)
+				c.Report(ev)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
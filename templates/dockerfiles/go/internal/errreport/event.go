@@ -0,0 +1,261 @@
+package errreport
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// Event is a single error report in the Sentry event payload format.
+type Event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   *exceptions       `json:"exception,omitempty"`
+	Fingerprint []string          `json:"fingerprint,omitempty"`
+	Request     *Request          `json:"request,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Breadcrumbs *breadcrumbs      `json:"breadcrumbs,omitempty"`
+	Contexts    map[string]any    `json:"contexts,omitempty"`
+}
+
+type exceptions struct {
+	Values []Exception `json:"values"`
+}
+
+// Exception describes the error and where it happened.
+type Exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *Stacktrace `json:"stacktrace,omitempty"`
+}
+
+// Request is the redacted HTTP request that triggered the event.
+type Request struct {
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	QueryString string            `json:"query_string,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+type breadcrumbs struct {
+	Values []Breadcrumb `json:"values"`
+}
+
+// Builder turns errors, panics and failed requests into events carrying the
+// service's release, environment and redaction rules.
+type Builder struct {
+	release     string
+	environment string
+	serverName  string
+	redact      map[string]bool
+	global      *Trail
+}
+
+// defaultRedacted headers never leave the process in clear text. Header
+// names containing any of sensitiveWords are redacted as well.
+var (
+	defaultRedacted = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token"}
+	sensitiveWords  = []string{"token", "secret", "password", "session", "api-key", "apikey"}
+)
+
+const filtered = "[Filtered]"
+
+func NewBuilder(cfg *config.Config, global *Trail) *Builder {
+	host, _ := os.Hostname()
+	b := &Builder{
+		release:     cfg.ServiceName + "@" + cfg.Version,
+		environment: cfg.Environment,
+		serverName:  host,
+		redact:      map[string]bool{},
+		global:      global,
+	}
+	for _, h := range append(defaultRedacted, cfg.Errors.RedactHeaders...) {
+		b.redact[http.CanonicalHeaderKey(h)] = true
+	}
+	return b
+}
+
+func (b *Builder) newEvent(level string) *Event {
+	return &Event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC(),
+		Platform:    "go",
+		Level:       level,
+		Logger:      "errreport",
+		ServerName:  b.serverName,
+		Release:     b.release,
+		Environment: b.environment,
+		Tags:        map[string]string{},
+		Contexts: map[string]any{
+			"runtime": map[string]string{"name": "go", "version": runtime.Version()},
+		},
+	}
+}
+
+// FromError builds an event for err, with the stack of the caller skip
+// frames above FromError.
+func (b *Builder) FromError(err error, skip int) *Event {
+	ev := b.newEvent("error")
+	st := callerStack(skip + 1)
+	ev.Exception = &exceptions{Values: []Exception{{
+		Type:       errorType(err),
+		Value:      err.Error(),
+		Stacktrace: st,
+	}}}
+	ev.Fingerprint = []string{fingerprint(errorType(err), st, err.Error())}
+	return ev
+}
+
+// FromPanic builds a fatal event from a recovered value. It must be called
+// from the deferred function that recovered, so the panicking frames are
+// still on the stack.
+func (b *Builder) FromPanic(recovered any) *Event {
+	ev := b.newEvent("fatal")
+	st := panicStack()
+	typ := "panic"
+	if err, ok := recovered.(error); ok {
+		typ = errorType(err)
+	}
+	msg := fmt.Sprint(recovered)
+	ev.Exception = &exceptions{Values: []Exception{{Type: typ, Value: msg, Stacktrace: st}}}
+	ev.Fingerprint = []string{fingerprint(typ, st, msg)}
+	ev.Tags["mechanism"] = "panic"
+	return ev
+}
+
+// FromStatus builds an event for a handler that answered with a 5xx status
+// without panicking. Such errors group by route and status.
+func (b *Builder) FromStatus(r *http.Request, route string, status int) *Event {
+	ev := b.newEvent("error")
+	ev.Message = fmt.Sprintf("%d %s on %s %s", status, http.StatusText(status), r.Method, route)
+	ev.Fingerprint = []string{hashParts("status", r.Method, route, fmt.Sprint(status))}
+	ev.Tags["status_code"] = fmt.Sprint(status)
+	return ev
+}
+
+// AttachRequest adds the redacted request and its breadcrumbs to ev.
+func (b *Builder) AttachRequest(ev *Event, r *http.Request, trail *Trail) {
+	if r != nil {
+		u := *r.URL
+		u.RawQuery = ""
+		u.Host = r.Host
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+		ev.Request = &Request{
+			Method:      r.Method,
+			URL:         u.String(),
+			QueryString: b.redactQuery(r.URL.Query()),
+			Headers:     b.redactHeaders(r.Header),
+		}
+		ev.Tags["http.method"] = r.Method
+	}
+	crumbs := b.global.Snapshot()
+	if trail != nil {
+		crumbs = trail.Snapshot()
+	}
+	if len(crumbs) > 0 {
+		ev.Breadcrumbs = &breadcrumbs{Values: crumbs}
+	}
+}
+
+func (b *Builder) sensitive(name string) bool {
+	if b.redact[http.CanonicalHeaderKey(name)] {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, w := range sensitiveWords {
+		if strings.Contains(lower, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Builder) redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if b.sensitive(k) {
+			out[k] = filtered
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+func (b *Builder) redactQuery(q map[string][]string) string {
+	if len(q) == 0 {
+		return ""
+	}
+	var parts []string
+	for k, vs := range q {
+		for _, v := range vs {
+			if b.sensitive(k) {
+				v = filtered
+			}
+			parts = append(parts, k+"="+v)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// errorType names the innermost wrapped error's concrete type, so that
+// fmt.Errorf wrapping does not split groups.
+func errorType(err error) string {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			break
+		}
+		err = next
+	}
+	return reflect.TypeOf(err).String()
+}
+
+// fingerprint groups events by error type and the in-app call path.
+// Line numbers are left out so that unrelated edits don't split a group;
+// when there is no in-app frame the message is used instead.
+func fingerprint(typ string, st *Stacktrace, msg string) string {
+	parts := []string{typ}
+	if st != nil {
+		for _, f := range st.Frames {
+			if f.InApp {
+				parts = append(parts, f.Module+"."+f.Function)
+			}
+		}
+	}
+	if len(parts) == 1 {
+		parts = append(parts, msg)
+	}
+	return hashParts(parts...)
+}
+
+func hashParts(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func newEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,47 @@
+package errreport
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket refilled at perMinute tokens per minute. It also
+// honours back-off periods requested by the server.
+type limiter struct {
+	mu        sync.Mutex
+	tokens    float64
+	burst     float64
+	perSecond float64
+	last      time.Time
+	until     time.Time
+}
+
+func newLimiter(perMinute int) *limiter {
+	burst := float64(max(perMinute, 1))
+	return &limiter{tokens: burst, burst: burst, perSecond: burst / 60, last: time.Now()}
+}
+
+func (l *limiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Before(l.until) {
+		return false
+	}
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.perSecond)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// backoff suspends sending for d.
+func (l *limiter) backoff(d time.Duration) {
+	l.mu.Lock()
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,58 @@
+// Package errreport captures panics and server errors and reports them,
+// with stack traces, request context and a breadcrumb trail, to a
+// Sentry-compatible service.
+package errreport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Reporter delivers error events. Implementations must be safe for
+// concurrent use and must not block the caller on network I/O.
+type Reporter interface {
+	Report(ev *Event)
+	Flush(ctx context.Context) error
+}
+
+// Nop discards every event. It is used when no DSN is configured.
+type Nop struct{}
+
+func (Nop) Report(*Event)               {}
+func (Nop) Flush(context.Context) error { return nil }
+
+type ctxKey struct{}
+
+type requestScope struct {
+	reporter Reporter
+	builder  *Builder
+	req      *http.Request
+	trail    *Trail
+}
+
+func withScope(ctx context.Context, s *requestScope) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+func scopeFrom(ctx context.Context) *requestScope {
+	s, _ := ctx.Value(ctxKey{}).(*requestScope)
+	return s
+}
+
+// Capture reports err from inside a handler, attaching the current request
+// and its breadcrumbs. It is a no-op outside of the Middleware.
+func Capture(ctx context.Context, err error) {
+	s := scopeFrom(ctx)
+	if s == nil || err == nil {
+		return
+	}
+	ev := s.builder.FromError(err, 1)
+	s.builder.AttachRequest(ev, s.req, s.trail)
+	s.reporter.Report(ev)
+}
+
+// Capturef is Capture with a formatted message.
+func Capturef(ctx context.Context, format string, args ...any) {
+	Capture(ctx, fmt.Errorf(format, args...))
+}
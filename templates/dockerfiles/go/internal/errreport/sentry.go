@@ -0,0 +1,162 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+const (
+	sentryClient = "go-app-errreport/1.0"
+	queueSize    = 100
+	sendTimeout  = 10 * time.Second
+)
+
+// Sentry sends events to a Sentry-compatible envelope endpoint. Events are
+// queued and delivered by a single background goroutine.
+type Sentry struct {
+	dsn      string
+	endpoint string
+	auth     string
+	http     *http.Client
+	limiter  *limiter
+	queue    chan *Event
+	pending  sync.WaitGroup
+	events   *telemetry.Counter
+}
+
+// NewSentry parses dsn ("https://<key>@host[/path]/<project>") and starts
+// the delivery goroutine.
+func NewSentry(cfg *config.Config, reg *telemetry.Registry) (*Sentry, error) {
+	u, err := url.Parse(cfg.Errors.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("errreport: invalid SENTRY_DSN: %w", err)
+	}
+	key := u.User.Username()
+	path := strings.TrimRight(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if key == "" || i < 0 || path[i+1:] == "" {
+		return nil, fmt.Errorf("errreport: SENTRY_DSN must look like https://<key>@host/<project>")
+	}
+	prefix, project := path[:i], path[i+1:]
+
+	s := &Sentry{
+		dsn:      cfg.Errors.DSN,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:     fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, key),
+		http:     &http.Client{Timeout: sendTimeout},
+		limiter:  newLimiter(cfg.Errors.RateLimit),
+		queue:    make(chan *Event, queueSize),
+		events:   reg.Counter("error_reports_total", "Error reports by outcome.", "outcome"),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Report queues ev unless the rate limit is exhausted or the queue is full.
+func (s *Sentry) Report(ev *Event) {
+	if !s.limiter.allow() {
+		s.events.Inc("rate_limited")
+		return
+	}
+	s.pending.Add(1)
+	select {
+	case s.queue <- ev:
+	default:
+		s.pending.Done()
+		s.events.Inc("dropped")
+	}
+}
+
+// Flush waits until queued events are delivered or ctx expires.
+func (s *Sentry) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Sentry) run() {
+	for ev := range s.queue {
+		if err := s.send(ev); err != nil {
+			s.events.Inc("failed")
+			slog.Warn("error report not delivered", "event_id", ev.EventID, "error", err)
+		} else {
+			s.events.Inc("sent")
+		}
+		s.pending.Done()
+	}
+}
+
+func (s *Sentry) send(ev *Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.Encode(map[string]string{
+		"event_id": ev.EventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+		"dsn":      s.dsn,
+	})
+	enc.Encode(map[string]any{"type": "event", "length": len(payload)})
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		s.limiter.backoff(serverBackoff(resp.Header))
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("errreport: %s returned %s", s.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// serverBackoff reads X-Sentry-Rate-Limits ("60:error:org, ...") or
+// Retry-After, defaulting to one minute.
+func serverBackoff(h http.Header) time.Duration {
+	if rl := h.Get("X-Sentry-Rate-Limits"); rl != "" {
+		secs, _, _ := strings.Cut(strings.TrimSpace(strings.Split(rl, ",")[0]), ":")
+		if n, err := strconv.Atoi(secs); err == nil {
+			return time.Duration(n) * time.Second
+		}
+	}
+	if n, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	return time.Minute
+}
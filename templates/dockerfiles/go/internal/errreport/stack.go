@@ -0,0 +1,102 @@
+package errreport
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Stacktrace lists frames oldest first, as Sentry expects.
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+const maxFrames = 64
+
+// mainModule is the module path of this binary, used to tell application
+// frames from library and runtime frames.
+var mainModule = func() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Path != "" {
+		return bi.Main.Path
+	}
+	return "github.com/example/app"
+}()
+
+// selfModule frames belong to the reporting machinery and are never in-app.
+var selfModule = mainModule + "/internal/errreport"
+
+// callerStack captures the stack of the caller skip frames above it.
+func callerStack(skip int) *Stacktrace {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(skip+2, pcs)
+	return framesFrom(pcs[:n], "")
+}
+
+// panicStack captures the stack of a panicking goroutine from inside the
+// deferred recover, dropping the frames of the recovery machinery itself.
+func panicStack() *Stacktrace {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(1, pcs)
+	return framesFrom(pcs[:n], "runtime.gopanic")
+}
+
+// framesFrom resolves pcs into frames. If after is set and found, frames up
+// to and including that function are dropped.
+func framesFrom(pcs []uintptr, after string) *Stacktrace {
+	var out []Frame
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if after != "" && f.Function == after {
+			out = out[:0]
+		} else if f.Function != "" {
+			module, fn := splitFunction(f.Function)
+			out = append(out, Frame{
+				Function: fn,
+				Module:   module,
+				Filename: trimPath(f.File),
+				AbsPath:  f.File,
+				Lineno:   f.Line,
+				InApp:    strings.HasPrefix(module, mainModule) && module != selfModule,
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return &Stacktrace{Frames: out}
+}
+
+// splitFunction splits "github.com/x/y/pkg.(*T).Method" into the package
+// path and "(*T).Method".
+func splitFunction(name string) (module, fn string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	dot += slash + 1
+	return name[:dot], name[dot+1:]
+}
+
+func trimPath(file string) string {
+	if i := strings.Index(file, "/internal/"); i >= 0 {
+		return file[i+1:]
+	}
+	if i := strings.Index(file, "/cmd/"); i >= 0 {
+		return file[i+1:]
+	}
+	return file
+}
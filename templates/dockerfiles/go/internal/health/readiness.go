@@ -0,0 +1,72 @@
+// Package health tracks whether the instance should receive traffic.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// Readiness aggregates named checks. The instance is ready when every check
+// returns nil.
+type Readiness struct {
+	mu     sync.RWMutex
+	checks []check
+}
+
+type check struct {
+	name string
+	fn   func() error
+}
+
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func NewReadiness() *Readiness {
+	return &Readiness{}
+}
+
+// Add registers a check. Checks run on every probe so they must be cheap.
+func (r *Readiness) Add(name string, fn func() error) {
+	r.mu.Lock()
+	r.checks = append(r.checks, check{name: name, fn: fn})
+	r.mu.Unlock()
+}
+
+// Check runs every check and reports the combined result.
+func (r *Readiness) Check() (bool, Status) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ready := true
+	st := Status{Status: "ready", Checks: make(map[string]string, len(r.checks))}
+	for _, c := range r.checks {
+		if err := c.fn(); err != nil {
+			ready = false
+			st.Checks[c.name] = err.Error()
+			continue
+		}
+		st.Checks[c.name] = "ok"
+	}
+	if !ready {
+		st.Status = "not ready"
+	}
+	return ready, st
+}
+
+// Handler answers 200 when ready and 503 otherwise.
+func (r *Readiness) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		ready, st := r.Check()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if ready {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(st)
+	})
+}
@@ -0,0 +1,107 @@
+package inspect
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+// RegisterAdmin adds the inspector to the admin router:
+//
+//	GET /debug/requests                         active and recent requests, with counts per route
+//	GET /debug/requests?route=&bucket=          requests of a route that took at least Buckets[bucket]
+//	GET /debug/requests?route=&errors=1         requests of a route that failed with a 5xx
+//	GET /debug/requests?active=1                active requests only
+//
+// Browsers get HTML; ?format=json or Accept: application/json gets JSON.
+func (i *Inspector) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/debug/requests", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f := Filter{Route: q.Get("route"), Errors: q.Get("errors") == "1", Active: q.Get("active") == "1"}
+		f.Bucket, _ = strconv.Atoi(q.Get("bucket"))
+		v := i.View(f)
+		if q.Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			admin.WriteJSON(w, http.StatusOK, v)
+			return
+		}
+		var buf bytes.Buffer
+		if err := page.Execute(&buf, struct {
+			View
+			Filter Filter
+		}{v, f}); err != nil {
+			problem.Write(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	}).Methods(http.MethodGet)
+}
+
+var page = template.Must(template.New("requests").Funcs(template.FuncMap{
+	"buckets": func() []string {
+		out := make([]string, len(Buckets))
+		for n, b := range Buckets {
+			out[n] = "≥" + b.String()
+		}
+		return out
+	},
+	"query": func(route string, kv ...string) template.URL {
+		q := url.Values{"route": {route}}
+		for n := 0; n+1 < len(kv); n += 2 {
+			q.Set(kv[n], kv[n+1])
+		}
+		return template.URL("?" + q.Encode())
+	},
+	"ms": func(v float64) string {
+		return time.Duration(v * float64(time.Millisecond)).Round(time.Microsecond).String()
+	},
+	"clock": func(t time.Time) string { return t.Format("15:04:05.000") },
+	"str":   func(n int) string { return fmt.Sprint(n) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>/debug/requests</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { padding: 2px 10px; text-align: left; }
+th { background: #eee; }
+td.n { text-align: right; }
+tr.sel { background: #ffd; }
+.err { color: #b00; }
+details { font-family: monospace; margin: 2px 0; }
+details ul { margin: 2px 0 6px; }
+</style>
+</head>
+<body>
+<h1>/debug/requests</h1>
+<p>Since {{.Since.Format "2006-01-02 15:04:05 MST"}}. <a href="?">Recent</a> · <a href="?active=1">Active</a> · <a href="?format=json">JSON</a></p>
+<table>
+<tr><th>Route</th><th>Active</th>{{range buckets}}<th>{{.}}</th>{{end}}<th>Errors</th></tr>
+{{range $r := .Routes}}<tr{{if eq $r.Route $.Filter.Route}} class="sel"{{end}}>
+<td>{{$r.Route}}</td><td class="n">{{$r.Active}}</td>
+{{range $b, $n := $r.Buckets}}<td class="n">{{if $n}}<a href="{{query $r.Route "bucket" (str $b)}}">{{$n}}</a>{{else}}0{{end}}</td>{{end}}
+<td class="n">{{if $r.Errors}}<a class="err" href="{{query $r.Route "errors" "1"}}">{{$r.Errors}}</a>{{else}}0{{end}}</td>
+</tr>{{end}}
+</table>
+{{if .Active}}<h2>Active</h2>{{template "list" .Active}}{{end}}
+{{if not .Filter.Active}}<h2>{{if .Filter.Route}}{{.Filter.Route}}{{if .Filter.Errors}}, failed{{end}}{{else}}Recent{{end}}</h2>
+{{if .Requests}}{{template "list" .Requests}}{{else}}<p>None.</p>{{end}}{{end}}
+</body>
+</html>
+{{define "list"}}{{range .}}<details>
+<summary>{{clock .Start}} {{ms .Elapsed}} #{{.ID}} {{.Method}} {{.Path}}{{if .Site}} [{{.Site}}]{{end}} {{if .Active}}active{{else}}<span{{if ge .Status 500}} class="err"{{end}}>{{.Status}}</span>{{end}} {{.Remote}}</summary>
+<ul>{{range .Events}}<li>+{{ms .At}} {{.Name}}{{if .Duration}} ({{ms .Duration}}{{if .Running}}, running{{end}}){{end}}{{if .Error}} <span class="err">{{.Error}}</span>{{end}}</li>{{else}}<li>no events</li>{{end}}
+{{if .Dropped}}<li>{{.Dropped}} more events dropped</li>{{end}}</ul>
+</details>
+{{end}}{{end}}`))
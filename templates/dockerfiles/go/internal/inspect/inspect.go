@@ -0,0 +1,219 @@
+// Package inspect keeps recent and in-flight requests in memory, with the
+// events each went through, for live debugging on the admin listener
+// without a tracing backend. It follows golang.org/x/net/trace: requests
+// are grouped by route and latency bucket, and a few of each bucket are
+// kept so slow requests outlive the list of recent ones.
+//
+// Middleware is timed with Wrap, upstream calls with Transport and
+// database queries with Connector; handlers add events of their own with
+// Begin.
+package inspect
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Buckets are the lower bounds of the latency buckets.
+var Buckets = [...]time.Duration{0, time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second, 10 * time.Second}
+
+// Inspector records requests.
+type Inspector struct {
+	cfg     config.InspectConfig
+	started time.Time
+	nextID  atomic.Uint64
+
+	mu     sync.Mutex
+	active map[uint64]*trace
+	recent []*trace // ring of finished requests
+	next   int
+	routes map[string]*route
+}
+
+// route holds the counts of one route and the requests kept for it.
+type route struct {
+	count   [len(Buckets)]int64
+	errors  int64
+	buckets [len(Buckets)][]*trace // newest last
+	failed  []*trace
+}
+
+func New(cfg config.InspectConfig) *Inspector {
+	return &Inspector{
+		cfg:     cfg,
+		started: time.Now(),
+		active:  map[uint64]*trace{},
+		recent:  make([]*trace, 0, cfg.Requests),
+		routes:  map[string]*route{},
+	}
+}
+
+// Middleware records each request from start to finish. It is meant to be
+// installed with mux.Router.Use so the route template is known.
+func (i *Inspector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := telemetry.RouteName(r)
+		if slices.Contains(i.cfg.Exclude, name) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		t := &trace{
+			id:     i.nextID.Add(1),
+			method: r.Method,
+			path:   r.URL.Path,
+			route:  name,
+			remote: r.RemoteAddr,
+			start:  time.Now(),
+			max:    i.cfg.Events,
+		}
+		i.mu.Lock()
+		i.active[t.id] = t
+		i.mu.Unlock()
+
+		rec := telemetry.NewResponseRecorder(w)
+		defer func() {
+			t.finish(rec.Status(), telemetry.Site(r.Context()))
+			i.done(t)
+		}()
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), traceKey{}, t)))
+	})
+}
+
+func (i *Inspector) done(t *trace) {
+	b := bucket(t.elapsed())
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.active, t.id)
+
+	if len(i.recent) < cap(i.recent) {
+		i.recent = append(i.recent, t)
+	} else {
+		i.recent[i.next] = t
+		i.next = (i.next + 1) % len(i.recent)
+	}
+
+	rt := i.routes[t.route]
+	if rt == nil {
+		rt = &route{}
+		i.routes[t.route] = rt
+	}
+	rt.count[b]++
+	rt.buckets[b] = keep(rt.buckets[b], t, i.cfg.PerBucket)
+	if t.status >= 500 {
+		rt.errors++
+		rt.failed = keep(rt.failed, t, i.cfg.PerBucket)
+	}
+}
+
+func keep(list []*trace, t *trace, n int) []*trace {
+	if n <= 0 {
+		return list
+	}
+	if len(list) >= n {
+		list = append(list[:0], list[len(list)-n+1:]...)
+	}
+	return append(list, t)
+}
+
+func bucket(d time.Duration) int {
+	b := 0
+	for i, lower := range Buckets {
+		if d >= lower {
+			b = i
+		}
+	}
+	return b
+}
+
+// Filter selects the requests of a view. The zero Filter selects the
+// active requests and the recent ones.
+type Filter struct {
+	Route  string
+	Bucket int  // with Route, requests kept in this bucket or slower ones
+	Errors bool // with Route, the failed requests kept
+	Active bool // only active requests
+}
+
+// View is what /debug/requests shows.
+type View struct {
+	Since    time.Time      `json:"since"`
+	Routes   []RouteSummary `json:"routes"`
+	Active   []Request      `json:"active"`
+	Requests []Request      `json:"requests"`
+}
+
+// RouteSummary counts the requests of a route. Buckets are cumulative:
+// Buckets[i] counts the requests that took at least inspect.Buckets[i].
+type RouteSummary struct {
+	Route   string  `json:"route"`
+	Active  int     `json:"active"`
+	Buckets []int64 `json:"buckets"`
+	Errors  int64   `json:"errors"`
+}
+
+// View snapshots the requests f selects, newest first.
+func (i *Inspector) View(f Filter) View {
+	i.mu.Lock()
+	active := map[string]int{}
+	var running, kept []*trace
+	for _, t := range i.active {
+		active[t.route]++
+		if f.Route == "" || f.Route == t.route {
+			running = append(running, t)
+		}
+	}
+	v := View{Since: i.started, Routes: []RouteSummary{}}
+	names := map[string]bool{}
+	for name := range i.routes {
+		names[name] = true
+	}
+	for name := range active {
+		names[name] = true
+	}
+	for name := range names {
+		s := RouteSummary{Route: name, Active: active[name], Buckets: make([]int64, len(Buckets))}
+		if rt := i.routes[name]; rt != nil {
+			var sum int64
+			for b := len(Buckets) - 1; b >= 0; b-- {
+				sum += rt.count[b]
+				s.Buckets[b] = sum
+			}
+			s.Errors = rt.errors
+		}
+		v.Routes = append(v.Routes, s)
+	}
+	switch rt := i.routes[f.Route]; {
+	case f.Active:
+	case f.Route == "":
+		kept = append(kept, i.recent...)
+	case rt == nil:
+	case f.Errors:
+		kept = append(kept, rt.failed...)
+	default:
+		for b := max(f.Bucket, 0); b < len(Buckets); b++ {
+			kept = append(kept, rt.buckets[b]...)
+		}
+	}
+	i.mu.Unlock()
+
+	sort.Slice(v.Routes, func(a, b int) bool { return v.Routes[a].Route < v.Routes[b].Route })
+	v.Active, v.Requests = snapshot(running), snapshot(kept)
+	return v
+}
+
+func snapshot(traces []*trace) []Request {
+	out := make([]Request, len(traces))
+	for n, t := range traces {
+		out[n] = t.snapshot()
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID > out[b].ID })
+	return out
+}
@@ -0,0 +1,180 @@
+package inspect
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+)
+
+// Connector records each query and statement run through base as an event
+// of the request its context belongs to. Only the SQL is recorded, never
+// the arguments.
+func Connector(base driver.Connector) driver.Connector {
+	return connector{base}
+}
+
+type connector struct {
+	base driver.Connector
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn{cn}, nil
+}
+
+func (c connector) Driver() driver.Driver { return c.base.Driver() }
+
+// conn passes everything to the driver's connection. Where the driver
+// lacks an optional interface, it answers as database/sql would without it.
+type conn struct {
+	driver.Conn
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	end := Begin(ctx, "db "+statement(query))
+	rows, err := q.QueryContext(ctx, query, args)
+	end(skipped(err))
+	return rows, err
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	end := Begin(ctx, "db "+statement(query))
+	res, err := e.ExecContext(ctx, query, args)
+	end(skipped(err))
+	return res, err
+}
+
+func (c conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var st driver.Stmt
+	var err error
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = p.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stmt{st, statement(query)}, nil
+}
+
+func (c conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	end := Begin(ctx, "db "+s.query)
+	var rows driver.Rows
+	var err error
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else if values, verr := plain(args); verr != nil {
+		err = verr
+	} else {
+		rows, err = s.Stmt.Query(values)
+	}
+	end(err)
+	return rows, err
+}
+
+func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	end := Begin(ctx, "db "+s.query)
+	var res driver.Result
+	var err error
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else if values, verr := plain(args); verr != nil {
+		err = verr
+	} else {
+		res, err = s.Stmt.Exec(values)
+	}
+	end(err)
+	return res, err
+}
+
+func (s stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func plain(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for n, a := range args {
+		if a.Name != "" {
+			return nil, errors.New("inspect: driver does not support named parameters")
+		}
+		values[n] = a.Value
+	}
+	return values, nil
+}
+
+// skipped hides driver.ErrSkip, which only makes database/sql prepare the
+// statement instead, from the event.
+func skipped(err error) error {
+	if errors.Is(err, driver.ErrSkip) {
+		return nil
+	}
+	return err
+}
+
+// statement shortens a query to its first line, for an event name.
+func statement(query string) string {
+	query = strings.TrimSpace(query)
+	if line, _, ok := strings.Cut(query, "\n"); ok {
+		query = strings.TrimSpace(line) + " …"
+	}
+	if len(query) > 80 {
+		query = query[:80] + "…"
+	}
+	return query
+}
@@ -0,0 +1,203 @@
+package inspect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// trace is a request being recorded.
+type trace struct {
+	id     uint64
+	method string
+	path   string
+	route  string
+	remote string
+	start  time.Time
+	max    int // events kept
+
+	mu      sync.Mutex
+	site    string
+	status  int
+	end     time.Time // zero while active
+	events  []event
+	dropped int
+}
+
+type event struct {
+	at      time.Time
+	name    string
+	dur     time.Duration
+	running bool
+	err     string
+}
+
+// Request is a snapshot of a recorded request.
+type Request struct {
+	ID      uint64    `json:"id"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Route   string    `json:"route"`
+	Site    string    `json:"site,omitempty"`
+	Remote  string    `json:"remote"`
+	Start   time.Time `json:"start"`
+	Elapsed float64   `json:"elapsed_ms"` // so far, for active requests
+	Status  int       `json:"status,omitempty"`
+	Active  bool      `json:"active"`
+	Events  []Event   `json:"events"`
+	Dropped int       `json:"dropped_events,omitempty"`
+}
+
+// Event is something that happened during a request. Timed events have a
+// duration; Running marks one that had not ended at the snapshot.
+type Event struct {
+	At       float64 `json:"at_ms"` // since the request started
+	Name     string  `json:"name"`
+	Duration float64 `json:"duration_ms,omitempty"`
+	Running  bool    `json:"running,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+func (t *trace) add(e event) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.events) >= t.max {
+		t.dropped++
+		return -1
+	}
+	t.events = append(t.events, e)
+	return len(t.events) - 1
+}
+
+func (t *trace) stop(n int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n < 0 || !t.events[n].running {
+		return
+	}
+	e := &t.events[n]
+	e.running, e.dur = false, time.Since(e.at)
+	if err != nil {
+		e.err = err.Error()
+	}
+}
+
+func (t *trace) finish(status int, site string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status, t.site, t.end = status, site, time.Now()
+}
+
+func (t *trace) elapsed() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.end.IsZero() {
+		return time.Since(t.start)
+	}
+	return t.end.Sub(t.start)
+}
+
+func (t *trace) snapshot() Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := Request{
+		ID:      t.id,
+		Method:  t.method,
+		Path:    t.path,
+		Route:   t.route,
+		Site:    t.site,
+		Remote:  t.remote,
+		Start:   t.start,
+		Status:  t.status,
+		Active:  t.end.IsZero(),
+		Events:  make([]Event, len(t.events)),
+		Dropped: t.dropped,
+	}
+	end := t.end
+	if r.Active {
+		end = time.Now()
+	}
+	r.Elapsed = ms(end.Sub(t.start))
+	for n, e := range t.events {
+		r.Events[n] = Event{At: ms(e.at.Sub(t.start)), Name: e.name, Duration: ms(e.dur), Running: e.running, Error: e.err}
+		if e.running {
+			r.Events[n].Duration = ms(end.Sub(e.at))
+		}
+	}
+	return r
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type traceKey struct{}
+
+func fromContext(ctx context.Context) *trace {
+	t, _ := ctx.Value(traceKey{}).(*trace)
+	return t
+}
+
+// Begin starts a timed event, such as a database query, in the request
+// ctx belongs to. Call the returned function with the outcome when it
+// ends. Outside a recorded request it does nothing.
+func Begin(ctx context.Context, name string) func(err error) {
+	t := fromContext(ctx)
+	if t == nil {
+		return func(error) {}
+	}
+	n := t.add(event{at: time.Now(), name: name, running: true})
+	return func(err error) { t.stop(n, err) }
+}
+
+// Wrap times a middleware: the event lasts until it calls the next
+// handler, or until it returns when it answers the request itself.
+func Wrap(name string, mw mux.MiddlewareFunc) mux.MiddlewareFunc {
+	key := &passKey{name}
+	return func(next http.Handler) http.Handler {
+		inner := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if end, ok := r.Context().Value(key).(func(error)); ok {
+				end(nil)
+			}
+			next.ServeHTTP(w, r)
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := fromContext(r.Context())
+			if t == nil {
+				inner.ServeHTTP(w, r)
+				return
+			}
+			n := t.add(event{at: time.Now(), name: "middleware " + name, running: true})
+			end := func(err error) { t.stop(n, err) }
+			inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key, end)))
+			end(nil)
+		})
+	}
+}
+
+type passKey struct{ name string }
+
+// Transport records each request sent through base as an event of the
+// incoming request its context belongs to.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripper{base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	end := Begin(req.Context(), fmt.Sprintf("upstream %s %s%s", req.Method, req.URL.Host, req.URL.Path))
+	resp, err := rt.base.RoundTrip(req)
+	if err == nil && resp.StatusCode >= 500 {
+		end(fmt.Errorf("%s", resp.Status))
+	} else {
+		end(err)
+	}
+	return resp, err
+}
@@ -0,0 +1,106 @@
+// Package instance identifies the running replica, so responses, logs and
+// telemetry from several replicas behind a load balancer can be told apart.
+package instance
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// started is taken when the package initialises, which is close enough to
+// process start and the same for every caller.
+var started = time.Now().UTC().Truncate(time.Second)
+
+// Identity describes this replica. It is embedded in API responses, so the
+// JSON names are part of the public response format.
+type Identity struct {
+	ID          string    `json:"instance_id"`
+	Hostname    string    `json:"hostname"`
+	ContainerID string    `json:"container_id,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	Zone        string    `json:"zone,omitempty"`
+	Region      string    `json:"region,omitempty"`
+
+	header string
+}
+
+// New detects the identity of the running replica. The ID is INSTANCE_ID
+// when set, else the short container ID, else the hostname, so it stays the
+// same across restarts of the same container.
+func New(cfg config.InstanceConfig) *Identity {
+	id := &Identity{
+		ID:          cfg.ID,
+		ContainerID: ContainerID(),
+		StartedAt:   started,
+		Zone:        cfg.Zone,
+		Region:      cfg.Region,
+		header:      cfg.Header,
+	}
+	id.Hostname, _ = os.Hostname()
+	if id.ID == "" && id.ContainerID != "" {
+		id.ID = id.ContainerID[:12]
+	}
+	if id.ID == "" {
+		id.ID = id.Hostname
+	}
+	if id.ID == "" {
+		b := make([]byte, 6)
+		rand.Read(b)
+		id.ID = hex.EncodeToString(b)
+	}
+	return id
+}
+
+// Middleware names the replica in the SERVED_BY_HEADER response header.
+func (id *Identity) Middleware(next http.Handler) http.Handler {
+	if id.header == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(id.header, id.ID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// ContainerID extracts the Docker/containerd container ID. cgroup v1 exposes
+// it in /proc/self/cgroup; with cgroup v2 that file only contains "0::/",
+// so /proc/self/mountinfo (the /etc/hostname bind mount) is used instead.
+// It is empty outside a container.
+func ContainerID() string {
+	for _, path := range []string{"/proc/self/cgroup", "/proc/self/mountinfo"} {
+		if id := scanForID(path); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func scanForID(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasSuffix(path, "mountinfo") && !strings.Contains(line, "/containers/") {
+			continue
+		}
+		if id := containerIDPattern.FindString(line); id != "" {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Hooks adapts a pair of functions to a Component. Either may be nil.
+type Hooks struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+func (h Hooks) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+func (h Hooks) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// Background runs a loop such as a poller for as long as the component is
+// running. run gets a context that is cancelled on Stop, which then waits
+// for run to return.
+func Background(run func(ctx context.Context)) Component {
+	return &background{run: run}
+}
+
+type background struct {
+	run    func(ctx context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (b *background) Start(context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel, b.done = cancel, make(chan struct{})
+	go func() {
+		defer close(b.done)
+		b.run(ctx)
+	}()
+	return nil
+}
+
+func (b *background) Stop(ctx context.Context) error {
+	b.cancel()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Server serves srv from Start, which returns once the listener is bound
+// so a port conflict fails startup, until Stop shuts it down gracefully.
+// It serves HTTPS when srv.TLSConfig is set.
+// fail is called if serving stops for any other reason.
+func Server(srv *http.Server, fail func(error)) Component {
+	return &server{srv: srv, fail: fail}
+}
+
+type server struct {
+	srv  *http.Server
+	fail func(error)
+}
+
+func (s *server) Start(ctx context.Context) error {
+	addr := s.srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		serve := s.srv.Serve
+		if s.srv.TLSConfig != nil {
+			serve = func(ln net.Listener) error { return s.srv.ServeTLS(ln, "", "") }
+		}
+		if err := serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.fail(err)
+		}
+	}()
+	return nil
+}
+
+func (s *server) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,17 @@
+package lifecycle
+
+import (
+	"net/http"
+
+	"github.com/example/app/internal/admin"
+	"github.com/gorilla/mux"
+)
+
+// RegisterAdmin adds the lifecycle endpoint to the admin router:
+//
+//	GET /lifecycle  state of every component, in registration order
+func (m *Manager) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/lifecycle", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, m.Status())
+	}).Methods(http.MethodGet)
+}
@@ -0,0 +1,263 @@
+// Package lifecycle starts and stops the service's components in order.
+//
+// Components declare what they depend on. Start brings them up in
+// dependency order, one at a time and each under its own timeout, and Stop
+// takes them down in the reverse order, so the listener stops before the
+// pools it uses and telemetry is flushed last.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// Component is a part of the service with a start and a stop step. Start
+// must return once the component is usable; background work keeps running
+// until Stop. Stop is only called on components whose Start succeeded.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Options describe how a component is managed.
+type Options struct {
+	DependsOn    []string      // components that must be running first
+	StartTimeout time.Duration // COMPONENT_START_TIMEOUT when zero
+	StopTimeout  time.Duration // COMPONENT_STOP_TIMEOUT when zero
+}
+
+// State is where a component is in its lifecycle.
+type State string
+
+const (
+	Pending  State = "pending"
+	Starting State = "starting"
+	Running  State = "running"
+	Stopping State = "stopping"
+	Stopped  State = "stopped"
+	Failed   State = "failed"
+)
+
+// Status reports one component.
+type Status struct {
+	Name      string     `json:"name"`
+	State     State      `json:"state"`
+	DependsOn []string   `json:"depends_on,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	StartTook string     `json:"start_took,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type entry struct {
+	name string
+	c    Component
+	opts Options
+
+	state     State
+	since     time.Time
+	startTook time.Duration
+	err       error
+}
+
+// Manager owns the components of the service.
+type Manager struct {
+	cfg config.LifecycleConfig
+
+	mu      sync.Mutex
+	entries []*entry
+	byName  map[string]*entry
+	started []*entry // in start order
+}
+
+func New(cfg config.LifecycleConfig) *Manager {
+	return &Manager{cfg: cfg, byName: map[string]*entry{}}
+}
+
+// Add registers a component. Names must be unique; dependencies may be
+// added later, as long as they are added before Start.
+func (m *Manager) Add(name string, c Component, opts Options) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.byName[name]; ok {
+		panic("lifecycle: component " + name + " added twice")
+	}
+	e := &entry{name: name, c: c, opts: opts, state: Pending}
+	m.entries = append(m.entries, e)
+	m.byName[name] = e
+}
+
+// Start starts every component in dependency order. If one fails, those
+// already running are stopped again and the error is returned.
+func (m *Manager) Start(ctx context.Context) error {
+	order, err := m.order()
+	if err != nil {
+		return err
+	}
+	for _, e := range order {
+		timeout := e.opts.StartTimeout
+		if timeout <= 0 {
+			timeout = m.cfg.StartTimeout
+		}
+		m.set(e, Starting, nil)
+		slog.Debug("component starting", "component", e.name)
+		began := time.Now()
+		err := call(ctx, timeout, e.c.Start)
+		if err != nil {
+			m.set(e, Failed, err)
+			slog.Error("component failed to start", "component", e.name, "error", err)
+			stopCtx, cancel := context.WithTimeout(context.Background(), m.cfg.StopTimeout*time.Duration(len(order)))
+			defer cancel()
+			m.Stop(stopCtx)
+			return fmt.Errorf("lifecycle: starting %s: %w", e.name, err)
+		}
+		m.mu.Lock()
+		e.startTook = time.Since(began)
+		m.started = append(m.started, e)
+		m.mu.Unlock()
+		m.set(e, Running, nil)
+		slog.Info("component started", "component", e.name, "took", e.startTook.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// Stop stops the running components in reverse start order. Each gets its
+// own stop timeout, bounded by ctx; a failing component does not keep the
+// others from stopping.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		e := started[i]
+		timeout := e.opts.StopTimeout
+		if timeout <= 0 {
+			timeout = m.cfg.StopTimeout
+		}
+		m.set(e, Stopping, nil)
+		if err := call(ctx, timeout, e.c.Stop); err != nil {
+			m.set(e, Failed, err)
+			slog.Error("component failed to stop", "component", e.name, "error", err)
+			errs = append(errs, fmt.Errorf("lifecycle: stopping %s: %w", e.name, err))
+			continue
+		}
+		m.set(e, Stopped, nil)
+		slog.Info("component stopped", "component", e.name)
+	}
+	return errors.Join(errs...)
+}
+
+// Status reports every component in registration order.
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Status, 0, len(m.entries))
+	for _, e := range m.entries {
+		st := Status{Name: e.name, State: e.state, DependsOn: e.opts.DependsOn}
+		if !e.since.IsZero() {
+			since := e.since
+			st.Since = &since
+		}
+		if e.startTook > 0 {
+			st.StartTook = e.startTook.Round(time.Millisecond).String()
+		}
+		if e.err != nil {
+			st.Error = e.err.Error()
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// ReadinessCheck fails unless every component is running.
+func (m *Manager) ReadinessCheck() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var waiting []string
+	for _, e := range m.entries {
+		if e.state != Running {
+			waiting = append(waiting, e.name+" "+string(e.state))
+		}
+	}
+	if len(waiting) > 0 {
+		return errors.New(strings.Join(waiting, ", "))
+	}
+	return nil
+}
+
+func (m *Manager) set(e *entry, s State, err error) {
+	m.mu.Lock()
+	e.state, e.since, e.err = s, time.Now(), err
+	m.mu.Unlock()
+}
+
+// order sorts the components topologically. Among components whose
+// dependencies are met, registration order decides.
+func (m *Manager) order() ([]*entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		for _, d := range e.opts.DependsOn {
+			if _, ok := m.byName[d]; !ok {
+				return nil, fmt.Errorf("lifecycle: %s depends on unknown component %s", e.name, d)
+			}
+		}
+	}
+	done := map[string]bool{}
+	var order []*entry
+	for len(order) < len(m.entries) {
+		progressed := false
+		for _, e := range m.entries {
+			if done[e.name] || !ready(e, done) {
+				continue
+			}
+			done[e.name] = true
+			order = append(order, e)
+			progressed = true
+		}
+		if !progressed {
+			var cycle []string
+			for _, e := range m.entries {
+				if !done[e.name] {
+					cycle = append(cycle, e.name)
+				}
+			}
+			return nil, fmt.Errorf("lifecycle: dependency cycle among %s", strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+func ready(e *entry, done map[string]bool) bool {
+	for _, d := range e.opts.DependsOn {
+		if !done[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// call runs fn under timeout. A component that ignores its context is
+// abandoned when the timeout passes, so one stuck step cannot hang startup
+// or shutdown.
+func call(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("gave up after %s: %w", timeout, ctx.Err())
+	}
+}
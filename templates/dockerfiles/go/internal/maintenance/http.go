@@ -0,0 +1,68 @@
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+const defaultDetail = "The service is undergoing maintenance. Please retry later."
+
+// Middleware turns requests away while maintenance is on. Install it only on
+// the public subrouter so health, metrics and admin routes are unaffected.
+func (m *Mode) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		detail := m.Status().Reason
+		if detail == "" {
+			detail = defaultDetail
+		}
+		w.Header().Set("Retry-After", m.retryAfter())
+		w.Header().Set("Cache-Control", "no-store")
+		problem.WriteDetails(w, problem.Details{
+			Type:   "urn:problem:maintenance",
+			Title:  "Service Under Maintenance",
+			Status: http.StatusServiceUnavailable,
+			Detail: detail,
+		})
+	})
+}
+
+// RegisterAdmin adds the maintenance endpoints to the admin router:
+//
+//	GET    /maintenance  current status
+//	PUT    /maintenance  {"enabled": true, "reason": "..."}
+//	DELETE /maintenance  switch the admin source off
+func (m *Mode) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/maintenance", m.getHandler).Methods(http.MethodGet)
+	r.HandleFunc("/maintenance", m.putHandler).Methods(http.MethodPut, http.MethodPost)
+	r.HandleFunc("/maintenance", m.deleteHandler).Methods(http.MethodDelete)
+}
+
+func (m *Mode) getHandler(w http.ResponseWriter, r *http.Request) {
+	admin.WriteJSON(w, http.StatusOK, m.Status())
+}
+
+func (m *Mode) putHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool  `json:"enabled"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil || req.Enabled == nil {
+		problem.Write(w, http.StatusBadRequest, `expected {"enabled": true|false, "reason": "..."}`)
+		return
+	}
+	m.Set(SourceAdmin, *req.Enabled, req.Reason)
+	admin.WriteJSON(w, http.StatusOK, m.Status())
+}
+
+func (m *Mode) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	m.Set(SourceAdmin, false, "")
+	admin.WriteJSON(w, http.StatusOK, m.Status())
+}
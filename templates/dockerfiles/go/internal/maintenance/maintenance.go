@@ -0,0 +1,179 @@
+// Package maintenance implements maintenance mode: while enabled, public
+// routes answer 503 with a problem body and Retry-After.
+//
+// The mode can be switched on from three independent sources: the admin
+// API, a signal (SIGUSR1 toggles it) and the presence of a file in the data
+// directory. It is on while any source has it on.
+package maintenance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Sources that can enable maintenance mode.
+const (
+	SourceAdmin  = "admin"
+	SourceSignal = "signal"
+	SourceFile   = "file"
+)
+
+// ErrInMaintenance is reported by the readiness check.
+var ErrInMaintenance = errors.New("in maintenance")
+
+type Mode struct {
+	cfg   config.MaintenanceConfig
+	path  string
+	gauge *telemetry.Gauge
+
+	mu      sync.RWMutex
+	sources map[string]bool
+	reason  string
+	since   time.Time
+}
+
+// Status is the admin API view of the mode.
+type Status struct {
+	Enabled bool       `json:"enabled"`
+	Sources []string   `json:"sources,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	File    string     `json:"file"`
+}
+
+func New(cfg *config.Config, reg *telemetry.Registry) *Mode {
+	path := cfg.Maintenance.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cfg.DataDir, path)
+	}
+	m := &Mode{
+		cfg:     cfg.Maintenance,
+		path:    path,
+		gauge:   reg.Gauge("maintenance_mode", "1 while maintenance mode is enabled."),
+		sources: map[string]bool{},
+	}
+	m.gauge.Set(0)
+	return m
+}
+
+// Enabled reports whether public traffic should be turned away.
+func (m *Mode) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sources) > 0
+}
+
+// Set switches one source on or off.
+func (m *Mode) Set(source string, on bool, reason string) {
+	m.mu.Lock()
+	was := len(m.sources) > 0
+	if on {
+		m.sources[source] = true
+		if reason != "" {
+			m.reason = reason
+		}
+	} else {
+		delete(m.sources, source)
+	}
+	now := len(m.sources) > 0
+	switch {
+	case now && !was:
+		m.since = time.Now()
+	case !now:
+		m.reason = ""
+		m.since = time.Time{}
+	}
+	m.mu.Unlock()
+
+	if now != was {
+		m.gauge.Set(boolFloat(now))
+		slog.Warn("maintenance mode changed", "enabled", now, "source", source, "reason", reason)
+	}
+}
+
+// Toggle flips one source and returns its new state.
+func (m *Mode) Toggle(source string) bool {
+	m.mu.RLock()
+	on := !m.sources[source]
+	m.mu.RUnlock()
+	m.Set(source, on, "")
+	return on
+}
+
+func (m *Mode) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	st := Status{Enabled: len(m.sources) > 0, Reason: m.reason, File: m.path}
+	for s := range m.sources {
+		st.Sources = append(st.Sources, s)
+	}
+	sort.Strings(st.Sources)
+	if st.Enabled {
+		since := m.since
+		st.Since = &since
+	}
+	return st
+}
+
+// ReadinessCheck fails during maintenance when MAINTENANCE_FAIL_READINESS
+// is set, so orchestrators stop routing traffic to the instance.
+func (m *Mode) ReadinessCheck() error {
+	if m.cfg.FailReadiness && m.Enabled() {
+		return ErrInMaintenance
+	}
+	return nil
+}
+
+// Run watches the maintenance file and the toggle signal until ctx ends.
+func (m *Mode) Run(ctx context.Context) {
+	sig, stop := notifyToggle()
+	defer stop()
+
+	m.checkFile()
+	t := time.NewTicker(m.cfg.PollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.checkFile()
+		case <-sig:
+			m.Toggle(SourceSignal)
+		}
+	}
+}
+
+func (m *Mode) checkFile() {
+	b, err := os.ReadFile(m.path)
+	present := err == nil
+	m.mu.RLock()
+	was := m.sources[SourceFile]
+	m.mu.RUnlock()
+	if present != was {
+		// The file's contents, if any, become the reason shown to clients.
+		m.Set(SourceFile, present, string(bytes.TrimSpace(b)))
+	}
+}
+
+func (m *Mode) retryAfter() string {
+	return strconv.Itoa(int(m.cfg.RetryAfter.Seconds()))
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package maintenance
+
+import "os"
+
+// notifyToggle is a no-op where SIGUSR1 does not exist.
+func notifyToggle() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package maintenance
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyToggle delivers SIGUSR1, e.g. `docker kill -s USR1 <container>`.
+func notifyToggle() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	return ch, func() { signal.Stop(ch) }
+}
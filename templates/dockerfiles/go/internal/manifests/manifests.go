@@ -0,0 +1,398 @@
+// Package manifests generates Kubernetes manifests for the service from
+// what the binary knows about itself: its listeners, probe endpoints,
+// configuration schema and container hardening.
+package manifests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/yamldoc"
+	"gopkg.in/yaml.v3"
+)
+
+// Options tune the generated resources. Zero values fall back to defaults
+// derived from the configuration.
+type Options struct {
+	Name          string
+	Namespace     string
+	Image         string
+	Replicas      int
+	CPURequest    string
+	MemoryRequest string
+	CPULimit      string
+	MemoryLimit   string
+	RunAsUser     int // 65534 for the scratch image, 65532 for distroless
+
+	HPA       bool
+	HPAMin    int
+	HPAMax    int
+	HPATarget int // average CPU utilization percent
+
+	PDB               bool
+	PDBMaxUnavailable string
+
+	// Overlays are YAML files merged into the generated resources.
+	Overlays []string
+}
+
+const secretsDir = "/run/secrets"
+
+// alwaysSecret are secrets the manifests always wire up: the admin token is
+// needed by the preStop drain hook.
+var alwaysSecret = map[string]bool{"ADMIN_TOKEN": true}
+
+// Write generates the manifests and writes them as a YAML stream.
+func Write(w io.Writer, cfg *config.Config, opts Options) error {
+	docs, err := Generate(cfg, opts)
+	if err != nil {
+		return err
+	}
+	return yamldoc.Encode(w, docs...)
+}
+
+// Generate builds ConfigMap, Service, Deployment and, when enabled,
+// PodDisruptionBudget and HorizontalPodAutoscaler, then applies overlays.
+func Generate(cfg *config.Config, opts Options) ([]*yaml.Node, error) {
+	opts = withDefaults(cfg, opts)
+	g := &generator{cfg: cfg, opts: opts, labels: yamldoc.Map(
+		"app.kubernetes.io/name", opts.Name,
+		"app.kubernetes.io/version", cfg.Version,
+	)}
+
+	cm := g.configMap()
+	docs := []*yaml.Node{cm, g.service(), g.deployment(cm)}
+	if opts.PDB {
+		docs = append(docs, g.pdb())
+	}
+	if opts.HPA {
+		docs = append(docs, g.hpa())
+	}
+	docs[0].HeadComment = fmt.Sprintf("Generated by `app manifests` for %s %s.\n"+
+		"Secrets are read from files; create them with:\n"+
+		"  kubectl create secret generic %s-secrets --from-literal=admin_token=$(openssl rand -hex 32)",
+		opts.Name, cfg.Version, opts.Name)
+
+	for _, path := range opts.Overlays {
+		overlays, err := yamldoc.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if docs, err = apply(docs, overlays); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return docs, nil
+}
+
+func withDefaults(cfg *config.Config, o Options) Options {
+	def := func(s *string, v string) {
+		if *s == "" {
+			*s = v
+		}
+	}
+	def(&o.Name, cfg.ServiceName)
+	def(&o.Image, cfg.ServiceName+":"+cfg.Version)
+	def(&o.CPURequest, "50m")
+	def(&o.MemoryRequest, "32Mi")
+	def(&o.MemoryLimit, "128Mi")
+	def(&o.PDBMaxUnavailable, "1")
+	if o.RunAsUser == 0 {
+		o.RunAsUser = 65534
+	}
+	if o.Replicas == 0 {
+		o.Replicas = 2
+	}
+	if o.HPAMin == 0 {
+		o.HPAMin = o.Replicas
+	}
+	if o.HPAMax == 0 {
+		o.HPAMax = max(o.HPAMin, 10)
+	}
+	if o.HPATarget == 0 {
+		o.HPATarget = 70
+	}
+	return o
+}
+
+type generator struct {
+	cfg    *config.Config
+	opts   Options
+	labels *yaml.Node
+}
+
+func (g *generator) metadata(name string) *yaml.Node {
+	var ns any
+	if g.opts.Namespace != "" {
+		ns = g.opts.Namespace
+	}
+	return yamldoc.Map("name", name, "namespace", ns, "labels", clone(g.labels))
+}
+
+func (g *generator) selector() *yaml.Node {
+	return yamldoc.Map("app.kubernetes.io/name", g.opts.Name)
+}
+
+// configVars are the non-secret variables rendered into the ConfigMap.
+// SERVICE_VERSION is left to the image, which has its version baked in.
+func (g *generator) configVars() []config.Var {
+	var out []config.Var
+	for _, v := range config.Vars(g.cfg) {
+		if v.Secret || v.Value == "" || v.Name == "SERVICE_VERSION" {
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// secretVars are wired through NAME_FILE pointing into the secret volume.
+func (g *generator) secretVars() []config.Var {
+	var out []config.Var
+	for _, v := range config.Vars(g.cfg) {
+		if v.Secret && (v.Value != "" || alwaysSecret[v.Name]) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (g *generator) configMap() *yaml.Node {
+	data := yamldoc.Map()
+	for _, v := range g.configVars() {
+		data.Content = append(data.Content, yamldoc.Str(v.Name), yamldoc.Comment(yamldoc.Str(v.Value), v.Description))
+	}
+	return yamldoc.Map(
+		"apiVersion", "v1",
+		"kind", "ConfigMap",
+		"metadata", g.metadata(g.opts.Name+"-config"),
+		"data", data,
+	)
+}
+
+func (g *generator) service() *yaml.Node {
+	return yamldoc.Map(
+		"apiVersion", "v1",
+		"kind", "Service",
+		"metadata", g.metadata(g.opts.Name),
+		"spec", yamldoc.Map(
+			"type", "ClusterIP",
+			"selector", g.selector(),
+			// The admin port is deliberately not part of the Service.
+			"ports", yamldoc.Seq(yamldoc.Map("name", "http", "port", 80, "targetPort", "http", "protocol", "TCP")),
+		),
+	)
+}
+
+func (g *generator) deployment(cm *yaml.Node) *yaml.Node {
+	cfg := g.cfg
+
+	env := yamldoc.Seq()
+	for _, v := range g.configVars() {
+		env.Content = append(env.Content, yamldoc.Map(
+			"name", yamldoc.Comment(yamldoc.Str(v.Name), v.Description),
+			"valueFrom", yamldoc.Map("configMapKeyRef", yamldoc.Map("name", g.opts.Name+"-config", "key", v.Name)),
+		))
+	}
+	for _, v := range g.secretVars() {
+		env.Content = append(env.Content, yamldoc.Map(
+			"name", yamldoc.Comment(yamldoc.Str(v.Name+"_FILE"), v.Description),
+			"value", secretsDir+"/"+strings.ToLower(v.Name),
+		))
+	}
+	env.Content = append(env.Content, yamldoc.Map(
+		"name", yamldoc.Comment(yamldoc.Str("GOMEMLIMIT"), "Lets the Go GC respect the container memory limit"),
+		"valueFrom", yamldoc.Map("resourceFieldRef", yamldoc.Map("resource", "limits.memory")),
+	))
+
+	ports := yamldoc.Seq(
+		yamldoc.Map("name", "http", "containerPort", atoi(cfg.Port), "protocol", "TCP"),
+		yamldoc.Map("name", "admin", "containerPort", atoi(cfg.Admin.Port), "protocol", "TCP"),
+	)
+
+	limits := yamldoc.Map("memory", g.opts.MemoryLimit)
+	if g.opts.CPULimit != "" {
+		limits = yamldoc.Map("cpu", g.opts.CPULimit, "memory", g.opts.MemoryLimit)
+	}
+
+	container := yamldoc.Map(
+		"name", "app",
+		"image", g.opts.Image,
+		"imagePullPolicy", "IfNotPresent",
+		"ports", ports,
+		"env", env,
+		"resources", yamldoc.Map(
+			"requests", yamldoc.Map("cpu", g.opts.CPURequest, "memory", g.opts.MemoryRequest),
+			"limits", limits,
+		),
+		"startupProbe", probe("/health", 1, 30),
+		"livenessProbe", probe("/health", 10, 3),
+		"readinessProbe", probe("/ready", 5, 2),
+		"lifecycle", yamldoc.Map("preStop", yamldoc.Map("exec", yamldoc.Map("command", []string{"/app", "drain"}))),
+		"securityContext", yamldoc.Map(
+			"runAsNonRoot", true,
+			"runAsUser", g.opts.RunAsUser,
+			"runAsGroup", g.opts.RunAsUser,
+			"readOnlyRootFilesystem", true,
+			"allowPrivilegeEscalation", false,
+			"capabilities", yamldoc.Map("drop", []string{"ALL"}),
+		),
+		"volumeMounts", yamldoc.Seq(
+			yamldoc.Map("name", "data", "mountPath", cfg.DataDir),
+			yamldoc.Map("name", "tmp", "mountPath", "/tmp"),
+			yamldoc.Map("name", "secrets", "mountPath", secretsDir, "readOnly", true),
+		),
+	)
+
+	// Give the preStop drain time to finish before SIGKILL.
+	grace := int(math.Ceil((cfg.Drain.Delay + cfg.Drain.Timeout).Seconds())) + 10
+
+	var replicas any = g.opts.Replicas
+	if g.opts.HPA {
+		replicas = nil // owned by the HorizontalPodAutoscaler
+	}
+
+	return yamldoc.Map(
+		"apiVersion", "apps/v1",
+		"kind", "Deployment",
+		"metadata", g.metadata(g.opts.Name),
+		"spec", yamldoc.Map(
+			"replicas", replicas,
+			"selector", yamldoc.Map("matchLabels", g.selector()),
+			"strategy", yamldoc.Map("type", "RollingUpdate", "rollingUpdate", yamldoc.Map("maxSurge", 1, "maxUnavailable", 0)),
+			"template", yamldoc.Map(
+				"metadata", yamldoc.Map(
+					"labels", clone(g.labels),
+					"annotations", yamldoc.Map(
+						"prometheus.io/scrape", "true",
+						"prometheus.io/port", cfg.Port,
+						"prometheus.io/path", "/metrics",
+						"checksum/config", checksum(cm),
+					),
+				),
+				"spec", yamldoc.Map(
+					"automountServiceAccountToken", false,
+					"terminationGracePeriodSeconds", grace,
+					"securityContext", yamldoc.Map(
+						"runAsNonRoot", true,
+						"fsGroup", g.opts.RunAsUser,
+						"seccompProfile", yamldoc.Map("type", "RuntimeDefault"),
+					),
+					"containers", yamldoc.Seq(container),
+					"volumes", yamldoc.Seq(
+						yamldoc.Map("name", "data", "emptyDir", yamldoc.Map()),
+						yamldoc.Map("name", "tmp", "emptyDir", yamldoc.Map("medium", "Memory", "sizeLimit", "16Mi")),
+						yamldoc.Map("name", "secrets", "secret", yamldoc.Map("secretName", g.opts.Name+"-secrets")),
+					),
+				),
+			),
+		),
+	)
+}
+
+func (g *generator) pdb() *yaml.Node {
+	return yamldoc.Map(
+		"apiVersion", "policy/v1",
+		"kind", "PodDisruptionBudget",
+		"metadata", g.metadata(g.opts.Name),
+		"spec", yamldoc.Map(
+			"maxUnavailable", intOrString(g.opts.PDBMaxUnavailable),
+			"selector", yamldoc.Map("matchLabels", g.selector()),
+		),
+	)
+}
+
+func (g *generator) hpa() *yaml.Node {
+	return yamldoc.Map(
+		"apiVersion", "autoscaling/v2",
+		"kind", "HorizontalPodAutoscaler",
+		"metadata", g.metadata(g.opts.Name),
+		"spec", yamldoc.Map(
+			"scaleTargetRef", yamldoc.Map("apiVersion", "apps/v1", "kind", "Deployment", "name", g.opts.Name),
+			"minReplicas", g.opts.HPAMin,
+			"maxReplicas", g.opts.HPAMax,
+			"metrics", yamldoc.Seq(yamldoc.Map(
+				"type", "Resource",
+				"resource", yamldoc.Map(
+					"name", "cpu",
+					"target", yamldoc.Map("type", "Utilization", "averageUtilization", g.opts.HPATarget),
+				),
+			)),
+		),
+	)
+}
+
+func probe(path string, period, failures int) *yaml.Node {
+	return yamldoc.Map(
+		"httpGet", yamldoc.Map("path", path, "port", "http"),
+		"periodSeconds", period,
+		"timeoutSeconds", 2,
+		"failureThreshold", failures,
+	)
+}
+
+// apply merges each overlay document into the generated document with the
+// same kind (and metadata.name, if the overlay sets one). Overlay documents
+// matching nothing are appended as additional resources.
+func apply(docs, overlays []*yaml.Node) ([]*yaml.Node, error) {
+	for _, o := range overlays {
+		kind := yamldoc.Get(o, "kind")
+		if kind == nil {
+			return nil, fmt.Errorf("overlay document without kind")
+		}
+		name := yamldoc.Get(o, "metadata", "name")
+		matched := false
+		for _, d := range docs {
+			if yamldoc.Get(d, "kind").Value != kind.Value {
+				continue
+			}
+			if name != nil && yamldoc.Get(d, "metadata", "name").Value != name.Value {
+				continue
+			}
+			yamldoc.Merge(d, o)
+			matched = true
+		}
+		if !matched {
+			docs = append(docs, o)
+		}
+	}
+	return docs, nil
+}
+
+func clone(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = clone(child)
+	}
+	return &c
+}
+
+func checksum(n *yaml.Node) string {
+	b, _ := yaml.Marshal(n)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func intOrString(s string) any {
+	if n := atoi(s); fmt.Sprint(n) == s {
+		return n
+	}
+	return s
+}
+
+func atoi(s string) int {
+	n := 0
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n
+}
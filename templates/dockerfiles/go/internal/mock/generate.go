@@ -0,0 +1,264 @@
+package mock
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDepth bounds generation in deeply nested schemas.
+const maxDepth = 8
+
+// example picks the body for a media type: the named example if asked for,
+// else the media type's own example or its first named one, else a value
+// generated from the schema. fromSchema skips the examples.
+func (s *Spec) example(media map[string]any, name string, fromSchema bool) (any, error) {
+	examples := s.obj(media["examples"])
+	if name != "" {
+		e, ok := examples[name]
+		if !ok {
+			return nil, fmt.Errorf("no example %q, have: %s", name, strings.Join(s.keys(examples), ", "))
+		}
+		return s.obj(e)["value"], nil
+	}
+	if !fromSchema {
+		if v, ok := media["example"]; ok {
+			return v, nil
+		}
+		if keys := s.keys(examples); len(keys) > 0 {
+			return s.obj(examples[keys[0]])["value"], nil
+		}
+	}
+	return s.generate(media["schema"], fromSchema), nil
+}
+
+func (s *Spec) generate(schema any, skipExamples bool) any {
+	g := &generator{spec: s, skipExamples: skipExamples, inside: map[string]bool{}}
+	return g.value(schema, 0)
+}
+
+// generator builds values matching a schema. Values are deterministic, so
+// clients see the same response every time.
+type generator struct {
+	spec         *Spec
+	skipExamples bool
+	inside       map[string]bool // $refs being generated, to cut recursion
+}
+
+func (g *generator) value(raw any, depth int) any {
+	if ref := refOf(raw); ref != "" {
+		if g.inside[ref] {
+			return nil
+		}
+		g.inside[ref] = true
+		defer delete(g.inside, ref)
+	}
+	schema := g.spec.obj(raw)
+	if schema == nil || depth > maxDepth {
+		return nil
+	}
+	if !g.skipExamples {
+		if v, ok := schema["example"]; ok {
+			return v
+		}
+		if list, _ := schema["examples"].([]any); len(list) > 0 {
+			return list[0]
+		}
+	}
+	if v, ok := schema["default"]; ok {
+		return v
+	}
+	if v, ok := schema["const"]; ok {
+		return v
+	}
+	if enum, _ := schema["enum"].([]any); len(enum) > 0 {
+		return enum[0]
+	}
+	if _, ok := schema["allOf"]; ok {
+		return g.value(g.spec.mergeAllOf(schema), depth)
+	}
+	for _, k := range []string{"oneOf", "anyOf"} {
+		if alts, _ := schema[k].([]any); len(alts) > 0 {
+			return g.value(alts[0], depth+1)
+		}
+	}
+
+	switch typeOf(schema) {
+	case "object":
+		out := map[string]any{}
+		props := g.spec.obj(schema["properties"])
+		for name, p := range props {
+			if wo, _ := g.spec.obj(p)["writeOnly"].(bool); wo {
+				continue
+			}
+			// Optional properties that would recurse are left out.
+			if ref := refOf(p); ref != "" && g.inside[ref] && !required(schema, name) {
+				continue
+			}
+			out[name] = g.value(p, depth+1)
+		}
+		if extra, ok := schema["additionalProperties"].(map[string]any); ok && len(props) == 0 {
+			out["key"] = g.value(extra, depth+1)
+		}
+		return out
+	case "array":
+		n := max(1, int(number(schema["minItems"])))
+		item := g.value(schema["items"], depth+1)
+		out := make([]any, n)
+		for i := range out {
+			out[i] = item
+		}
+		return out
+	case "string":
+		return sampleString(schema)
+	case "integer":
+		return int(bound(schema, 1))
+	case "number":
+		return bound(schema, 0.5)
+	case "boolean":
+		return true
+	}
+	return nil
+}
+
+func refOf(v any) string {
+	m, _ := v.(map[string]any)
+	ref, _ := m["$ref"].(string)
+	return ref
+}
+
+func required(schema map[string]any, name string) bool {
+	list, _ := schema["required"].([]any)
+	for _, r := range list {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeAllOf folds the allOf parts into one schema.
+func (s *Spec) mergeAllOf(schema map[string]any) map[string]any {
+	out := map[string]any{}
+	props := map[string]any{}
+	var required []any
+	parts := []map[string]any{schema}
+	list, _ := schema["allOf"].([]any)
+	for _, p := range list {
+		parts = append(parts, s.obj(p))
+	}
+	for i, p := range parts {
+		if i > 0 && p["allOf"] != nil {
+			p = s.mergeAllOf(p)
+		}
+		for k, v := range p {
+			switch k {
+			case "allOf":
+			case "properties":
+				for name, ps := range s.obj(v) {
+					props[name] = ps
+				}
+			case "required":
+				r, _ := v.([]any)
+				required = append(required, r...)
+			default:
+				out[k] = v
+			}
+		}
+	}
+	if len(props) > 0 {
+		out["properties"] = props
+		if out["type"] == nil {
+			out["type"] = "object"
+		}
+	}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// typeOf returns the schema's type, inferring it when absent. OpenAPI 3.1
+// type lists yield their first non-null entry.
+func typeOf(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, e := range t {
+			if s, _ := e.(string); s != "null" {
+				return s
+			}
+		}
+	}
+	switch {
+	case schema["properties"] != nil || schema["additionalProperties"] != nil:
+		return "object"
+	case schema["items"] != nil:
+		return "array"
+	}
+	return ""
+}
+
+func sampleString(schema map[string]any) string {
+	format, _ := schema["format"].(string)
+	v, ok := map[string]string{
+		"date-time": "2024-01-01T12:00:00Z",
+		"date":      "2024-01-01",
+		"time":      "12:00:00",
+		"email":     "user@example.com",
+		"uuid":      "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+		"uri":       "https://example.com",
+		"url":       "https://example.com",
+		"hostname":  "example.com",
+		"ipv4":      "192.0.2.1",
+		"ipv6":      "2001:db8::1",
+		"byte":      "ZXhhbXBsZQ==",
+		"password":  "********",
+	}[format]
+	if !ok {
+		v = "string"
+	}
+	if n := int(number(schema["minLength"])); len(v) < n {
+		v += strings.Repeat("x", n-len(v))
+	}
+	if n, ok := schema["maxLength"]; ok && len(v) > int(number(n)) {
+		v = v[:int(number(n))]
+	}
+	return v
+}
+
+// bound returns the smallest value allowed by minimum, or 0.
+func bound(schema map[string]any, step float64) float64 {
+	if v, ok := schema["exclusiveMinimum"]; ok {
+		if _, legacy := v.(bool); !legacy {
+			return number(v) + step // OpenAPI 3.1
+		}
+	}
+	v, ok := schema["minimum"]
+	if !ok {
+		if m, ok := schema["maximum"]; ok && number(m) < 0 {
+			return number(m)
+		}
+		return 0
+	}
+	n := number(v)
+	if ex, _ := schema["exclusiveMinimum"].(bool); ex {
+		n += step
+	}
+	return n
+}
+
+// number converts the numeric types produced by YAML and JSON decoding.
+func number(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
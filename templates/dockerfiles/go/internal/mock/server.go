@@ -0,0 +1,261 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/problem"
+	"github.com/example/app/internal/telemetry"
+	"github.com/gorilla/mux"
+)
+
+// ScenarioHeader lets clients choose how the mock answers, as
+// comma-separated key=value pairs:
+//
+//	status=404      answer with the documented 404 response
+//	example=empty   use the named example of the response
+//	delay=2s        wait before answering
+//	generate=true   build the body from the schema, ignoring examples
+//
+// A bare status code or duration also works: "X-Mock-Scenario: 404".
+// Requests forcing a status are not validated.
+const ScenarioHeader = "X-Mock-Scenario"
+
+// Options control the mock server.
+type Options struct {
+	Validate bool // answer 400 to requests that don't match the document
+}
+
+// Server answers the operations of a Spec.
+type Server struct {
+	spec *Spec
+	opts Options
+}
+
+func New(spec *Spec, opts Options) *Server {
+	return &Server{spec: spec, opts: opts}
+}
+
+// Register mounts every operation on r under the document's base path.
+// Paths and methods that aren't documented get problem responses.
+func (m *Server) Register(r *mux.Router) {
+	base := m.spec.BasePath()
+	for _, op := range m.spec.Operations {
+		r.Handle(base+op.Path, m.handler(op)).Methods(op.Method)
+	}
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, http.StatusNotFound, "no operation is documented for "+r.URL.Path)
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, http.StatusMethodNotAllowed, r.Method+" is not documented for "+r.URL.Path)
+	})
+}
+
+type scenario struct {
+	status   int
+	example  string
+	delay    time.Duration
+	generate bool
+}
+
+func parseScenario(h string) (scenario, error) {
+	var sc scenario
+	for _, part := range strings.Split(h, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			// Bare status code or delay.
+			if _, err := strconv.Atoi(part); err == nil {
+				key, value = "status", part
+			} else {
+				key, value = "delay", part
+			}
+		}
+		var err error
+		switch strings.TrimSpace(key) {
+		case "status":
+			sc.status, err = strconv.Atoi(value)
+			if err == nil && (sc.status < 100 || sc.status > 599) {
+				err = fmt.Errorf("out of range")
+			}
+		case "example":
+			sc.example = value
+		case "delay":
+			sc.delay, err = time.ParseDuration(value)
+		case "generate":
+			sc.generate, err = strconv.ParseBool(value)
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return scenario{}, fmt.Errorf("%s %q: %v", ScenarioHeader, part, err)
+		}
+	}
+	return sc, nil
+}
+
+func (m *Server) handler(op *Operation) http.Handler {
+	name := op.ID
+	if name == "" {
+		name = op.Method + " " + op.Path
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		telemetry.AddLogAttrs(r.Context(), slog.String("operation", name))
+		sc, err := parseScenario(r.Header.Get(ScenarioHeader))
+		if err != nil {
+			problem.Write(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if m.opts.Validate && sc.status == 0 {
+			if status, errs := m.spec.validateRequest(op, r); status != 0 {
+				problem.Write(w, status, strings.Join(errs, "; "))
+				return
+			}
+		}
+		if sc.delay > 0 {
+			select {
+			case <-time.After(sc.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		code, resp, ok := op.response(sc.status)
+		if !ok {
+			// Forced statuses work even when the document doesn't list them.
+			problem.Write(w, sc.status, "mock scenario: status "+strconv.Itoa(sc.status)+" is not documented for "+name)
+			return
+		}
+		m.write(w, r, code, m.spec.obj(resp), sc)
+	})
+}
+
+// response picks the documented response for want, or the success
+// response when want is 0: the lowest 2xx code, then 2XX, then default.
+func (op *Operation) response(want int) (int, any, bool) {
+	if want != 0 {
+		for _, key := range []string{strconv.Itoa(want), strconv.Itoa(want/100) + "XX", "default"} {
+			if r, ok := op.responses[key]; ok {
+				return want, r, true
+			}
+		}
+		return 0, nil, false
+	}
+	var codes []int
+	for key := range op.responses {
+		if c, err := strconv.Atoi(key); err == nil {
+			codes = append(codes, c)
+		}
+	}
+	sort.Ints(codes)
+	for _, c := range codes {
+		if c >= 200 && c < 300 {
+			return c, op.responses[strconv.Itoa(c)], true
+		}
+	}
+	for _, key := range []string{"2XX", "default"} {
+		if r, ok := op.responses[key]; ok {
+			return http.StatusOK, r, true
+		}
+	}
+	if len(codes) > 0 {
+		return codes[0], op.responses[strconv.Itoa(codes[0])], true
+	}
+	return http.StatusNoContent, nil, true
+}
+
+func (m *Server) write(w http.ResponseWriter, r *http.Request, code int, resp map[string]any, sc scenario) {
+	for name, raw := range m.spec.obj(resp["headers"]) {
+		h := m.spec.obj(raw)
+		v, ok := h["example"]
+		if !ok {
+			v = m.spec.generate(h["schema"], false)
+		}
+		if v != nil {
+			w.Header().Set(name, fmt.Sprint(v))
+		}
+	}
+	content := m.spec.obj(resp["content"])
+	if len(content) == 0 {
+		w.WriteHeader(code)
+		return
+	}
+	mt := negotiate(content, r.Header.Get("Accept"))
+	body, err := m.spec.example(m.spec.obj(content[mt]), sc.example, sc.generate)
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, "mock scenario: "+err.Error())
+		return
+	}
+
+	ct, _, _ := mime.ParseMediaType(mt)
+	if strings.Contains(ct, "*") {
+		ct, mt = "application/json", "application/json"
+	}
+	w.Header().Set("Content-Type", mt)
+	w.WriteHeader(code)
+	if s, ok := body.(string); ok && !isJSON(ct) {
+		io.WriteString(w, s)
+		return
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+// negotiate picks the documented media type the client accepts, preferring
+// JSON when it accepts anything.
+func negotiate(content map[string]any, accept string) string {
+	keys := sortedKeys(content)
+	fallback := keys[0]
+	for _, k := range keys {
+		if base, _, _ := mime.ParseMediaType(k); isJSON(base) {
+			fallback = k
+			break
+		}
+	}
+	for _, a := range strings.Split(accept, ",") {
+		want, _, err := mime.ParseMediaType(strings.TrimSpace(a))
+		if err != nil || want == "*/*" {
+			continue
+		}
+		for _, k := range keys {
+			base, _, _ := mime.ParseMediaType(k)
+			if base == want || (strings.HasSuffix(want, "/*") && strings.HasPrefix(base, strings.TrimSuffix(want, "*"))) {
+				return k
+			}
+		}
+	}
+	return fallback
+}
+
+// CORS lets browser applications on other origins call the mock.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+		h.Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+			h.Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,229 @@
+// Package mock serves an API from its OpenAPI 3 description, so clients can
+// be built against it before the handlers exist. Every operation answers
+// with the examples from the document, or with a value generated from the
+// response schema where there are none, and requests are checked against
+// the documented parameters and body.
+package mock
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is a loaded OpenAPI document.
+type Spec struct {
+	Title      string
+	Version    string
+	Operations []*Operation
+
+	doc   map[string]any
+	order map[uintptr][]string // key order of the document's mappings
+}
+
+// Operation is one method on one path.
+type Operation struct {
+	Method string
+	Path   string // OpenAPI template, e.g. /pets/{petId}
+	ID     string
+
+	params    []param
+	body      map[string]any // requestBody; nil when there is none
+	responses map[string]any
+}
+
+type param struct {
+	name     string
+	in       string // path, query, header, cookie
+	required bool
+	schema   map[string]any
+}
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// maxRefs bounds how many $ref hops are followed before giving up on a
+// reference loop.
+const maxRefs = 32
+
+// Load reads an OpenAPI 3 document in YAML or JSON.
+func Load(path string) (*Spec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("mock: %w", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return nil, fmt.Errorf("mock: %s: %w", path, err)
+	}
+	s := &Spec{order: map[uintptr][]string{}}
+	doc, _ := s.decode(&root).(map[string]any)
+	if v, _ := doc["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		return nil, fmt.Errorf("mock: %s: not an OpenAPI 3 document", path)
+	}
+	s.doc = doc
+	info := s.obj(doc["info"])
+	s.Title, _ = info["title"].(string)
+	s.Version, _ = info["version"].(string)
+
+	paths := s.obj(doc["paths"])
+	for _, p := range sortedKeys(paths) {
+		item := s.obj(paths[p])
+		shared := s.params(item["parameters"], nil)
+		for _, m := range methods {
+			raw, ok := item[m]
+			if !ok {
+				continue
+			}
+			op := s.obj(raw)
+			o := &Operation{
+				Method:    strings.ToUpper(m),
+				Path:      p,
+				params:    s.params(op["parameters"], shared),
+				responses: s.obj(op["responses"]),
+			}
+			o.ID, _ = op["operationId"].(string)
+			if _, ok := op["requestBody"]; ok {
+				o.body = s.obj(op["requestBody"])
+			}
+			s.Operations = append(s.Operations, o)
+		}
+	}
+	if len(s.Operations) == 0 {
+		return nil, fmt.Errorf("mock: %s: document has no operations", path)
+	}
+	// Literal segments before templates, so /pets/mine wins over /pets/{id}.
+	sort.SliceStable(s.Operations, func(i, j int) bool {
+		return strings.Count(s.Operations[i].Path, "{") < strings.Count(s.Operations[j].Path, "{")
+	})
+	return s, nil
+}
+
+// BasePath is the path of the first server URL, under which the document's
+// paths are served.
+func (s *Spec) BasePath() string {
+	servers, _ := s.doc["servers"].([]any)
+	if len(servers) == 0 {
+		return ""
+	}
+	raw, _ := s.obj(servers[0])["url"].(string)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(u.Path, "/")
+}
+
+// params resolves a parameter list; entries override those in inherited
+// with the same name and location.
+func (s *Spec) params(v any, inherited []param) []param {
+	out := append([]param(nil), inherited...)
+	list, _ := v.([]any)
+	for _, raw := range list {
+		p := s.obj(raw)
+		name, _ := p["name"].(string)
+		in, _ := p["in"].(string)
+		required, _ := p["required"].(bool)
+		np := param{name: name, in: in, required: required || in == "path", schema: s.obj(p["schema"])}
+		replaced := false
+		for i := range out {
+			if out[i].name == name && out[i].in == in {
+				out[i], replaced = np, true
+			}
+		}
+		if !replaced {
+			out = append(out, np)
+		}
+	}
+	return out
+}
+
+// obj returns v as an object, following $ref pointers into the document.
+// Anything else yields nil.
+func (s *Spec) obj(v any) map[string]any {
+	for i := 0; i < maxRefs; i++ {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		v = s.resolve(ref)
+	}
+	return nil
+}
+
+// resolve looks up a local JSON pointer such as #/components/schemas/Pet.
+func (s *Spec) resolve(ref string) any {
+	ptr, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+	var cur any = s.doc
+	for _, tok := range strings.Split(ptr, "/") {
+		tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[tok]
+	}
+	return cur
+}
+
+// decode converts a YAML (or JSON) node tree into plain values. It
+// remembers the key order of every mapping, which Go maps lose, so "the
+// first example" means the first one in the document.
+func (s *Spec) decode(n *yaml.Node) any {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return s.decode(n.Content[0])
+	case yaml.AliasNode:
+		return s.decode(n.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]any, len(n.Content)/2)
+		keys := make([]string, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i].Value
+			m[k] = s.decode(n.Content[i+1])
+			keys = append(keys, k)
+		}
+		s.order[reflect.ValueOf(m).Pointer()] = keys
+		return m
+	case yaml.SequenceNode:
+		list := make([]any, len(n.Content))
+		for i, c := range n.Content {
+			list[i] = s.decode(c)
+		}
+		return list
+	}
+	var v any
+	n.Decode(&v)
+	return v
+}
+
+// keys returns the keys of a document mapping in document order.
+func (s *Spec) keys(m map[string]any) []string {
+	if keys, ok := s.order[reflect.ValueOf(m).Pointer()]; ok && len(keys) == len(m) {
+		return keys
+	}
+	return sortedKeys(m)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
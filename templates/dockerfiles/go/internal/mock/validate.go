@@ -0,0 +1,366 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// maxBody bounds the request bodies read for validation.
+const maxBody = 10 << 20
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validateRequest checks r against the operation's parameters and request
+// body. It returns the status to answer with and what is wrong; status is
+// 0 when the request is valid.
+func (s *Spec) validateRequest(op *Operation, r *http.Request) (int, []string) {
+	var errs []string
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	for _, p := range op.params {
+		var values []string
+		switch p.in {
+		case "path":
+			values = []string{vars[p.name]}
+		case "query":
+			values = query[p.name]
+		case "header":
+			values = r.Header.Values(p.name)
+		case "cookie":
+			if c, err := r.Cookie(p.name); err == nil {
+				values = []string{c.Value}
+			}
+		}
+		where := p.in + " parameter " + p.name
+		if len(values) == 0 {
+			if p.required {
+				errs = append(errs, where+": is required")
+			}
+			continue
+		}
+		v, err := s.coerce(p.schema, values)
+		if err != nil {
+			errs = append(errs, where+": "+err.Error())
+			continue
+		}
+		s.validate(p.schema, v, where, &errs, 0)
+	}
+
+	if op.body == nil {
+		return status(errs), errs
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		return http.StatusBadRequest, append(errs, "request body: "+err.Error())
+	}
+	if len(body) == 0 {
+		if required, _ := op.body["required"].(bool); required {
+			errs = append(errs, "request body: is required")
+		}
+		return status(errs), errs
+	}
+
+	content := s.obj(op.body["content"])
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	media, ok := matchMedia(content, ct)
+	if !ok {
+		return http.StatusUnsupportedMediaType, []string{fmt.Sprintf("content type %q is not accepted, want one of: %s", ct, strings.Join(sortedKeys(content), ", "))}
+	}
+	if isJSON(ct) {
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return http.StatusBadRequest, append(errs, "request body: invalid JSON: "+err.Error())
+		}
+		s.validate(s.obj(s.obj(media)["schema"]), v, "body $", &errs, 0)
+	}
+	return status(errs), errs
+}
+
+func status(errs []string) int {
+	if len(errs) > 0 {
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+// coerce converts parameter strings to the schema's type.
+func (s *Spec) coerce(schema map[string]any, values []string) (any, error) {
+	if typeOf(schema) == "array" {
+		// Accept both ?id=1&id=2 and ?id=1,2.
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		items := s.obj(schema["items"])
+		out := make([]any, len(values))
+		for i, v := range values {
+			c, err := s.coerce(items, []string{v})
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+	v := values[0]
+	switch typeOf(schema) {
+	case "integer":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", v)
+		}
+		return float64(n), nil
+	case "number":
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	case "boolean":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", v)
+		}
+		return b, nil
+	}
+	return v, nil
+}
+
+// validate checks a decoded JSON value against schema, appending to errs.
+// readOnly properties are not required, since clients don't send them.
+func (s *Spec) validate(schema map[string]any, v any, path string, errs *[]string, depth int) {
+	if schema == nil || depth > 4*maxDepth {
+		return
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if v == nil {
+		nullable, _ := schema["nullable"].(bool)
+		if !nullable && !allowsNull(schema) && typeOf(schema) != "" {
+			fail("must not be null")
+		}
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !contains(enum, v) {
+		fail("must be one of %v", enum)
+	}
+	if c, ok := schema["const"]; ok && !same(c, v) {
+		fail("must be %v", c)
+	}
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			s.validate(s.obj(sub), v, path, errs, depth+1)
+		}
+	}
+	for _, k := range []string{"oneOf", "anyOf"} {
+		alts, ok := schema[k].([]any)
+		if !ok {
+			continue
+		}
+		matched := 0
+		for _, sub := range alts {
+			var sink []string
+			s.validate(s.obj(sub), v, path, &sink, depth+1)
+			if len(sink) == 0 {
+				matched++
+			}
+		}
+		if matched == 0 {
+			fail("must match one of the %s alternatives", k)
+		} else if k == "oneOf" && matched > 1 {
+			fail("must match exactly one oneOf alternative, matches %d", matched)
+		}
+	}
+
+	switch t := typeOf(schema); t {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		props := s.obj(schema["properties"])
+		required, _ := schema["required"].([]any)
+		for _, r := range required {
+			name, _ := r.(string)
+			if ro, _ := s.obj(props[name])["readOnly"].(bool); ro {
+				continue
+			}
+			if _, ok := obj[name]; !ok {
+				*errs = append(*errs, path+"."+name+": is required")
+			}
+		}
+		for _, name := range sortedKeys(obj) {
+			if p, ok := props[name]; ok {
+				s.validate(s.obj(p), obj[name], path+"."+name, errs, depth+1)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					*errs = append(*errs, path+"."+name+": is not allowed")
+				}
+			case map[string]any:
+				s.validate(s.obj(extra), obj[name], path+"."+name, errs, depth+1)
+			}
+		}
+	case "array":
+		list, ok := v.([]any)
+		if !ok {
+			fail("must be an array")
+			return
+		}
+		if n, ok := schema["minItems"]; ok && len(list) < int(number(n)) {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := schema["maxItems"]; ok && len(list) > int(number(n)) {
+			fail("must have at most %v items", n)
+		}
+		items := s.obj(schema["items"])
+		for i, e := range list {
+			s.validate(items, e, path+"["+strconv.Itoa(i)+"]", errs, depth+1)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		n := utf8.RuneCountInString(str)
+		if m, ok := schema["minLength"]; ok && n < int(number(m)) {
+			fail("must be at least %v characters", m)
+		}
+		if m, ok := schema["maxLength"]; ok && n > int(number(m)) {
+			fail("must be at most %v characters", m)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(str) {
+				fail("must match %s", p)
+			}
+		}
+		if f, _ := schema["format"].(string); !validFormat(f, str) {
+			fail("must be a valid %s", f)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean")
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok {
+			fail("must be a %s", t)
+			return
+		}
+		if t == "integer" && n != math.Trunc(n) {
+			fail("must be an integer")
+		}
+		checkRange(schema, n, fail)
+	}
+}
+
+func checkRange(schema map[string]any, n float64, fail func(string, ...any)) {
+	if m, ok := schema["minimum"]; ok {
+		if ex, _ := schema["exclusiveMinimum"].(bool); ex && n <= number(m) {
+			fail("must be greater than %v", m)
+		} else if n < number(m) {
+			fail("must be at least %v", m)
+		}
+	}
+	if m, ok := schema["maximum"]; ok {
+		if ex, _ := schema["exclusiveMaximum"].(bool); ex && n >= number(m) {
+			fail("must be less than %v", m)
+		} else if n > number(m) {
+			fail("must be at most %v", m)
+		}
+	}
+	// OpenAPI 3.1 numeric exclusive bounds.
+	if m, ok := schema["exclusiveMinimum"]; ok {
+		if _, legacy := m.(bool); !legacy && n <= number(m) {
+			fail("must be greater than %v", m)
+		}
+	}
+	if m, ok := schema["exclusiveMaximum"]; ok {
+		if _, legacy := m.(bool); !legacy && n >= number(m) {
+			fail("must be less than %v", m)
+		}
+	}
+}
+
+func validFormat(format, s string) bool {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, s)
+	case "date":
+		_, err = time.Parse(time.DateOnly, s)
+	case "uuid":
+		return uuidPattern.MatchString(s)
+	case "email":
+		at := strings.LastIndex(s, "@")
+		return at > 0 && at < len(s)-1
+	}
+	return err == nil
+}
+
+func allowsNull(schema map[string]any) bool {
+	list, _ := schema["type"].([]any)
+	for _, t := range list {
+		if t == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []any, v any) bool {
+	for _, e := range list {
+		if same(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// same compares values from the document (YAML) with request values
+// (JSON), which decode numbers differently.
+func same(a, b any) bool {
+	switch a.(type) {
+	case int, int64, uint64, float64:
+		if _, ok := b.(float64); ok {
+			return number(a) == number(b)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// matchMedia finds the media type entry for a request content type,
+// honouring wildcards such as application/* and */*.
+func matchMedia(content map[string]any, ct string) (any, bool) {
+	if len(content) == 0 {
+		return nil, true
+	}
+	major, _, _ := strings.Cut(ct, "/")
+	for _, k := range []string{ct, major + "/*", "*/*"} {
+		if m, ok := content[k]; ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func isJSON(ct string) bool {
+	return ct == "application/json" || strings.HasSuffix(ct, "+json")
+}
@@ -0,0 +1,398 @@
+// Package netdiag serves network troubleshooting endpoints on the admin
+// listener. Scratch and distroless images have no shell, dig, nc or ip, so
+// the binary answers the questions those tools would: what reaches the
+// container, what a name resolves to, whether a port can be reached, and
+// which addresses the container has.
+package netdiag
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+// redacted request headers are echoed without their value.
+var redacted = []string{"Authorization", "Cookie", "Proxy-Authorization", "X-Consul-Token"}
+
+type Diagnostics struct {
+	endpoints map[string]bool
+	timeout   time.Duration
+}
+
+func New(cfg config.DiagnosticsConfig) *Diagnostics {
+	d := &Diagnostics{endpoints: map[string]bool{}, timeout: cfg.DialTimeout}
+	for _, e := range cfg.Endpoints {
+		d.endpoints[e] = true
+	}
+	return d
+}
+
+// RegisterAdmin adds the diagnostic endpoints DIAGNOSTICS lists to the
+// admin router:
+//
+//	ANY /diag/echo                                  the request as the container received it
+//	GET /diag/resolve?host=&type=&server=           DNS lookup (type A, AAAA, CNAME, MX, NS, SRV, TXT, PTR)
+//	GET /diag/dial?addr=host:port&timeout=&tls=     TCP connect, optionally with a TLS handshake
+//	GET /diag/interfaces                            interfaces, addresses, routes and DNS settings
+func (d *Diagnostics) RegisterAdmin(r *mux.Router) {
+	if d.endpoints["echo"] {
+		r.HandleFunc("/diag/echo", d.echo)
+	}
+	if d.endpoints["resolve"] {
+		r.HandleFunc("/diag/resolve", d.resolve).Methods(http.MethodGet)
+	}
+	if d.endpoints["dial"] {
+		r.HandleFunc("/diag/dial", d.dial).Methods(http.MethodGet)
+	}
+	if d.endpoints["interfaces"] {
+		r.HandleFunc("/diag/interfaces", d.interfaces).Methods(http.MethodGet)
+	}
+}
+
+// Echo is the response of /diag/echo.
+type Echo struct {
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Proto      string              `json:"proto"`
+	Host       string              `json:"host"`
+	RemoteAddr string              `json:"remote_addr"`
+	LocalAddr  string              `json:"local_addr,omitempty"`
+	TLS        bool                `json:"tls"`
+	Headers    map[string][]string `json:"headers"`
+	BodyBytes  int64               `json:"body_bytes"`
+}
+
+func (d *Diagnostics) echo(w http.ResponseWriter, r *http.Request) {
+	n, _ := io.Copy(io.Discard, io.LimitReader(r.Body, 1<<20))
+	headers := r.Header.Clone()
+	for _, h := range redacted {
+		if _, ok := headers[h]; ok {
+			headers[h] = []string{"[redacted]"}
+		}
+	}
+	e := Echo{
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Proto:      r.Proto,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		TLS:        r.TLS != nil,
+		Headers:    headers,
+		BodyBytes:  n,
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		e.LocalAddr = addr.String()
+	}
+	admin.WriteJSON(w, http.StatusOK, e)
+}
+
+// Resolution is the response of /diag/resolve.
+type Resolution struct {
+	Host     string   `json:"host"`
+	Type     string   `json:"type"`
+	Server   string   `json:"server"`
+	Records  []string `json:"records"`
+	Duration string   `json:"duration"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (d *Diagnostics) resolve(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	res := Resolution{Host: q.Get("host"), Type: strings.ToUpper(q.Get("type")), Server: q.Get("server"), Records: []string{}}
+	if res.Host == "" {
+		problem.Write(w, http.StatusBadRequest, "host is required")
+		return
+	}
+	if res.Type == "" {
+		res.Type = "ANY"
+	}
+	resolver := net.DefaultResolver
+	if res.Server == "" {
+		res.Server = "system"
+	} else {
+		if _, _, err := net.SplitHostPort(res.Server); err != nil {
+			res.Server = net.JoinHostPort(res.Server, "53")
+		}
+		resolver = serverResolver(res.Server)
+	}
+	timeout, err := d.timeoutParam(q.Get("timeout"))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	start := time.Now()
+	res.Records, err = lookup(ctx, resolver, res.Type, res.Host)
+	res.Duration = time.Since(start).String()
+	status := http.StatusOK
+	if err != nil {
+		res.Error = err.Error()
+		status = http.StatusBadGateway
+	}
+	if res.Records == nil {
+		res.Records = []string{}
+	}
+	admin.WriteJSON(w, status, res)
+}
+
+func lookup(ctx context.Context, resolver *net.Resolver, typ, host string) ([]string, error) {
+	var out []string
+	switch typ {
+	case "ANY":
+		return resolver.LookupHost(ctx, host)
+	case "A", "AAAA":
+		network := "ip4"
+		if typ == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, host)
+		for _, ip := range ips {
+			out = append(out, ip.String())
+		}
+		return out, err
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, host)
+		if cname != "" {
+			out = append(out, cname)
+		}
+		return out, err
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, host)
+		for _, mx := range mxs {
+			out = append(out, strconv.Itoa(int(mx.Pref))+" "+mx.Host)
+		}
+		return out, err
+	case "NS":
+		nss, err := resolver.LookupNS(ctx, host)
+		for _, ns := range nss {
+			out = append(out, ns.Host)
+		}
+		return out, err
+	case "SRV":
+		_, srvs, err := resolver.LookupSRV(ctx, "", "", host)
+		for _, s := range srvs {
+			out = append(out, strings.Join([]string{strconv.Itoa(int(s.Priority)), strconv.Itoa(int(s.Weight)), strconv.Itoa(int(s.Port)), s.Target}, " "))
+		}
+		return out, err
+	case "TXT":
+		return resolver.LookupTXT(ctx, host)
+	case "PTR":
+		return resolver.LookupAddr(ctx, host)
+	}
+	return nil, &net.DNSError{Err: "unsupported record type " + typ, Name: host}
+}
+
+// serverResolver sends every query to server instead of the servers in
+// /etc/resolv.conf.
+func serverResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// DialResult is the response of /diag/dial.
+type DialResult struct {
+	Address  string     `json:"address"`
+	Resolved []string   `json:"resolved,omitempty"`
+	Resolve  string     `json:"resolve_duration,omitempty"`
+	Attempts []Attempt  `json:"attempts"`
+	Local    string     `json:"local_addr,omitempty"`
+	TLS      *TLSResult `json:"tls,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Attempt is one connection attempt to a resolved address.
+type Attempt struct {
+	Address  string `json:"address"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TLSResult describes the handshake and the server's certificate.
+type TLSResult struct {
+	Duration    string     `json:"duration"`
+	Version     string     `json:"version,omitempty"`
+	CipherSuite string     `json:"cipher_suite,omitempty"`
+	ALPN        string     `json:"alpn,omitempty"`
+	Subject     string     `json:"subject,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	DNSNames    []string   `json:"dns_names,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	Verified    bool       `json:"verified"`
+	Error       string     `json:"error,omitempty"`
+}
+
+func (d *Diagnostics) dial(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	addr := q.Get("addr")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, "addr must be host:port")
+		return
+	}
+	timeout, err := d.timeoutParam(q.Get("timeout"))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	res := DialResult{Address: addr, Attempts: []Attempt{}}
+	ips := []string{host}
+	if net.ParseIP(host) == nil {
+		start := time.Now()
+		ips, err = net.DefaultResolver.LookupHost(ctx, host)
+		res.Resolve = time.Since(start).String()
+		res.Resolved = ips
+		if err != nil {
+			res.Error = err.Error()
+			admin.WriteJSON(w, http.StatusBadGateway, res)
+			return
+		}
+	}
+
+	// Each resolved address is tried in turn, like the standard dialer
+	// does, but every attempt is reported.
+	var conn net.Conn
+	var dialer net.Dialer
+	for _, ip := range ips {
+		target := net.JoinHostPort(ip, port)
+		start := time.Now()
+		c, err := dialer.DialContext(ctx, "tcp", target)
+		a := Attempt{Address: target, Duration: time.Since(start).String()}
+		if err != nil {
+			a.Error = err.Error()
+			res.Attempts = append(res.Attempts, a)
+			continue
+		}
+		res.Attempts = append(res.Attempts, a)
+		conn = c
+		break
+	}
+	if conn == nil {
+		res.Error = "no address could be reached"
+		admin.WriteJSON(w, http.StatusBadGateway, res)
+		return
+	}
+	defer conn.Close()
+	res.Local = conn.LocalAddr().String()
+
+	if tlsOn, _ := strconv.ParseBool(q.Get("tls")); tlsOn {
+		res.TLS = handshake(ctx, conn, host)
+		if res.TLS.Error != "" {
+			res.Error = "TLS handshake failed"
+			admin.WriteJSON(w, http.StatusBadGateway, res)
+			return
+		}
+	}
+	admin.WriteJSON(w, http.StatusOK, res)
+}
+
+// handshake runs a TLS handshake without verification, so the certificate
+// can be inspected even when it is wrong, and then verifies it separately.
+func handshake(ctx context.Context, conn net.Conn, host string) *TLSResult {
+	res := &TLSResult{}
+	tc := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true, NextProtos: []string{"h2", "http/1.1"}})
+	start := time.Now()
+	err := tc.HandshakeContext(ctx)
+	res.Duration = time.Since(start).String()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	st := tc.ConnectionState()
+	res.Version = tls.VersionName(st.Version)
+	res.CipherSuite = tls.CipherSuiteName(st.CipherSuite)
+	res.ALPN = st.NegotiatedProtocol
+	if len(st.PeerCertificates) == 0 {
+		return res
+	}
+	leaf := st.PeerCertificates[0]
+	res.Subject = leaf.Subject.String()
+	res.Issuer = leaf.Issuer.String()
+	res.DNSNames = leaf.DNSNames
+	res.NotAfter = &leaf.NotAfter
+	if err := verify(st, host); err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Verified = true
+	}
+	return res
+}
+
+// Interface is one entry of /diag/interfaces.
+type Interface struct {
+	Name         string   `json:"name"`
+	Index        int      `json:"index"`
+	MTU          int      `json:"mtu"`
+	HardwareAddr string   `json:"hardware_addr,omitempty"`
+	Flags        string   `json:"flags"`
+	Addrs        []string `json:"addrs"`
+}
+
+// NetInfo is the response of /diag/interfaces.
+type NetInfo struct {
+	Hostname   string      `json:"hostname"`
+	Interfaces []Interface `json:"interfaces"`
+	Routes     []Route     `json:"routes,omitempty"`
+	DNS        ResolvConf  `json:"dns"`
+}
+
+func (d *Diagnostics) interfaces(w http.ResponseWriter, r *http.Request) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		problem.Write(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	info := NetInfo{Interfaces: []Interface{}, Routes: routes(), DNS: resolvConf()}
+	info.Hostname, _ = os.Hostname()
+	for _, ifc := range ifaces {
+		out := Interface{
+			Name:         ifc.Name,
+			Index:        ifc.Index,
+			MTU:          ifc.MTU,
+			HardwareAddr: ifc.HardwareAddr.String(),
+			Flags:        ifc.Flags.String(),
+			Addrs:        []string{},
+		}
+		addrs, _ := ifc.Addrs()
+		for _, a := range addrs {
+			out.Addrs = append(out.Addrs, a.String())
+		}
+		info.Interfaces = append(info.Interfaces, out)
+	}
+	sort.Slice(info.Interfaces, func(i, j int) bool { return info.Interfaces[i].Index < info.Interfaces[j].Index })
+	admin.WriteJSON(w, http.StatusOK, info)
+}
+
+// timeoutParam parses an optional timeout, bounded by DIAGNOSTICS_TIMEOUT.
+func (d *Diagnostics) timeoutParam(raw string) (time.Duration, error) {
+	if raw == "" {
+		return d.timeout, nil
+	}
+	t, err := time.ParseDuration(raw)
+	if err != nil || t <= 0 {
+		return 0, fmt.Errorf("timeout %q: want a positive duration", raw)
+	}
+	return min(t, d.timeout), nil
+}
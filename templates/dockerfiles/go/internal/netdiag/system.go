@@ -0,0 +1,114 @@
+package netdiag
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Route is an IPv4 routing table entry.
+type Route struct {
+	Interface   string `json:"interface"`
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway"`
+}
+
+// routes reads the IPv4 routing table from /proc/net/route, which holds
+// addresses as hex in host byte order. It is nil outside Linux.
+func routes() []Route {
+	b, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	var out []Route
+	lines := strings.Split(string(b), "\n")
+	for _, line := range lines[1:] {
+		f := strings.Fields(line)
+		if len(f) < 8 {
+			continue
+		}
+		dst, gw, mask := hexIP(f[1]), hexIP(f[2]), hexIP(f[7])
+		if dst == nil || gw == nil || mask == nil {
+			continue
+		}
+		ones, _ := net.IPMask(mask).Size()
+		out = append(out, Route{
+			Interface:   f[0],
+			Destination: dst.String() + "/" + strconv.Itoa(ones),
+			Gateway:     gw.String(),
+		})
+	}
+	return out
+}
+
+func hexIP(s string) net.IP {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil
+	}
+	ip := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(ip, uint32(v))
+	return ip
+}
+
+// ResolvConf is the resolver configuration the container was given.
+type ResolvConf struct {
+	Nameservers []string `json:"nameservers"`
+	Search      []string `json:"search,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	Hosts       []string `json:"hosts,omitempty"`
+}
+
+// resolvConf reads /etc/resolv.conf and /etc/hosts, which Docker and
+// Kubernetes write into every container.
+func resolvConf() ResolvConf {
+	rc := ResolvConf{Nameservers: []string{}}
+	scanConf("/etc/resolv.conf", func(f []string) {
+		switch f[0] {
+		case "nameserver":
+			if len(f) > 1 {
+				rc.Nameservers = append(rc.Nameservers, f[1])
+			}
+		case "search", "domain":
+			rc.Search = append(rc.Search, f[1:]...)
+		case "options":
+			rc.Options = append(rc.Options, f[1:]...)
+		}
+	})
+	scanConf("/etc/hosts", func(f []string) {
+		rc.Hosts = append(rc.Hosts, strings.Join(f, " "))
+	})
+	return rc
+}
+
+// scanConf calls fn with the fields of every non-comment line of path.
+func scanConf(path string, fn func([]string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if fields := strings.Fields(line); len(fields) > 0 {
+			fn(fields)
+		}
+	}
+}
+
+// verify checks the peer certificates against the system roots, as a
+// normal client would.
+func verify(st tls.ConnectionState, host string) error {
+	opts := x509.VerifyOptions{DNSName: host, Intermediates: x509.NewCertPool()}
+	for _, c := range st.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	_, err := st.PeerCertificates[0].Verify(opts)
+	return err
+}
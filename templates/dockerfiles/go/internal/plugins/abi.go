@@ -0,0 +1,129 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// The host module plugins import functions from. Strings are passed as a
+// pointer and length into the plugin's memory. Functions that return a
+// string copy up to cap bytes into buf and return the full length, so a
+// plugin can retry with a larger buffer; -1 means the value is absent.
+//
+//	get_method(buf, cap) len
+//	get_uri(buf, cap) len                        path and query
+//	get_header(name, name_len, buf, cap) len     values joined with ", "
+//	set_header(name, name_len, value, value_len)
+//	remove_header(name, name_len)
+//	add_response_header(name, name_len, value, value_len)
+//	reject(status, message, message_len)         answer with a problem body
+//	get_config(key, key_len, buf, cap) len       from PLUGIN_CONFIG=<plugin>.<key>=value
+//	log(level, message, message_len)             0 debug, 1 info, 2 warn, 3 error
+const hostModule = "http"
+
+// call is the request a plugin is handling, reached by host functions
+// through the context.
+type call struct {
+	plugin     *plugin
+	req        *http.Request
+	respHeader http.Header
+	status     int
+	message    string
+}
+
+type callKey struct{}
+
+func withCall(ctx context.Context, c *call) context.Context {
+	return context.WithValue(ctx, callKey{}, c)
+}
+
+// errNoRequest traps plugins that call request functions outside
+// on_request, e.g. from _initialize.
+var errNoRequest = errors.New("plugins: host function called outside on_request")
+
+func current(ctx context.Context) *call {
+	c, _ := ctx.Value(callKey{}).(*call)
+	if c == nil {
+		panic(errNoRequest)
+	}
+	return c
+}
+
+func exportABI(ctx context.Context, r wazero.Runtime) error {
+	b := r.NewHostModuleBuilder(hostModule)
+	export := func(name string, fn any) {
+		b.NewFunctionBuilder().WithFunc(fn).Export(name)
+	}
+	export("get_method", func(ctx context.Context, m api.Module, buf, size uint32) int32 {
+		return write(m, buf, size, current(ctx).req.Method)
+	})
+	export("get_uri", func(ctx context.Context, m api.Module, buf, size uint32) int32 {
+		return write(m, buf, size, current(ctx).req.URL.RequestURI())
+	})
+	export("get_header", func(ctx context.Context, m api.Module, name, nameLen, buf, size uint32) int32 {
+		values := current(ctx).req.Header.Values(read(m, name, nameLen))
+		if len(values) == 0 {
+			return -1
+		}
+		return write(m, buf, size, strings.Join(values, ", "))
+	})
+	export("set_header", func(ctx context.Context, m api.Module, name, nameLen, value, valueLen uint32) {
+		current(ctx).req.Header.Set(read(m, name, nameLen), read(m, value, valueLen))
+	})
+	export("remove_header", func(ctx context.Context, m api.Module, name, nameLen uint32) {
+		current(ctx).req.Header.Del(read(m, name, nameLen))
+	})
+	export("add_response_header", func(ctx context.Context, m api.Module, name, nameLen, value, valueLen uint32) {
+		current(ctx).respHeader.Add(read(m, name, nameLen), read(m, value, valueLen))
+	})
+	export("reject", func(ctx context.Context, m api.Module, status int32, msg, msgLen uint32) {
+		c := current(ctx)
+		if status < 400 || status > 599 {
+			status = http.StatusForbidden
+		}
+		c.status, c.message = int(status), read(m, msg, msgLen)
+		if c.message == "" {
+			c.message = http.StatusText(c.status)
+		}
+	})
+	export("get_config", func(ctx context.Context, m api.Module, key, keyLen, buf, size uint32) int32 {
+		v, ok := current(ctx).plugin.config[read(m, key, keyLen)]
+		if !ok {
+			return -1
+		}
+		return write(m, buf, size, v)
+	})
+	export("log", func(ctx context.Context, m api.Module, level int32, msg, msgLen uint32) {
+		attrs := []any{}
+		if c, ok := ctx.Value(callKey{}).(*call); ok {
+			attrs = append(attrs, "plugin", c.plugin.name, "path", c.req.URL.Path)
+		}
+		slog.Log(ctx, slog.Level(4*(level-1)), read(m, msg, msgLen), attrs...)
+	})
+	_, err := b.Instantiate(ctx)
+	return err
+}
+
+// read returns a string from the plugin's memory, trapping on an out of
+// range pointer.
+func read(m api.Module, ptr, size uint32) string {
+	b, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(errors.New("plugins: read outside memory"))
+	}
+	return string(b)
+}
+
+func write(m api.Module, buf, size uint32, s string) int32 {
+	n := min(uint32(len(s)), size)
+	if n > 0 && !m.Memory().Write(buf, []byte(s[:n])) {
+		panic(errors.New("plugins: write outside memory"))
+	}
+	return int32(len(s))
+}
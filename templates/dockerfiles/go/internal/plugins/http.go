@@ -0,0 +1,34 @@
+package plugins
+
+import (
+	"net/http"
+
+	"github.com/example/app/internal/admin"
+	"github.com/gorilla/mux"
+)
+
+// Status describes a loaded plugin for the admin API.
+type Status struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Idle   int    `json:"idle_instances"`
+}
+
+// Plugins reports the loaded plugins in the order they run.
+func (h *Host) Plugins() []Status {
+	out := make([]Status, 0, len(h.plugins))
+	for _, p := range h.plugins {
+		out = append(out, Status{Name: p.name, Path: p.path, SHA256: p.sha256, Idle: len(p.idle)})
+	}
+	return out
+}
+
+// RegisterAdmin adds the plugin endpoint to the admin router:
+//
+//	GET /plugins  loaded plugins in the order they run
+func (h *Host) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/plugins", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, h.Plugins())
+	}).Methods(http.MethodGet)
+}
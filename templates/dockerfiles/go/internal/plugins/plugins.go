@@ -0,0 +1,214 @@
+// Package plugins runs WebAssembly modules as middleware on public
+// requests, so platform teams can add request policies without forking
+// the service. Modules run in wazero, a pure-Go runtime, which keeps the
+// binary static with CGO off.
+//
+// A plugin exports on_request, which the host calls once per request. It
+// inspects and changes the request through the functions the host
+// provides in the "http" module (see abi.go), and either lets the request
+// through or rejects it.
+package plugins
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/example/app/internal/telemetry"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	// entry is the function every plugin must export.
+	entry = "on_request"
+	// initTimeout bounds instantiation, which may take longer than a call.
+	initTimeout = time.Second
+)
+
+// Host loads the configured plugins and runs them in order.
+type Host struct {
+	cfg     config.PluginsConfig
+	runtime wazero.Runtime
+	plugins []*plugin
+
+	requests *telemetry.Counter
+	duration *telemetry.Histogram
+}
+
+// plugin is one compiled module with a pool of idle instances. An instance
+// handles one request at a time, so concurrent requests take different ones.
+type plugin struct {
+	name     string
+	path     string
+	sha256   string
+	compiled wazero.CompiledModule
+	config   map[string]string
+	idle     chan api.Module
+}
+
+// New compiles the modules in cfg.Modules and instantiates each once, so a
+// module that is missing, invalid or fails to initialise stops startup.
+func New(ctx context.Context, cfg config.PluginsConfig, reg *telemetry.Registry) (*Host, error) {
+	h := &Host{
+		cfg: cfg,
+		runtime: wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+			WithMemoryLimitPages(uint32(cfg.MemoryLimit)*16). // 64 KiB pages
+			WithCloseOnContextDone(true)),
+		requests: reg.Counter("plugin_requests_total", "Requests handled by each plugin by result (pass, rejected, error, timeout).", "plugin", "result"),
+		duration: reg.Histogram("plugin_duration_seconds", "Time spent in each plugin per request.", nil, "plugin"),
+	}
+	wasi_snapshot_preview1.MustInstantiate(ctx, h.runtime)
+	if err := exportABI(ctx, h.runtime); err != nil {
+		return nil, err
+	}
+	for _, path := range cfg.Modules {
+		p, err := h.load(ctx, path)
+		if err != nil {
+			h.runtime.Close(ctx)
+			return nil, err
+		}
+		h.plugins = append(h.plugins, p)
+		slog.Info("plugin loaded", "plugin", p.name, "path", p.path, "sha256", p.sha256[:12])
+	}
+	return h, nil
+}
+
+func (h *Host) load(ctx context.Context, path string) (*plugin, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(h.cfg.Dir, path)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".wasm")
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("plugins: %w", err)
+	}
+	compiled, err := h.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("plugins: %s: %w", name, err)
+	}
+	if _, ok := compiled.ExportedFunctions()[entry]; !ok {
+		return nil, fmt.Errorf("plugins: %s does not export %s", name, entry)
+	}
+	sum := sha256.Sum256(code)
+	p := &plugin{
+		name:     name,
+		path:     path,
+		sha256:   hex.EncodeToString(sum[:]),
+		compiled: compiled,
+		config:   map[string]string{},
+		idle:     make(chan api.Module, max(h.cfg.Instances, 1)),
+	}
+	for key, value := range h.cfg.Config {
+		if k, ok := strings.CutPrefix(key, name+"."); ok {
+			p.config[k] = value
+		}
+	}
+	m, err := h.instantiate(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("plugins: %s: %w", name, err)
+	}
+	p.idle <- m
+	return p, nil
+}
+
+// instantiate creates an instance, running _initialize for reactor modules
+// such as those built by TinyGo with -buildmode=c-shared.
+func (h *Host) instantiate(ctx context.Context, p *plugin) (api.Module, error) {
+	ctx, cancel := context.WithTimeout(ctx, max(h.cfg.Timeout, initTimeout))
+	defer cancel()
+	return h.runtime.InstantiateModule(ctx, p.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStderr(os.Stderr))
+}
+
+// Middleware runs the plugins in order. The first to reject a request
+// answers it; a plugin that fails or runs out of time answers 500 unless
+// PLUGIN_FAIL_OPEN is set.
+func (h *Host) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := &call{req: r, respHeader: http.Header{}}
+		for _, p := range h.plugins {
+			c.plugin = p
+			err := h.run(r.Context(), p, c)
+			switch {
+			case err != nil:
+				result := "error"
+				if errors.Is(err, context.DeadlineExceeded) {
+					result = "timeout"
+				}
+				h.requests.Inc(p.name, result)
+				slog.Error("plugin failed", "plugin", p.name, "error", err)
+				if h.cfg.FailOpen {
+					continue
+				}
+				problem.Write(w, http.StatusInternalServerError, "request policy failed")
+				return
+			case c.status != 0:
+				h.requests.Inc(p.name, "rejected")
+				copyHeader(w.Header(), c.respHeader)
+				problem.Write(w, c.status, c.message)
+				return
+			}
+			h.requests.Inc(p.name, "pass")
+		}
+		copyHeader(w.Header(), c.respHeader)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// run calls the plugin's entry point on an idle instance. Instances that
+// fail are closed rather than reused, as their state is unknown.
+func (h *Host) run(ctx context.Context, p *plugin, c *call) error {
+	var m api.Module
+	select {
+	case m = <-p.idle:
+	default:
+		var err error
+		if m, err = h.instantiate(ctx, p); err != nil {
+			return err
+		}
+	}
+	defer h.duration.ObserveSince(time.Now(), p.name)
+
+	ctx, cancel := context.WithTimeout(withCall(ctx, c), h.cfg.Timeout)
+	defer cancel()
+	if _, err := m.ExportedFunction(entry).Call(ctx); err != nil {
+		m.Close(context.Background())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %s", context.DeadlineExceeded, h.cfg.Timeout)
+		}
+		return err
+	}
+	select {
+	case p.idle <- m:
+	default:
+		m.Close(ctx)
+	}
+	return nil
+}
+
+// Close releases the runtime and every instance.
+func (h *Host) Close(ctx context.Context) error {
+	return h.runtime.Close(ctx)
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		for _, v := range vs {
+			dst.Add(k, v)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Package problem writes RFC 7807 "problem details" error responses.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Details is an application/problem+json body.
+type Details struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// Write sends a problem response with the given status.
+func Write(w http.ResponseWriter, status int, detail string) {
+	WriteDetails(w, Details{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// WriteDetails sends p as the response body with p.Status as status code.
+func WriteDetails(w http.ResponseWriter, p Details) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
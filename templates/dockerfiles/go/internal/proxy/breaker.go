@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a per-route circuit breaker. After `failures` consecutive
+// failures it opens and rejects requests for `cooldown`; then a single
+// probe is let through, whose outcome closes or reopens it.
+type breaker struct {
+	failures int // 0 disables the breaker
+	cooldown time.Duration
+	onChange func(open bool)
+
+	mu       sync.Mutex
+	count    int
+	openedAt time.Time // zero while closed
+	probing  bool
+}
+
+func newBreaker(failures int, cooldown time.Duration, onChange func(open bool)) *breaker {
+	return &breaker{failures: failures, cooldown: cooldown, onChange: onChange}
+}
+
+func (b *breaker) allow() bool {
+	if b.failures <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) record(failed bool) {
+	if b.failures <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := !b.openedAt.IsZero()
+	b.probing = false
+	if !failed {
+		b.count = 0
+		if wasOpen {
+			b.openedAt = time.Time{}
+			b.onChange(false)
+		}
+		return
+	}
+	b.count++
+	if wasOpen || b.count >= b.failures {
+		b.openedAt = time.Now()
+		if !wasOpen {
+			b.onChange(true)
+		}
+	}
+}
+
+// state reports "closed", "open" or "half-open" (cooled down, waiting for
+// or running a probe).
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.openedAt.IsZero():
+		return "closed"
+	case b.probing || time.Since(b.openedAt) >= b.cooldown:
+		return "half-open"
+	}
+	return "open"
+}
+
+// retryIn is how long until the breaker lets a probe through.
+func (b *breaker) retryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return max(0, b.cooldown-time.Since(b.openedAt))
+}
@@ -0,0 +1,182 @@
+// Package proxy forwards public path prefixes to upstream services, so the
+// binary can front legacy services as a small gateway. Proxied routes are
+// mounted on the public API router and therefore pass through the same
+// authentication, rate limiting, metrics and access log as local handlers.
+//
+// Streaming responses are flushed as they arrive and WebSocket upgrades
+// are passed through.
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/example/app/internal/telemetry"
+	"github.com/gorilla/mux"
+)
+
+// Proxy holds the proxied routes.
+type Proxy struct {
+	cfg    config.ProxyConfig
+	routes []*route // longest prefix first
+}
+
+type route struct {
+	name    string // the prefix, "/" for the root
+	prefix  string
+	target  *url.URL
+	breaker *breaker
+	handler http.Handler
+}
+
+// New parses PROXY_ROUTES. Requests are sent through base, so a target
+// host may name an upstream.
+func New(cfg config.ProxyConfig, base http.RoundTripper, reg *telemetry.Registry) (*Proxy, error) {
+	p := &Proxy{cfg: cfg}
+	retries := reg.Counter("proxy_retries_total", "Proxied requests retried after an upstream failure.", "route")
+	open := reg.Gauge("proxy_breaker_open", "Whether the circuit breaker of a proxied route is open (1) or closed (0).", "route")
+
+	for prefix, raw := range cfg.Routes {
+		if !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("proxy: PROXY_ROUTES prefix %q must start with /", prefix)
+		}
+		target, err := url.Parse(raw)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("proxy: PROXY_ROUTES %s: want an http(s) URL, got %q", prefix, raw)
+		}
+		rt := &route{name: prefix, prefix: strings.TrimSuffix(prefix, "/"), target: target}
+		if rt.prefix != "" {
+			rt.name = rt.prefix
+		}
+		rt.breaker = newBreaker(cfg.BreakerFailures, cfg.BreakerCooldown, func(on bool) {
+			open.Set(boolFloat(on), rt.name)
+			if on {
+				slog.Warn("proxy circuit breaker opened", "route", rt.name, "target", target.Host, "cooldown", cfg.BreakerCooldown)
+			} else {
+				slog.Info("proxy circuit breaker closed", "route", rt.name, "target", target.Host)
+			}
+		})
+		open.Set(0, rt.name)
+		rt.handler = &httputil.ReverseProxy{
+			Rewrite:        p.rewrite(rt),
+			ModifyResponse: p.modifyResponse,
+			ErrorHandler:   p.errorHandler(rt),
+			Transport: &transport{
+				base:    base,
+				route:   rt.name,
+				cfg:     cfg,
+				breaker: rt.breaker,
+				retries: retries,
+			},
+		}
+		p.routes = append(p.routes, rt)
+	}
+	sort.Slice(p.routes, func(i, j int) bool { return len(p.routes[i].prefix) > len(p.routes[j].prefix) })
+	return p, nil
+}
+
+// Register mounts the routes on r. Routes registered on r before take
+// precedence, so the service's own handlers win over a catch-all "/".
+func (p *Proxy) Register(r *mux.Router) {
+	for _, rt := range p.routes {
+		if rt.prefix != "" {
+			r.Path(rt.prefix).Handler(rt.handler)
+		}
+		r.PathPrefix(rt.prefix + "/").Handler(rt.handler)
+	}
+}
+
+// RouteStatus is reported by GET /proxy.
+type RouteStatus struct {
+	Prefix  string `json:"prefix"`
+	Target  string `json:"target"`
+	Breaker string `json:"breaker"`
+}
+
+// RegisterAdmin adds the proxy endpoint to the admin router:
+//
+//	GET /proxy  proxied routes and the state of their circuit breakers
+func (p *Proxy) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/proxy", func(w http.ResponseWriter, r *http.Request) {
+		out := make([]RouteStatus, 0, len(p.routes))
+		for _, rt := range p.routes {
+			out = append(out, RouteStatus{Prefix: rt.name, Target: rt.target.String(), Breaker: rt.breaker.state()})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Prefix < out[j].Prefix })
+		admin.WriteJSON(w, http.StatusOK, out)
+	}).Methods(http.MethodGet)
+}
+
+func (p *Proxy) rewrite(rt *route) func(*httputil.ProxyRequest) {
+	return func(pr *httputil.ProxyRequest) {
+		rest := strings.TrimPrefix(pr.In.URL.Path, rt.prefix)
+		pr.Out.URL.Path = rest
+		pr.Out.URL.RawPath = strings.TrimPrefix(pr.In.URL.RawPath, rt.prefix)
+		pr.SetURL(rt.target)
+		if rest == "" && rt.target.Path != "" {
+			// /legacy goes to /api, not /api/.
+			pr.Out.URL.Path, pr.Out.URL.RawPath = rt.target.Path, rt.target.RawPath
+		}
+		pr.SetXForwarded()
+		if rt.prefix != "" {
+			pr.Out.Header.Set("X-Forwarded-Prefix", rt.prefix)
+		}
+		setHeaders(pr.Out.Header, p.cfg.RequestHeaders)
+	}
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	setHeaders(resp.Header, p.cfg.ResponseHeaders)
+	return nil
+}
+
+func (p *Proxy) errorHandler(rt *route) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		if r.Context().Err() != nil {
+			// The client went away; nobody is left to answer.
+			return
+		}
+		// Details stay in the log; clients only learn what kind of
+		// failure it was.
+		status, detail := http.StatusBadGateway, "the upstream service is unavailable"
+		switch {
+		case errors.Is(err, errBreakerOpen):
+			status, detail = http.StatusServiceUnavailable, "the upstream service is failing; requests are paused"
+			w.Header().Set("Retry-After", retryAfter(rt.breaker.retryIn()))
+		case errors.Is(err, errTimeout), errors.Is(err, context.DeadlineExceeded):
+			status, detail = http.StatusGatewayTimeout, "the upstream service did not respond in time"
+		}
+		if !errors.Is(err, errBreakerOpen) {
+			slog.WarnContext(r.Context(), "proxy request failed", "route", rt.name, "target", rt.target.Host, "err", err)
+		}
+		problem.Write(w, status, detail)
+	}
+}
+
+// setHeaders applies PROXY_*_HEADERS; an empty value removes the header.
+func setHeaders(h http.Header, set map[string]string) {
+	for k, v := range set {
+		if v == "" {
+			h.Del(k)
+		} else {
+			h.Set(k, v)
+		}
+	}
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+var (
+	errBreakerOpen = errors.New("circuit breaker open")
+	errTimeout     = errors.New("timed out waiting for response headers")
+)
+
+// transport adds the response header timeout, retries and the circuit
+// breaker of a route to the base transport.
+type transport struct {
+	base    http.RoundTripper
+	route   string
+	cfg     config.ProxyConfig
+	breaker *breaker
+	retries *telemetry.Counter
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.breaker.allow() {
+		return nil, errBreakerOpen
+	}
+	attempts := 1
+	if retryable(req) {
+		attempts += t.cfg.Retries
+	}
+	backoff := t.cfg.RetryBackoff
+	for i := 1; ; i++ {
+		resp, err := t.attempt(req)
+		failed := err != nil || failure(resp.StatusCode)
+		if !failed || i == attempts || req.Context().Err() != nil {
+			t.breaker.record(failed)
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		t.retries.Inc(t.route)
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			t.breaker.record(true)
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+// attempt sends req once. PROXY_TIMEOUT only bounds the wait for the
+// response headers; once they are in, the body may stream for as long as
+// it takes.
+func (t *transport) attempt(req *http.Request) (*http.Response, error) {
+	if t.cfg.Timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.cfg.Timeout, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, errTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = onClose(resp.Body, cancel)
+	return resp, nil
+}
+
+// retryable reports whether req can safely be sent again: it must be
+// idempotent, have no body to replay and not be a protocol upgrade.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return (req.Body == nil || req.Body == http.NoBody) && req.Header.Get("Upgrade") == ""
+}
+
+// failure reports whether a status means the upstream itself is unwell,
+// as opposed to an error the application chose to return.
+func failure(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// onClose calls hook once the body is closed. The body of a 101 Switching
+// Protocols response is also the connection's writer, which the reverse
+// proxy needs for WebSockets, so that is preserved.
+func onClose(body io.ReadCloser, hook func()) io.ReadCloser {
+	h := &hookBody{ReadCloser: body, hook: hook}
+	if w, ok := body.(io.Writer); ok {
+		return hookRWBody{h, w}
+	}
+	return h
+}
+
+type hookBody struct {
+	io.ReadCloser
+	once sync.Once
+	hook func()
+}
+
+func (b *hookBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.hook)
+	return err
+}
+
+type hookRWBody struct {
+	*hookBody
+	io.Writer
+}
+
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(max(1, int(d.Round(time.Second).Seconds())))
+}
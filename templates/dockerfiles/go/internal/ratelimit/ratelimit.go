@@ -0,0 +1,161 @@
+// Package ratelimit limits the request rate of each client with a token
+// bucket per client key. Requests put in a class, e.g. by a rule, are
+// limited by the class's rate instead, with buckets of their own.
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/auth"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/example/app/internal/telemetry"
+)
+
+// idleAfter is how long an unused bucket is kept. A full bucket carries no
+// state, so anything idle for long enough to refill can be forgotten.
+const idleAfter = 10 * time.Minute
+
+type Limiter struct {
+	cfg      config.RateLimitConfig
+	classes  map[string]limit
+	rejected *telemetry.Counter
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limit is a rate in requests per second and the burst above it.
+type limit struct {
+	rate  float64
+	burst int
+}
+
+func New(cfg config.RateLimitConfig, reg *telemetry.Registry) (*Limiter, error) {
+	l := &Limiter{
+		cfg:      cfg,
+		classes:  map[string]limit{},
+		rejected: reg.Counter("ratelimit_rejected_total", "Public requests rejected for exceeding the per-client rate limit.", "route", "class"),
+		buckets:  map[string]*bucket{},
+		swept:    time.Now(),
+	}
+	for name, raw := range cfg.Classes {
+		rate, burst, _ := strings.Cut(raw, "/")
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("ratelimit: RATE_LIMIT_CLASSES %s: want rate/burst, got %q", name, raw)
+		}
+		c := limit{rate: r, burst: cfg.Burst}
+		if burst != "" {
+			if c.burst, err = strconv.Atoi(burst); err != nil || c.burst < 1 {
+				return nil, fmt.Errorf("ratelimit: RATE_LIMIT_CLASSES %s: want rate/burst, got %q", name, raw)
+			}
+		}
+		l.classes[name] = c
+	}
+	return l, nil
+}
+
+type classKey struct{}
+
+// WithClass puts the request in a rate limit class. Classes not listed in
+// RATE_LIMIT_CLASSES fall back to the default rate.
+func WithClass(ctx context.Context, class string) context.Context {
+	return context.WithValue(ctx, classKey{}, class)
+}
+
+// Middleware answers 429 with Retry-After once a client has used up its
+// burst.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, _ := r.Context().Value(classKey{}).(string)
+		lim, ok := l.classes[class]
+		if !ok {
+			class, lim = "", limit{rate: l.cfg.Rate, burst: l.cfg.Burst}
+		}
+		if lim.rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		wait := l.take(class+"/"+l.key(r), lim)
+		if wait > 0 {
+			l.rejected.Inc(telemetry.RouteName(r), class)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			problem.Write(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// take spends a token of key's bucket, or returns how long until one is
+// available.
+func (l *Limiter) take(key string, lim limit) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > idleAfter {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > idleAfter {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	burst := float64(lim.burst)
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*lim.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / lim.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// key identifies the client by RATE_LIMIT_KEY. Requests without the token
+// or header fall back to the client IP. Tokens and header values are kept
+// as a hash, so the buckets hold no credentials.
+func (l *Limiter) key(r *http.Request) string {
+	switch {
+	case l.cfg.Key == "token":
+		if t, ok := auth.BearerToken(r); ok {
+			return "token:" + hash(t)
+		}
+	case strings.HasPrefix(l.cfg.Key, "header:"):
+		if v := r.Header.Get(strings.TrimPrefix(l.cfg.Key, "header:")); v != "" {
+			return "header:" + hash(v)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:16])
+}
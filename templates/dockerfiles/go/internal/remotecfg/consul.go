@@ -0,0 +1,88 @@
+package remotecfg
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consulKV reads a prefix of Consul's KV store. Watching uses blocking
+// queries, which return as soon as anything below the prefix changes.
+type consulKV struct {
+	base   string
+	prefix string
+	token  string
+	wait   time.Duration
+	http   *http.Client
+}
+
+func newConsulKV(base, prefix, token string, wait time.Duration) *consulKV {
+	// The client timeout must outlast the blocking query's wait; Consul
+	// adds up to wait/16 of jitter.
+	return &consulKV{base: base, prefix: prefix, token: token, wait: wait, http: &http.Client{Timeout: wait + wait/16 + 10*time.Second}}
+}
+
+type kvPair struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"` // base64; empty for folders
+}
+
+func (c *consulKV) list(ctx context.Context) (map[string]string, uint64, error) {
+	return c.get(ctx, url.Values{"recurse": {"true"}})
+}
+
+func (c *consulKV) watch(ctx context.Context, version uint64) error {
+	q := url.Values{"recurse": {"true"}, "index": {strconv.FormatUint(version, 10)}, "wait": {c.wait.String()}}
+	_, _, err := c.get(ctx, q)
+	return err
+}
+
+func (c *consulKV) get(ctx context.Context, q url.Values) (map[string]string, uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/v1/kv/"+c.prefix+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	values := map[string]string{}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// Nothing stored below the prefix yet.
+		io.Copy(io.Discard, resp.Body)
+		return values, index, nil
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, 0, fmt.Errorf("consul: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var pairs []kvPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, 0, err
+	}
+	for _, p := range pairs {
+		name := strings.TrimPrefix(p.Key, c.prefix)
+		if name == "" || strings.Contains(name, "/") {
+			continue // the prefix itself, folders and nested keys
+		}
+		v, err := base64.StdEncoding.DecodeString(p.Value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("consul: %s: %w", p.Key, err)
+		}
+		values[name] = string(v)
+	}
+	return values, index, nil
+}
@@ -0,0 +1,137 @@
+package remotecfg
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etcd reads a prefix through etcd's v3 JSON gateway, so no gRPC client is
+// needed. Watching opens a watch stream from the last revision read.
+type etcd struct {
+	base   string
+	prefix string
+	token  string
+	wait   time.Duration
+	http   *http.Client
+}
+
+func newEtcd(base, prefix, token string, wait time.Duration) *etcd {
+	return &etcd{base: base, prefix: prefix, token: token, wait: wait, http: &http.Client{}}
+}
+
+// rangeEnd is the end of the key range holding every key with the prefix.
+func (e *etcd) rangeEnd() string {
+	end := []byte(e.prefix)
+	end[len(end)-1]++
+	return b64(string(end))
+}
+
+func (e *etcd) list(ctx context.Context) (map[string]string, uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var resp struct {
+		Header struct {
+			Revision string `json:"revision"`
+		} `json:"header"`
+		KVs []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	body := map[string]string{"key": b64(e.prefix), "range_end": e.rangeEnd()}
+	r, err := e.post(ctx, "/v3/kv/range", body)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(&resp); err != nil {
+		return nil, 0, err
+	}
+	values := map[string]string{}
+	for _, kv := range resp.KVs {
+		k, _ := base64.StdEncoding.DecodeString(kv.Key)
+		v, _ := base64.StdEncoding.DecodeString(kv.Value)
+		name := strings.TrimPrefix(string(k), e.prefix)
+		if name != "" && !strings.Contains(name, "/") {
+			values[name] = string(v)
+		}
+	}
+	rev, _ := strconv.ParseUint(resp.Header.Revision, 10, 64)
+	return values, rev, nil
+}
+
+func (e *etcd) watch(ctx context.Context, version uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, e.wait)
+	defer cancel()
+	body := map[string]any{"create_request": map[string]string{
+		"key":            b64(e.prefix),
+		"range_end":      e.rangeEnd(),
+		"start_revision": strconv.FormatUint(version+1, 10),
+	}}
+	r, err := e.post(ctx, "/v3/watch", body)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Result struct {
+				Events   []json.RawMessage `json:"events"`
+				Canceled bool              `json:"canceled"`
+				Reason   string            `json:"cancel_reason"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil // nothing changed within the wait time
+			}
+			return err
+		}
+		switch {
+		case msg.Error != nil:
+			return fmt.Errorf("etcd: watch: %s", msg.Error.Message)
+		case msg.Result.Canceled:
+			// e.g. the start revision was compacted; list again.
+			return nil
+		case len(msg.Result.Events) > 0:
+			return nil
+		}
+	}
+}
+
+func (e *etcd) post(ctx context.Context, path string, body any) (io.ReadCloser, error) {
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.base+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.token != "" {
+		req.Header.Set("Authorization", e.token)
+	}
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("etcd: %s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
+
+func b64(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
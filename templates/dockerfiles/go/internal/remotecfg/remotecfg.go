@@ -0,0 +1,152 @@
+// Package remotecfg reads settings shared by a fleet from a key/value store
+// (Consul KV or etcd) and watches them for changes. Each key below the
+// prefix is a variable name, e.g. config/go-app/LOG_LEVEL, layered under
+// the environment by config.LoadWith.
+//
+// The last values read are cached on disk, so an instance can start with
+// its fleet configuration while the store is unreachable.
+package remotecfg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// store is a key/value backend.
+type store interface {
+	// list returns the values below the prefix and a version to watch from.
+	list(ctx context.Context) (map[string]string, uint64, error)
+	// watch blocks until the values may have changed after version, or
+	// the store's wait time passes.
+	watch(ctx context.Context, version uint64) error
+}
+
+// Source reads and watches the remote values.
+type Source struct {
+	store store
+	url   string // redacted, for logs
+	cache string
+
+	values  map[string]string
+	version uint64
+}
+
+// New returns a source for cfg.URL. The cache path is resolved against
+// dataDir when relative.
+func New(cfg config.RemoteConfig, dataDir string) (*Source, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("remotecfg: invalid REMOTE_CONFIG_URL %q", cfg.URL)
+	}
+	prefix := strings.Trim(u.Path, "/") + "/"
+	scheme := "http"
+	if u.Query().Get("tls") == "true" {
+		scheme = "https"
+	}
+	base := scheme + "://" + u.Host
+
+	s := &Source{url: u.Redacted(), cache: cfg.Cache}
+	if s.cache != "" && !filepath.IsAbs(s.cache) {
+		s.cache = filepath.Join(dataDir, s.cache)
+	}
+	switch u.Scheme {
+	case "consul":
+		s.store = newConsulKV(base, prefix, cfg.Token, cfg.Wait)
+	case "etcd":
+		s.store = newEtcd(base, prefix, cfg.Token, cfg.Wait)
+	default:
+		return nil, fmt.Errorf("remotecfg: unsupported store %q (consul, etcd)", u.Scheme)
+	}
+	return s, nil
+}
+
+// Load reads the current values. When the store can't be reached it falls
+// back to the cached copy; only if there is none does it fail.
+func (s *Source) Load(ctx context.Context) (map[string]string, error) {
+	values, version, err := s.store.list(ctx)
+	if err == nil {
+		s.values, s.version = values, version
+		s.save()
+		slog.Info("remote configuration loaded", "url", s.url, "keys", len(values))
+		return values, nil
+	}
+	cached, cerr := s.load()
+	if cerr != nil {
+		return nil, fmt.Errorf("remotecfg: %s: %w, and no cached copy: %v", s.url, err, cerr)
+	}
+	slog.Warn("remote configuration unavailable, using cached copy", "url", s.url, "error", err, "cache", s.cache, "keys", len(cached))
+	s.values = cached
+	return cached, nil
+}
+
+// Watch calls fn with the new values whenever they change, until ctx ends.
+// Errors are retried with backoff; the last good values stay in effect.
+func (s *Source) Watch(ctx context.Context, fn func(map[string]string)) {
+	retry := time.Second
+	for ctx.Err() == nil {
+		err := s.store.watch(ctx, s.version)
+		var values map[string]string
+		var version uint64
+		if err == nil {
+			values, version, err = s.store.list(ctx)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("remote configuration watch failed", "url", s.url, "error", err, "retry_in", retry)
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+			retry = min(2*retry, time.Minute)
+			continue
+		}
+		retry = time.Second
+		s.version = version
+		if maps.Equal(values, s.values) {
+			continue
+		}
+		s.values = values
+		s.save()
+		fn(values)
+	}
+}
+
+func (s *Source) save() {
+	if s.cache == "" {
+		return
+	}
+	b, _ := json.MarshalIndent(s.values, "", "  ")
+	tmp := s.cache + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		slog.Warn("remote configuration not cached", "cache", s.cache, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, s.cache); err != nil {
+		slog.Warn("remote configuration not cached", "cache", s.cache, "error", err)
+	}
+}
+
+func (s *Source) load() (map[string]string, error) {
+	if s.cache == "" {
+		return nil, fmt.Errorf("REMOTE_CONFIG_CACHE is empty")
+	}
+	b, err := os.ReadFile(s.cache)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	return values, json.Unmarshal(b, &values)
+}
@@ -0,0 +1,190 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/example/app/internal/capture"
+)
+
+// maxDiffs bounds the differences reported per request.
+const maxDiffs = 10
+
+// compare lists how a response differs from the recorded one: status,
+// content type and body. Recorded values that were redacted match
+// anything, and a truncated recorded body only has to be a prefix.
+func compare(want capture.Response, got *http.Response, body []byte, ignore []string) []string {
+	d := &differ{ignore: map[string]bool{}}
+	for _, name := range ignore {
+		d.ignore[strings.ToLower(name)] = true
+	}
+	if got.StatusCode != want.Status {
+		d.add("status: recorded %d, got %d", want.Status, got.StatusCode)
+	}
+	wantType, gotType := mediaType(want.Content.MimeType), mediaType(got.Header.Get("Content-Type"))
+	if !d.ignore["content-type"] && wantType != gotType {
+		d.add("content-type: recorded %q, got %q", wantType, gotType)
+	}
+	for _, h := range want.Headers {
+		if strings.EqualFold(h.Name, "Location") && !d.ignore["location"] && got.Header.Get("Location") != h.Value {
+			d.add("location: recorded %q, got %q", h.Value, got.Header.Get("Location"))
+		}
+	}
+	if d.ignore["body"] {
+		return d.diffs
+	}
+
+	recorded := []byte(want.Content.Text)
+	if want.Content.Encoding == "base64" {
+		recorded, _ = base64.StdEncoding.DecodeString(want.Content.Text)
+	}
+	if strings.Contains(wantType, "json") && !want.Content.Truncated {
+		var w, g any
+		if json.Unmarshal(recorded, &w) == nil {
+			if err := json.Unmarshal(body, &g); err != nil {
+				d.add("body: recorded JSON, got %s", err)
+				return d.diffs
+			}
+			d.json("$", w, g)
+			return d.diffs
+		}
+	}
+	if !textMatch(string(recorded), string(body), want.Content.Truncated) {
+		d.add("body: recorded %d bytes, got %d: %s", want.Content.Size, len(body), snippet(recorded, body))
+	}
+	return d.diffs
+}
+
+type differ struct {
+	ignore map[string]bool
+	diffs  []string
+}
+
+func (d *differ) add(format string, args ...any) {
+	switch {
+	case len(d.diffs) < maxDiffs:
+		d.diffs = append(d.diffs, fmt.Sprintf(format, args...))
+	case len(d.diffs) == maxDiffs:
+		d.diffs = append(d.diffs, "...")
+	}
+}
+
+// json compares decoded JSON values, naming differences by path.
+func (d *differ) json(path string, want, got any) {
+	if want == capture.Redacted {
+		return
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			d.add("%s: recorded an object, got %s", path, brief(got))
+			return
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		for k := range g {
+			if _, ok := w[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if d.ignore[strings.ToLower(k)] {
+				continue
+			}
+			wv, inWant := w[k]
+			gv, inGot := g[k]
+			switch {
+			case !inGot:
+				d.add("%s.%s: missing", path, k)
+			case !inWant:
+				d.add("%s.%s: added %s", path, k, brief(gv))
+			default:
+				d.json(path+"."+k, wv, gv)
+			}
+		}
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			d.add("%s: recorded an array, got %s", path, brief(got))
+			return
+		}
+		if len(w) != len(g) {
+			d.add("%s: recorded %d items, got %d", path, len(w), len(g))
+		}
+		for i := 0; i < len(w) && i < len(g); i++ {
+			d.json(fmt.Sprintf("%s[%d]", path, i), w[i], g[i])
+		}
+	default:
+		if want != got {
+			d.add("%s: recorded %s, got %s", path, brief(want), brief(got))
+		}
+	}
+}
+
+// textMatch compares bodies that are not JSON. Each redacted span in the
+// recorded text matches any text up to what follows it. A truncated
+// recording only has to match the start of got.
+func textMatch(recorded, got string, truncated bool) bool {
+	parts := strings.Split(recorded, capture.Redacted)
+	if !strings.HasPrefix(got, parts[0]) {
+		return false
+	}
+	rest := got[len(parts[0]):]
+	for _, p := range parts[1:] {
+		i := strings.Index(rest, p)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(p):]
+	}
+	switch {
+	case truncated:
+		return true
+	case len(parts) == 1:
+		return rest == ""
+	}
+	return strings.HasSuffix(got, parts[len(parts)-1])
+}
+
+// snippet shows where two bodies start to differ.
+func snippet(recorded, got []byte) string {
+	i := 0
+	for i < len(recorded) && i < len(got) && recorded[i] == got[i] {
+		i++
+	}
+	from := max(0, i-20)
+	cut := func(b []byte) string {
+		end := min(len(b), i+40)
+		if from >= end {
+			return `""`
+		}
+		return fmt.Sprintf("%q", bytes.ToValidUTF8(b[from:end], []byte("?")))
+	}
+	return fmt.Sprintf("at byte %d recorded %s, got %s", i, cut(recorded), cut(got))
+}
+
+func brief(v any) string {
+	b, _ := json.Marshal(v)
+	if len(b) > 60 {
+		return string(b[:57]) + "..."
+	}
+	return string(b)
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mt
+}
@@ -0,0 +1,93 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/example/app/internal/capture"
+)
+
+// fill replaces the redacted query parameters and JSON or form fields of
+// a recorded request with values, keyed by lower-case name. It returns
+// the names that are still redacted, "body" for a body that is neither
+// JSON nor a form. Such a request must not be sent: "[REDACTED]" in place
+// of a password or token makes its response meaningless, and may have
+// side effects.
+func fill(u *url.URL, body []byte, mimeType string, values map[string]string) ([]byte, []string) {
+	missing := map[string]bool{}
+	if strings.Contains(u.RawQuery, url.QueryEscape(capture.Redacted)) {
+		q := u.Query()
+		fillForm(q, values, missing)
+		u.RawQuery = q.Encode()
+	}
+	if bytes.Contains(body, []byte(capture.Redacted)) || bytes.Contains(body, []byte(url.QueryEscape(capture.Redacted))) {
+		switch {
+		case strings.Contains(mimeType, "json"):
+			var v any
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber()
+			if err := dec.Decode(&v); err != nil {
+				missing["body"] = true
+				break
+			}
+			v = fillJSON(v, values, missing)
+			body, _ = json.Marshal(v)
+		case strings.HasPrefix(mimeType, "application/x-www-form-urlencoded"):
+			form, err := url.ParseQuery(string(body))
+			if err != nil {
+				missing["body"] = true
+				break
+			}
+			fillForm(form, values, missing)
+			body = []byte(form.Encode())
+		default:
+			missing["body"] = true
+		}
+	}
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return body, names
+}
+
+func fillForm(form url.Values, values map[string]string, missing map[string]bool) {
+	for name, vs := range form {
+		for i, v := range vs {
+			if v != capture.Redacted {
+				continue
+			}
+			if set, ok := values[strings.ToLower(name)]; ok {
+				vs[i] = set
+			} else {
+				missing[name] = true
+			}
+		}
+	}
+}
+
+func fillJSON(v any, values map[string]string, missing map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if child != capture.Redacted {
+				v[k] = fillJSON(child, values, missing)
+				continue
+			}
+			if set, ok := values[strings.ToLower(k)]; ok {
+				v[k] = set
+			} else {
+				missing[k] = true
+			}
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = fillJSON(child, values, missing)
+		}
+	}
+	return v
+}
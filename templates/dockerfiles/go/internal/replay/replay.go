@@ -0,0 +1,234 @@
+// Package replay re-sends captured requests to a running instance and
+// compares its responses with the recorded ones, so a new version can be
+// regression-tested offline with realistic traffic.
+//
+// Requests are read from HAR files such as GET /captures/har returns. They
+// are sent in the order they were recorded, either with their recorded
+// spacing, sped up, or as fast as the concurrency limit allows.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/capture"
+)
+
+// Options controls a replay.
+type Options struct {
+	Target      *url.URL          // scheme and host requests are sent to
+	Hosts       map[string]string // recorded Host to the one sent; "*" matches any
+	Headers     http.Header       // replace recorded headers, e.g. credentials
+	Values      map[string]string // fill redacted query parameters and body fields, by lower-case name
+	Speed       float64           // 1 keeps recorded timing, 2 is twice as fast, 0 sends without waiting
+	Concurrency int               // requests in flight at most
+	Ignore      []string          // JSON fields and headers left out of the comparison
+	Client      *http.Client
+}
+
+// Result is the outcome of one replayed request.
+type Result struct {
+	Entry    capture.Entry
+	Status   int
+	Elapsed  time.Duration
+	Diffs    []string // empty when the response matches
+	Skipped  string   // why the request was not sent
+	Redacted []string // redacted values without an override, when that is why
+	Err      error
+}
+
+// OK reports whether the request was sent and its response matched.
+func (r Result) OK() bool {
+	return r.Skipped == "" && r.Err == nil && len(r.Diffs) == 0
+}
+
+// Summary counts the results of a replay.
+type Summary struct {
+	Sent     int `json:"sent"`
+	Matched  int `json:"matched"`
+	Differed int `json:"differed"`
+	Failed   int `json:"failed"`
+	Skipped  int `json:"skipped"`
+	Redacted int `json:"redacted"` // of Skipped, for redacted values
+}
+
+// Load reads the entries of HAR files, ordered by start time.
+func Load(paths ...string) ([]capture.Entry, error) {
+	var entries []capture.Entry
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+		var har capture.HAR
+		if err := json.Unmarshal(b, &har); err != nil {
+			return nil, fmt.Errorf("replay: %s: %w", path, err)
+		}
+		entries = append(entries, har.Log.Entries...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+	return entries, nil
+}
+
+// Run replays entries and calls report with each result as it completes.
+// It stops sending when ctx ends.
+func Run(ctx context.Context, entries []capture.Entry, opts Options, report func(Result)) Summary {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	// Redirects are compared, not followed.
+	client := *opts.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	var (
+		mu  sync.Mutex
+		sum Summary
+		wg  sync.WaitGroup
+	)
+	sem := make(chan struct{}, opts.Concurrency)
+	start := time.Now()
+	for _, e := range entries {
+		if opts.Speed > 0 {
+			offset := e.StartedDateTime.Sub(entries[0].StartedDateTime)
+			wait := time.Until(start.Add(time.Duration(float64(offset) / opts.Speed)))
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(e capture.Entry) {
+			defer func() { <-sem; wg.Done() }()
+			res := send(ctx, &client, e, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case res.Skipped != "":
+				sum.Skipped++
+				if len(res.Redacted) > 0 {
+					sum.Redacted++
+				}
+			case res.Err != nil:
+				sum.Sent++
+				sum.Failed++
+			case len(res.Diffs) > 0:
+				sum.Sent++
+				sum.Differed++
+			default:
+				sum.Sent++
+				sum.Matched++
+			}
+			report(res)
+		}(e)
+	}
+	wg.Wait()
+	return sum
+}
+
+func send(ctx context.Context, client *http.Client, e capture.Entry, opts Options) Result {
+	res := Result{Entry: e}
+	req, redacted, skip, err := build(ctx, e, opts)
+	if skip != "" || err != nil {
+		res.Skipped, res.Redacted, res.Err = skip, redacted, err
+		return res
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	res.Elapsed = time.Since(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Status = resp.StatusCode
+	res.Diffs = compare(e.Response, resp, body, opts.Ignore)
+	return res
+}
+
+// build turns a recorded request into one for the target. Headers that
+// were redacted are dropped unless opts.Headers replaces them. Redacted
+// query parameters and body fields are filled from opts.Values; a request
+// with any left is skipped and their names are returned.
+func build(ctx context.Context, e capture.Entry, opts Options) (req *http.Request, redacted []string, skip string, err error) {
+	rec := e.Request
+	u, err := url.Parse(rec.URL)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("recorded url: %w", err)
+	}
+	var b []byte
+	var mimeType string
+	if pd := rec.PostData; pd != nil {
+		if pd.Truncated {
+			return nil, nil, "request body was truncated", nil
+		}
+		b, mimeType = []byte(pd.Text), pd.MimeType
+		if pd.Comment == "base64" {
+			if b, err = base64.StdEncoding.DecodeString(pd.Text); err != nil {
+				return nil, nil, "", fmt.Errorf("recorded body: %w", err)
+			}
+		}
+	}
+	if b, redacted = fill(u, b, mimeType, opts.Values); len(redacted) > 0 {
+		return nil, redacted, "redacted values: " + strings.Join(redacted, ", "), nil
+	}
+	var body io.Reader
+	if rec.PostData != nil {
+		body = bytes.NewReader(b)
+	}
+	host := u.Host
+	if h, ok := opts.Hosts[host]; ok {
+		host = h
+	} else if h, ok := opts.Hosts["*"]; ok {
+		host = h
+	}
+	u.Scheme, u.Host = opts.Target.Scheme, opts.Target.Host
+
+	req, err = http.NewRequestWithContext(ctx, rec.Method, u.String(), body)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	req.Host = host
+	for _, h := range rec.Headers {
+		switch http.CanonicalHeaderKey(h.Name) {
+		// Set by the transport; a recorded Accept-Encoding would also stop
+		// it from decompressing the response before the comparison.
+		case "Host", "Content-Length", "Connection", "Accept-Encoding", "Transfer-Encoding":
+			continue
+		}
+		if h.Value != capture.Redacted {
+			req.Header.Add(h.Name, h.Value)
+		}
+	}
+	for name, values := range opts.Headers {
+		req.Header[name] = values
+	}
+	return req, nil, "", nil
+}
@@ -0,0 +1,33 @@
+package rules
+
+import (
+	"net/http"
+
+	"github.com/example/app/internal/admin"
+	"github.com/gorilla/mux"
+)
+
+// Status describes a rule and how often it matched for the admin API.
+type Status struct {
+	Rule
+	Matches int64 `json:"matches"`
+	Errors  int64 `json:"errors"`
+}
+
+// Rules reports the rules in evaluation order.
+func (e *Engine) Rules() []Status {
+	out := make([]Status, 0, len(e.rules))
+	for _, ru := range e.rules {
+		out = append(out, Status{Rule: ru.Rule, Matches: ru.matches.Load(), Errors: ru.errors.Load()})
+	}
+	return out
+}
+
+// RegisterAdmin adds the rules endpoint to the admin router:
+//
+//	GET /rules  rules in evaluation order with match and error counts
+func (e *Engine) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/rules", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, e.Rules())
+	}).Methods(http.MethodGet)
+}
@@ -0,0 +1,311 @@
+// Package rules evaluates declarative request rules written in CEL, so
+// access and routing decisions can live in configuration instead of code:
+//
+//	rules:
+//	  - name: acme-admin
+//	    when: request.headers["x-tenant"] == "acme" && request.path.startsWith("/api/v1/admin")
+//	    action: deny
+//
+// Rules are compiled and type-checked when they are loaded, so a typo
+// stops startup instead of failing requests. They are evaluated in order
+// on every public request. allow and deny end the evaluation; tag,
+// rate-limit and route apply and let later rules run. A missing header or
+// query parameter reads as "", and a deny rule whose expression fails
+// denies, so leaving a header out cannot get around one.
+package rules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/example/app/internal/canary"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/example/app/internal/ratelimit"
+	"github.com/example/app/internal/telemetry"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"gopkg.in/yaml.v3"
+)
+
+// Actions a rule can take.
+const (
+	ActionAllow     = "allow"
+	ActionDeny      = "deny"
+	ActionTag       = "tag"
+	ActionRateLimit = "rate-limit"
+	ActionRoute     = "route"
+)
+
+// Rule is one entry of the rules file.
+type Rule struct {
+	Name   string `yaml:"name" json:"name"`
+	When   string `yaml:"when" json:"when"`
+	Action string `yaml:"action" json:"action"`
+
+	Status  int      `yaml:"status,omitempty" json:"status,omitempty"`   // deny; 403 by default
+	Message string   `yaml:"message,omitempty" json:"message,omitempty"` // deny
+	Tags    []string `yaml:"tags,omitempty" json:"tags,omitempty"`       // tag
+	Class   string   `yaml:"class,omitempty" json:"class,omitempty"`     // rate-limit, from RATE_LIMIT_CLASSES
+	Route   string   `yaml:"route,omitempty" json:"route,omitempty"`     // route, a canary route
+	Variant string   `yaml:"variant,omitempty" json:"variant,omitempty"` // route
+}
+
+type file struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Engine holds the compiled rules.
+type Engine struct {
+	rules []*compiled
+
+	matches *telemetry.Counter
+	errors  *telemetry.Counter
+}
+
+type compiled struct {
+	Rule
+	program cel.Program
+	matches atomic.Int64
+	errors  atomic.Int64
+}
+
+// load reads and compiles the rules in path. Classes are checked against
+// RATE_LIMIT_CLASSES and route targets against the canary routes, unless
+// routes is nil.
+func load(path string, limits config.RateLimitConfig, routes *canary.Router) ([]*compiled, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("rules: %w", err)
+	}
+	var f file
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("rules: %s: %w", path, err)
+	}
+
+	env, err := cel.NewEnv(cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var out []*compiled
+	for i, r := range f.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rules: %s: rule %d has no name", path, i+1)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("rules: %s: duplicate rule %q", path, r.Name)
+		}
+		seen[r.Name] = true
+		if err := r.validate(limits, routes); err != nil {
+			return nil, fmt.Errorf("rules: %s: %s: %w", path, r.Name, err)
+		}
+		ast, iss := env.Compile(r.When)
+		if iss.Err() != nil {
+			return nil, fmt.Errorf("rules: %s: %s: %w", path, r.Name, iss.Err())
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			return nil, fmt.Errorf("rules: %s: %s: when must be a bool, got %s", path, r.Name, t)
+		}
+		prg, err := env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+		if err != nil {
+			return nil, fmt.Errorf("rules: %s: %s: %w", path, r.Name, err)
+		}
+		out = append(out, &compiled{Rule: r, program: prg})
+	}
+	return out, nil
+}
+
+func (r *Rule) validate(limits config.RateLimitConfig, routes *canary.Router) error {
+	if strings.TrimSpace(r.When) == "" {
+		return fmt.Errorf("when is empty")
+	}
+	switch r.Action {
+	case ActionAllow:
+	case ActionDeny:
+		if r.Status == 0 {
+			r.Status = http.StatusForbidden
+		}
+		if r.Status < 400 || r.Status > 599 {
+			return fmt.Errorf("deny status must be 4xx or 5xx, got %d", r.Status)
+		}
+		if r.Message == "" {
+			r.Message = "request denied by policy"
+		}
+	case ActionTag:
+		if len(r.Tags) == 0 {
+			return fmt.Errorf("tag needs tags")
+		}
+	case ActionRateLimit:
+		if _, ok := limits.Classes[r.Class]; !ok {
+			return fmt.Errorf("rate limit class %q is not in RATE_LIMIT_CLASSES", r.Class)
+		}
+	case ActionRoute:
+		if r.Route == "" || r.Variant == "" {
+			return fmt.Errorf("route needs route and variant")
+		}
+		if routes != nil {
+			if err := routes.CheckVariant(r.Route, r.Variant); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action %q (allow, deny, tag, rate-limit, route)", r.Action)
+	}
+	return nil
+}
+
+// Check compiles the rules in path without running them, e.g. in CI. The
+// canary routes only exist in a running service, so route targets are
+// checked by New alone.
+func Check(path string, limits config.RateLimitConfig) ([]Rule, error) {
+	rules, err := load(path, limits, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Rule, len(rules))
+	for i, ru := range rules {
+		out[i] = ru.Rule
+	}
+	return out, nil
+}
+
+// New loads the rules in cfg.Rules.File. route actions must name a route
+// already registered with routes.
+func New(cfg *config.Config, routes *canary.Router, reg *telemetry.Registry) (*Engine, error) {
+	rules, err := load(cfg.Rules.File, cfg.RateLimit, routes)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("rules loaded", "file", cfg.Rules.File, "rules", len(rules))
+	return &Engine{
+		rules:   rules,
+		matches: reg.Counter("rules_matches_total", "Requests matched by each rule.", "rule", "action"),
+		errors:  reg.Counter("rules_errors_total", "Rule evaluations that failed; deny rules count them as a match, others as no match.", "rule"),
+	}, nil
+}
+
+// Middleware evaluates the rules and applies the actions of those that
+// match. Tags are added to the access log and available through Tags.
+func (e *Engine) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := map[string]any{"request": activation(r)}
+		ctx := r.Context()
+		var tags []string
+		classed := false
+	eval:
+		for _, ru := range e.rules {
+			if !e.match(ru, vars) {
+				continue
+			}
+			switch ru.Action {
+			case ActionAllow:
+				break eval
+			case ActionDeny:
+				problem.Write(w, ru.Status, ru.Message)
+				return
+			case ActionTag:
+				tags = append(tags, ru.Tags...)
+			case ActionRateLimit:
+				if !classed {
+					ctx, classed = ratelimit.WithClass(ctx, ru.Class), true
+				}
+			case ActionRoute:
+				ctx = canary.WithVariant(ctx, ru.Route, ru.Variant)
+			}
+		}
+		if len(tags) > 0 {
+			telemetry.AddLogAttrs(ctx, slog.Any("tags", tags))
+			ctx = withTags(ctx, tags)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// match evaluates a rule. A deny rule that fails to evaluate matches, so
+// an unexpected request cannot get past it.
+func (e *Engine) match(ru *compiled, vars map[string]any) bool {
+	out, _, err := ru.program.Eval(vars)
+	if err != nil {
+		ru.errors.Add(1)
+		e.errors.Inc(ru.Name)
+		slog.Warn("rule evaluation failed", "rule", ru.Name, "action", ru.Action, "error", err)
+		return ru.Action == ActionDeny
+	}
+	if ok, _ := out.Value().(bool); !ok {
+		return false
+	}
+	ru.matches.Add(1)
+	e.matches.Inc(ru.Name, ru.Action)
+	return true
+}
+
+type tagsKey struct{}
+
+func withTags(ctx context.Context, tags []string) context.Context {
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// Tags returns the tags matching rules gave the request.
+func Tags(ctx context.Context) []string {
+	tags, _ := ctx.Value(tagsKey{}).([]string)
+	return tags
+}
+
+// activation is what expressions see as request. Header names are lower
+// case and repeated values are joined with ", "; query parameters keep
+// their first value. Missing headers and parameters read as "".
+func activation(r *http.Request) map[string]any {
+	headers := make(map[string]string, len(r.Header))
+	for k, vs := range r.Header {
+		headers[strings.ToLower(k)] = strings.Join(vs, ", ")
+	}
+	query := map[string]string{}
+	for k, vs := range r.URL.Query() {
+		query[k] = vs[0]
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return map[string]any{
+		"method":    r.Method,
+		"path":      r.URL.Path,
+		"host":      r.Host,
+		"query":     lenient{types.NewStringStringMap(types.DefaultTypeAdapter, query)},
+		"headers":   lenient{types.NewStringStringMap(types.DefaultTypeAdapter, headers)},
+		"remote_ip": ip,
+	}
+}
+
+// lenient is a map whose missing keys read as "". in still tells whether a
+// key is present.
+type lenient struct {
+	traits.Mapper
+}
+
+func (m lenient) Get(key ref.Val) ref.Val {
+	v, _ := m.Find(key)
+	return v
+}
+
+func (m lenient) Find(key ref.Val) (ref.Val, bool) {
+	v, found := m.Mapper.Find(key)
+	if !found && v == nil {
+		return types.String(""), true
+	}
+	return v, found
+}
@@ -0,0 +1,219 @@
+package secrets
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/telemetry"
+)
+
+// Credentials keeps a leased secret, typically dynamic database
+// credentials, valid for as long as the service runs. The lease is renewed
+// when two thirds of it have passed; once it can't be renewed for a useful
+// period (its max TTL is near) or renewal fails, new credentials are issued
+// while the old ones are still valid, so connections opened with either
+// work during the overlap.
+type Credentials struct {
+	leaser Leaser
+	path   string
+
+	rotations *telemetry.Counter
+	failures  *telemetry.Counter
+
+	mu       sync.Mutex
+	cur      *Secret
+	issued   time.Time
+	expires  time.Time
+	rotated  int
+	subs     []func(*Secret)
+	rotateCh chan struct{}
+}
+
+// LeaseStatus describes the current lease without its values.
+type LeaseStatus struct {
+	Path      string     `json:"path"`
+	LeaseID   string     `json:"lease_id,omitempty"`
+	Renewable bool       `json:"renewable"`
+	Issued    *time.Time `json:"issued,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	Rotations int        `json:"rotations"`
+}
+
+func NewCredentials(l Leaser, path string, reg *telemetry.Registry) *Credentials {
+	return &Credentials{
+		leaser:    l,
+		path:      path,
+		rotations: reg.Counter("secrets_rotations_total", "Leased secrets replaced by newly issued ones.", "path"),
+		failures:  reg.Counter("secrets_renewal_failures_total", "Failed renewals or issues of leased secrets.", "path"),
+		rotateCh:  make(chan struct{}, 1),
+	}
+}
+
+// Start issues the first credentials.
+func (c *Credentials) Start(ctx context.Context) error {
+	s, err := c.leaser.Issue(ctx, c.path)
+	if err != nil {
+		return err
+	}
+	c.replace(s)
+	return nil
+}
+
+// Current returns the credentials in use.
+func (c *Credentials) Current() *Secret {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cur
+}
+
+// OnRotate registers fn to receive every newly issued secret, e.g. to
+// reconfigure a client that doesn't use a Connector.
+func (c *Credentials) OnRotate(fn func(*Secret)) {
+	c.mu.Lock()
+	c.subs = append(c.subs, fn)
+	c.mu.Unlock()
+}
+
+// RotateSoon asks Run to issue new credentials now, e.g. after a new Vault
+// login revoked the leases of the previous token.
+func (c *Credentials) RotateSoon() {
+	select {
+	case c.rotateCh <- struct{}{}:
+	default:
+	}
+}
+
+// Run renews and rotates until ctx ends. The last lease is left to expire
+// rather than revoked, so in-flight queries finish during shutdown.
+func (c *Credentials) Run(ctx context.Context) {
+	retry := time.Second
+	for {
+		c.mu.Lock()
+		issued, expires, lease := c.issued, c.expires, *c.cur
+		c.mu.Unlock()
+
+		var wait time.Duration
+		if !expires.IsZero() {
+			wait = time.Until(expires) - expires.Sub(issued)/3
+		} else {
+			wait = 24 * time.Hour // no lease: nothing to renew
+		}
+		rotate := false
+		select {
+		case <-time.After(max(wait, 0)):
+		case <-c.rotateCh:
+			rotate = true
+		case <-ctx.Done():
+			return
+		}
+
+		if !rotate && lease.Renewable {
+			ttl, err := c.leaser.Renew(ctx, lease.LeaseID, lease.LeaseDuration)
+			switch {
+			case err != nil:
+				slog.Warn("lease renewal failed, issuing new credentials", "path", c.path, "error", err)
+				c.failures.Inc(c.path)
+			case ttl < lease.LeaseDuration/3:
+				slog.Info("lease near its max TTL, issuing new credentials", "path", c.path, "ttl", ttl)
+			default:
+				c.mu.Lock()
+				c.issued, c.expires = time.Now(), time.Now().Add(ttl)
+				c.mu.Unlock()
+				slog.Debug("lease renewed", "path", c.path, "ttl", ttl)
+				continue
+			}
+		}
+
+		s, err := c.leaser.Issue(ctx, c.path)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.failures.Inc(c.path)
+			slog.Error("issuing new credentials failed", "path", c.path, "error", err, "expires", expires, "retry_in", retry)
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+			retry = min(2*retry, time.Minute)
+			c.RotateSoon()
+			continue
+		}
+		retry = time.Second
+		c.replace(s)
+		c.mu.Lock()
+		c.rotated++
+		c.mu.Unlock()
+		c.rotations.Inc(c.path)
+		slog.Info("credentials rotated", "path", c.path, "ttl", s.LeaseDuration)
+	}
+}
+
+func (c *Credentials) replace(s *Secret) {
+	c.mu.Lock()
+	c.cur = s
+	c.issued = time.Now()
+	c.expires = time.Time{}
+	if s.LeaseDuration > 0 {
+		c.expires = c.issued.Add(s.LeaseDuration)
+	}
+	subs := c.subs
+	c.mu.Unlock()
+	for _, fn := range subs {
+		fn(s)
+	}
+}
+
+// Status describes the current lease.
+func (c *Credentials) Status() LeaseStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := LeaseStatus{Path: c.path, Rotations: c.rotated}
+	if c.cur == nil {
+		return st
+	}
+	st.LeaseID, st.Renewable = c.cur.LeaseID, c.cur.Renewable
+	issued := c.issued
+	st.Issued = &issued
+	if !c.expires.IsZero() {
+		expires := c.expires
+		st.Expires = &expires
+	}
+	return st
+}
+
+// Connector opens database/sql connections with the current credentials,
+// so a pool from sql.OpenDB(connector) uses rotated credentials for every
+// new connection without being reopened. Connections opened earlier keep
+// working until their lease expires; set db.SetConnMaxLifetime to less
+// than a third of the lease duration so they are replaced in time.
+type Connector struct {
+	Base  driver.Driver
+	Creds *Credentials
+	// DSN builds the data source name, e.g.
+	// fmt.Sprintf("postgres://%s:%s@postgres/app", url.QueryEscape(user), url.QueryEscape(password)).
+	DSN func(user, password string) string
+}
+
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	s := c.Creds.Current()
+	if s == nil {
+		return nil, fmt.Errorf("secrets: no database credentials issued yet")
+	}
+	dsn := c.DSN(s.Data["username"], s.Data["password"])
+	if dc, ok := c.Base.(driver.DriverContext); ok {
+		conn, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return conn.Connect(ctx)
+	}
+	return c.Base.Open(dsn)
+}
+
+func (c *Connector) Driver() driver.Driver { return c.Base }
@@ -0,0 +1,40 @@
+package secrets
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/example/app/internal/admin"
+	"github.com/gorilla/mux"
+)
+
+// Status describes the provider and the leases it keeps, never their values.
+type Status struct {
+	Provider string        `json:"provider"`
+	TokenTTL string        `json:"token_ttl,omitempty"`
+	Leases   []LeaseStatus `json:"leases"`
+}
+
+// RegisterAdmin adds the secrets endpoint to the admin router:
+//
+//	GET /secrets  provider, Vault token TTL and leases
+func RegisterAdmin(r *mux.Router, p Provider, leases ...*Credentials) {
+	r.HandleFunc("/secrets", func(w http.ResponseWriter, r *http.Request) {
+		st := Status{Leases: []LeaseStatus{}}
+		switch p := p.(type) {
+		case File:
+			st.Provider = "file"
+		case Env:
+			st.Provider = "env"
+		case *Vault:
+			st.Provider = "vault"
+			if ttl := p.TokenTTL(); ttl > 0 {
+				st.TokenTTL = ttl.Round(time.Second).String()
+			}
+		}
+		for _, c := range leases {
+			st.Leases = append(st.Leases, c.Status())
+		}
+		admin.WriteJSON(w, http.StatusOK, st)
+	}).Methods(http.MethodGet)
+}
@@ -0,0 +1,135 @@
+// Package secrets reads application secrets from mounted files, the
+// environment or a Vault-compatible server, and keeps leased secrets such
+// as dynamic database credentials renewed and rotated while the service
+// runs.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// ErrNotFound is returned for secrets that don't exist.
+var ErrNotFound = errors.New("secrets: not found")
+
+// Secret is a set of values read together, e.g. a username and password.
+// Static secrets have no lease.
+type Secret struct {
+	Data          map[string]string
+	LeaseID       string
+	LeaseDuration time.Duration
+	Renewable     bool
+}
+
+// Value returns the single value of a plain secret: the "value" key, or the
+// only key there is.
+func (s *Secret) Value() string {
+	if v, ok := s.Data["value"]; ok || len(s.Data) != 1 {
+		return v
+	}
+	for _, v := range s.Data {
+		return v
+	}
+	return ""
+}
+
+// Provider reads secrets by path. What a path means is up to the provider:
+// a file name, an environment variable or a Vault KV path.
+type Provider interface {
+	Get(ctx context.Context, path string) (*Secret, error)
+}
+
+// Leaser issues dynamic secrets that expire unless renewed.
+type Leaser interface {
+	// Issue creates a new secret, e.g. database/creds/app.
+	Issue(ctx context.Context, path string) (*Secret, error)
+	// Renew extends a lease and returns its new duration, which the server
+	// may cap below increment.
+	Renew(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error)
+}
+
+// New returns the provider selected by SECRETS_PROVIDER. The Vault provider
+// must be started with Login before use.
+func New(cfg config.SecretsConfig) (Provider, error) {
+	switch cfg.Provider {
+	case "file":
+		return File{Dir: cfg.Dir}, nil
+	case "env":
+		return Env{}, nil
+	case "vault":
+		return NewVault(cfg.Vault), nil
+	}
+	return nil, fmt.Errorf("secrets: unknown provider %q", cfg.Provider)
+}
+
+// File reads secrets mounted as files, as Docker and Kubernetes do under
+// /run/secrets. A file holding a JSON object yields its keys.
+type File struct {
+	Dir string
+}
+
+func (f File) Get(_ context.Context, path string) (*Secret, error) {
+	if !filepath.IsLocal(path) {
+		return nil, fmt.Errorf("secrets: %q is not a path below %s", path, f.Dir)
+	}
+	b, err := os.ReadFile(filepath.Join(f.Dir, path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %w", err)
+	}
+	return &Secret{Data: parse(strings.TrimRight(string(b), "\r\n"))}, nil
+}
+
+// Env reads secrets from environment variables. The path is upper-cased
+// with other characters replaced by underscores, so db/password reads
+// DB_PASSWORD.
+type Env struct{}
+
+func (Env) Get(_ context.Context, path string) (*Secret, error) {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, path)
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return &Secret{Data: parse(v)}, nil
+}
+
+// parse turns a JSON object into its keys and anything else into "value".
+func parse(raw string) map[string]string {
+	var obj map[string]any
+	if strings.HasPrefix(raw, "{") && json.Unmarshal([]byte(raw), &obj) == nil {
+		return stringify(obj)
+	}
+	return map[string]string{"value": raw}
+}
+
+func stringify(m map[string]any) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		if s, ok := v.(string); ok {
+			out[k] = s
+			continue
+		}
+		b, _ := json.Marshal(v)
+		out[k] = string(b)
+	}
+	return out
+}
@@ -0,0 +1,288 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// Vault is a minimal client for the parts of the Vault HTTP API the service
+// needs: token or AppRole login, KV reads, dynamic secrets and lease
+// renewal. It also works against stand-ins such as OpenBao or vault -dev.
+type Vault struct {
+	cfg  config.VaultConfig
+	base string
+	http *http.Client
+
+	mu        sync.Mutex
+	token     string
+	tokenTTL  time.Duration // 0 for tokens that don't expire
+	renewable bool
+	expires   time.Time
+	loggedIn  bool
+	onLogin   []func()
+}
+
+func NewVault(cfg config.VaultConfig) *Vault {
+	base := cfg.Addr
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+	return &Vault{
+		cfg:  cfg,
+		base: strings.TrimRight(base, "/"),
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Login authenticates with AppRole when VAULT_ROLE_ID is set, and
+// otherwise looks up VAULT_TOKEN to learn its TTL.
+func (v *Vault) Login(ctx context.Context) error {
+	var resp response
+	if v.cfg.RoleID != "" {
+		body := map[string]string{"role_id": v.cfg.RoleID, "secret_id": v.cfg.SecretID}
+		if err := v.do(ctx, http.MethodPost, "auth/"+v.cfg.AppRoleMount+"/login", "", body, &resp); err != nil {
+			return err
+		}
+		if resp.Auth == nil {
+			return fmt.Errorf("vault: AppRole login returned no token")
+		}
+		v.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+		slog.Info("vault login", "method", "approle", "ttl", v.TokenTTL())
+	} else {
+		var lookup struct {
+			Data struct {
+				TTL       int  `json:"ttl"`
+				Renewable bool `json:"renewable"`
+			} `json:"data"`
+		}
+		if err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", v.cfg.Token, nil, &lookup); err != nil {
+			return err
+		}
+		v.setToken(v.cfg.Token, lookup.Data.TTL, lookup.Data.Renewable)
+		slog.Info("vault login", "method", "token", "ttl", v.TokenTTL())
+	}
+
+	v.mu.Lock()
+	hooks := v.onLogin
+	if !v.loggedIn {
+		v.loggedIn, hooks = true, nil
+	}
+	v.mu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+	return nil
+}
+
+// OnLogin registers fn to run when the service logs in again because its
+// token could not be renewed. Leases die with the token that created them,
+// so dynamic secrets must be reissued.
+func (v *Vault) OnLogin(fn func()) {
+	v.mu.Lock()
+	v.onLogin = append(v.onLogin, fn)
+	v.mu.Unlock()
+}
+
+func (v *Vault) setToken(token string, ttlSeconds int, renewable bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.token = token
+	v.tokenTTL = time.Duration(ttlSeconds) * time.Second
+	v.renewable = renewable
+	v.expires = time.Time{}
+	if ttlSeconds > 0 {
+		v.expires = time.Now().Add(v.tokenTTL)
+	}
+}
+
+// TokenTTL is the lifetime of the current token; 0 when it doesn't expire.
+func (v *Vault) TokenTTL() time.Duration {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.tokenTTL
+}
+
+// Run keeps the token alive: it renews it when two thirds of its TTL have
+// passed and logs in again once it can no longer be renewed. It returns
+// when ctx ends.
+func (v *Vault) Run(ctx context.Context) {
+	retry := time.Second
+	for {
+		v.mu.Lock()
+		ttl, expires, renewable := v.tokenTTL, v.expires, v.renewable
+		v.mu.Unlock()
+		if ttl == 0 {
+			<-ctx.Done()
+			return
+		}
+		wait := time.Until(expires) - ttl/3
+		select {
+		case <-time.After(max(wait, 0)):
+		case <-ctx.Done():
+			return
+		}
+
+		err := errors.New("token is not renewable")
+		if renewable {
+			err = v.renewToken(ctx, ttl)
+		}
+		if err != nil && v.cfg.RoleID != "" {
+			slog.Info("vault token renewal failed, logging in again", "error", err)
+			err = v.Login(ctx)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("vault token could not be renewed", "error", err, "expires", expires, "retry_in", retry)
+			select {
+			case <-time.After(retry):
+			case <-ctx.Done():
+				return
+			}
+			retry = min(2*retry, time.Minute)
+			continue
+		}
+		retry = time.Second
+	}
+}
+
+// renewToken extends the token. A token that comes back with much less than
+// was asked for is close to its max TTL; that is reported as an error so
+// AppRole logins are renewed early.
+func (v *Vault) renewToken(ctx context.Context, increment time.Duration) error {
+	var resp response
+	body := map[string]string{"increment": increment.String()}
+	if err := v.do(ctx, http.MethodPost, "auth/token/renew-self", v.currentToken(), body, &resp); err != nil {
+		return err
+	}
+	if resp.Auth == nil {
+		return fmt.Errorf("vault: token renewal returned no auth")
+	}
+	v.setToken(v.currentToken(), resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	if got := v.TokenTTL(); got < increment/3 {
+		return fmt.Errorf("vault: token renewed for only %s, near its max TTL", got)
+	}
+	return nil
+}
+
+func (v *Vault) currentToken() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.token
+}
+
+// Get reads a KV secret below VAULT_KV_MOUNT, e.g. "app/config".
+func (v *Vault) Get(ctx context.Context, path string) (*Secret, error) {
+	var resp response
+	if v.cfg.KVVersion == 1 {
+		if err := v.do(ctx, http.MethodGet, v.cfg.KVMount+"/"+path, v.currentToken(), nil, &resp); err != nil {
+			return nil, err
+		}
+		return &Secret{Data: stringify(resp.Data)}, nil
+	}
+	if err := v.do(ctx, http.MethodGet, v.cfg.KVMount+"/data/"+path, v.currentToken(), nil, &resp); err != nil {
+		return nil, err
+	}
+	data, _ := resp.Data["data"].(map[string]any)
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s (deleted)", ErrNotFound, path)
+	}
+	return &Secret{Data: stringify(data)}, nil
+}
+
+// Issue reads a dynamic secret such as database/creds/app, which Vault
+// creates on every read.
+func (v *Vault) Issue(ctx context.Context, path string) (*Secret, error) {
+	var resp response
+	if err := v.do(ctx, http.MethodGet, path, v.currentToken(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &Secret{
+		Data:          stringify(resp.Data),
+		LeaseID:       resp.LeaseID,
+		LeaseDuration: time.Duration(resp.LeaseDuration) * time.Second,
+		Renewable:     resp.Renewable,
+	}, nil
+}
+
+func (v *Vault) Renew(ctx context.Context, leaseID string, increment time.Duration) (time.Duration, error) {
+	var resp response
+	body := map[string]any{"lease_id": leaseID, "increment": int(increment.Seconds())}
+	if err := v.do(ctx, http.MethodPut, "sys/leases/renew", v.currentToken(), body, &resp); err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.LeaseDuration) * time.Second, nil
+}
+
+// response is the envelope of Vault API responses.
+type response struct {
+	LeaseID       string         `json:"lease_id"`
+	LeaseDuration int            `json:"lease_duration"`
+	Renewable     bool           `json:"renewable"`
+	Data          map[string]any `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+func (v *Vault) do(ctx context.Context, method, path, token string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.base+"/v1/"+strings.TrimLeft(path, "/"), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	case resp.StatusCode/100 != 2:
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(msg, &e) == nil && len(e.Errors) > 0 {
+			msg = []byte(strings.Join(e.Errors, "; "))
+		}
+		return fmt.Errorf("vault: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	case out != nil && resp.StatusCode != http.StatusNoContent:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
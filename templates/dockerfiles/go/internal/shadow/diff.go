@@ -0,0 +1,174 @@
+package shadow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxDiffs bounds the differences reported per request.
+const maxDiffs = 5
+
+// response is what is compared of a primary or shadow response.
+type response struct {
+	status    int
+	header    http.Header
+	body      []byte
+	truncated bool
+}
+
+// Diff is one discrepancy between primary and shadow.
+type Diff struct {
+	Kind    string // status, header, body
+	Path    string
+	Primary string
+	Shadow  string
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("%s %s: %s != %s", d.Kind, d.Path, d.Primary, d.Shadow)
+}
+
+// rules are the configurable parts of the comparison.
+type rules struct {
+	headers []string
+	ignore  [][]string // split dotted paths
+}
+
+func newRules(headers, ignore []string) rules {
+	r := rules{headers: headers}
+	for _, p := range ignore {
+		r.ignore = append(r.ignore, strings.Split(p, "."))
+	}
+	return r
+}
+
+// compare returns the differences between the two responses. JSON bodies
+// are compared structurally with ignored fields removed, other bodies byte
+// for byte.
+func (r rules) compare(primary, shadow response) []Diff {
+	var diffs []Diff
+	if primary.status != shadow.status {
+		diffs = append(diffs, Diff{Kind: "status", Primary: strconv.Itoa(primary.status), Shadow: strconv.Itoa(shadow.status)})
+	}
+	for _, h := range r.headers {
+		if p, s := primary.header.Get(h), shadow.header.Get(h); p != s {
+			diffs = append(diffs, Diff{Kind: "header", Path: http.CanonicalHeaderKey(h), Primary: p, Shadow: s})
+		}
+	}
+	if primary.truncated || shadow.truncated {
+		return diffs
+	}
+
+	var pv, sv any
+	if json.Unmarshal(primary.body, &pv) == nil && json.Unmarshal(shadow.body, &sv) == nil {
+		for _, path := range r.ignore {
+			pv = remove(pv, path)
+			sv = remove(sv, path)
+		}
+		diffJSON(&diffs, "$", pv, sv)
+	} else if !bytes.Equal(primary.body, shadow.body) {
+		diffs = append(diffs, Diff{Kind: "body", Path: "$", Primary: summary(primary.body), Shadow: summary(shadow.body)})
+	}
+	if len(diffs) > maxDiffs {
+		diffs = diffs[:maxDiffs]
+	}
+	return diffs
+}
+
+// remove deletes the field at path; "*" matches every key or index.
+func remove(v any, path []string) any {
+	if len(path) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k := range v {
+			if path[0] != "*" && path[0] != k {
+				continue
+			}
+			if len(path) == 1 {
+				delete(v, k)
+			} else {
+				v[k] = remove(v[k], path[1:])
+			}
+		}
+	case []any:
+		for i := range v {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				if len(path) > 1 {
+					v[i] = remove(v[i], path[1:])
+				}
+			}
+		}
+	}
+	return v
+}
+
+func diffJSON(diffs *[]Diff, path string, p, s any) {
+	if len(*diffs) > maxDiffs {
+		return
+	}
+	switch pv := p.(type) {
+	case map[string]any:
+		sv, ok := s.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(pv)+len(sv))
+		for k := range pv {
+			keys = append(keys, k)
+		}
+		for k := range sv {
+			if _, ok := pv[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			diffJSON(diffs, path+"."+k, pv[k], sv[k])
+		}
+		return
+	case []any:
+		sv, ok := s.([]any)
+		if !ok {
+			break
+		}
+		if len(pv) != len(sv) {
+			*diffs = append(*diffs, Diff{Kind: "body", Path: path + ".length", Primary: strconv.Itoa(len(pv)), Shadow: strconv.Itoa(len(sv))})
+			return
+		}
+		for i := range pv {
+			diffJSON(diffs, path+"["+strconv.Itoa(i)+"]", pv[i], sv[i])
+		}
+		return
+	default:
+		if p == s {
+			return
+		}
+	}
+	*diffs = append(*diffs, Diff{Kind: "body", Path: path, Primary: jsonSummary(p), Shadow: jsonSummary(s)})
+}
+
+func jsonSummary(v any) string {
+	if v == nil {
+		return "missing"
+	}
+	b, _ := json.Marshal(v)
+	return truncate(string(b))
+}
+
+func summary(b []byte) string {
+	return strconv.Quote(truncate(string(b)))
+}
+
+func truncate(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "…"
+	}
+	return s
+}
@@ -0,0 +1,240 @@
+// Package shadow mirrors a sample of live requests to a shadow target and
+// compares its responses with the ones sent to clients. Mirroring happens
+// after the client has its response, so the shadow can neither slow down
+// nor change what clients see.
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Header marks mirrored requests so the shadow can tell them apart.
+const Header = "X-Shadow-Request"
+
+// Mirror is the sampling middleware and the comparison worker pool.
+type Mirror struct {
+	cfg     config.ShadowConfig
+	target  string
+	client  *http.Client
+	rules   rules
+	methods map[string]bool
+	slots   chan struct{}
+
+	requests *telemetry.Counter
+	diffs    *telemetry.Counter
+	duration *telemetry.Histogram
+}
+
+// New creates the mirror. Mirrored requests go through transport, so the
+// target may name an upstream.
+func New(cfg config.ShadowConfig, transport http.RoundTripper, reg *telemetry.Registry) *Mirror {
+	m := &Mirror{
+		cfg:      cfg,
+		target:   strings.TrimRight(cfg.Target, "/"),
+		client:   &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		rules:    newRules(cfg.CompareHeaders, cfg.IgnoreFields),
+		methods:  map[string]bool{},
+		slots:    make(chan struct{}, max(cfg.Concurrency, 1)),
+		requests: reg.Counter("shadow_requests_total", "Sampled requests by comparison outcome (match, mismatch, error, dropped, skipped).", "outcome"),
+		diffs:    reg.Counter("shadow_diffs_total", "Differences between primary and shadow responses by kind (status, header, body).", "route", "kind"),
+		duration: reg.Histogram("shadow_request_duration_seconds", "Latency of mirrored requests.", nil),
+	}
+	for _, method := range cfg.Methods {
+		m.methods[strings.ToUpper(method)] = true
+	}
+	return m
+}
+
+// sample is a request picked for mirroring and the primary response.
+type sample struct {
+	method  string
+	uri     string
+	route   string
+	header  http.Header
+	body    []byte
+	primary response
+	elapsed time.Duration // of the primary
+}
+
+// Middleware samples requests, captures the primary response and hands
+// both to a background comparison once the client has been served.
+func (m *Mirror) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Protocol upgrades (WebSockets) can't be replayed.
+		if !m.methods[r.Method] || r.Header.Get(Header) != "" || r.Header.Get("Upgrade") != "" || rand.Float64() >= m.cfg.SampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, ok := m.readBody(r)
+		if !ok {
+			m.requests.Inc("skipped")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tee := &teeWriter{ResponseWriter: w, limit: m.cfg.MaxBody}
+		start := time.Now()
+		next.ServeHTTP(tee, r)
+
+		s := sample{
+			method: r.Method,
+			uri:    r.URL.RequestURI(),
+			route:  telemetry.RouteName(r),
+			header: r.Header.Clone(),
+			body:   body,
+			primary: response{
+				status:    tee.Status(),
+				header:    w.Header().Clone(),
+				body:      tee.buf.Bytes(),
+				truncated: tee.truncated,
+			},
+			elapsed: time.Since(start),
+		}
+		select {
+		case m.slots <- struct{}{}:
+			go func() {
+				defer func() { <-m.slots }()
+				m.mirror(s)
+			}()
+		default:
+			m.requests.Inc("dropped")
+		}
+	})
+}
+
+// readBody buffers the request body so it can be sent twice. Bodies larger
+// than SHADOW_MAX_BODY are passed through and the request is not mirrored.
+func (m *Mirror) readBody(r *http.Request) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, int64(m.cfg.MaxBody)+1))
+	if err != nil || len(buf) > m.cfg.MaxBody {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(buf))
+	return buf, true
+}
+
+func (m *Mirror) mirror(s sample) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, s.method, m.target+s.uri, bytes.NewReader(s.body))
+	if err != nil {
+		m.requests.Inc("error")
+		return
+	}
+	req.Header = s.header
+	req.Header.Set(Header, "1")
+
+	start := time.Now()
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.requests.Inc("error")
+		slog.Warn("shadow request failed", "method", s.method, "path", s.uri, "err", err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(m.cfg.MaxBody)+1))
+	elapsed := time.Since(start)
+	m.duration.Observe(elapsed.Seconds())
+	if err != nil {
+		m.requests.Inc("error")
+		slog.Warn("shadow response unreadable", "method", s.method, "path", s.uri, "err", err)
+		return
+	}
+
+	shadow := response{status: resp.StatusCode, header: resp.Header, body: body}
+	if len(body) > m.cfg.MaxBody {
+		shadow.body, shadow.truncated = nil, true
+	}
+	diffs := m.rules.compare(s.primary, shadow)
+	if len(diffs) == 0 {
+		m.requests.Inc("match")
+		return
+	}
+
+	m.requests.Inc("mismatch")
+	seen := map[string]bool{}
+	details := make([]string, len(diffs))
+	for i, d := range diffs {
+		details[i] = d.String()
+		if !seen[d.Kind] {
+			seen[d.Kind] = true
+			m.diffs.Inc(s.route, d.Kind)
+		}
+	}
+	slog.Warn("shadow mismatch",
+		"method", s.method,
+		"path", s.uri,
+		"route", s.route,
+		"primary_duration", s.elapsed,
+		"shadow_duration", elapsed,
+		"diffs", details,
+	)
+}
+
+// teeWriter passes the response through and keeps a copy of the body up to
+// limit bytes.
+type teeWriter struct {
+	http.ResponseWriter
+	status    int
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (t *teeWriter) WriteHeader(code int) {
+	if t.status == 0 {
+		t.status = code
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+	if !t.truncated {
+		if t.buf.Len()+len(b) > t.limit {
+			t.truncated = true
+			t.buf.Reset()
+		} else {
+			t.buf.Write(b)
+		}
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *teeWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *teeWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
+
+func (t *teeWriter) Status() int {
+	if t.status == 0 {
+		return http.StatusOK
+	}
+	return t.status
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
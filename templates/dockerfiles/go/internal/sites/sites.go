@@ -0,0 +1,262 @@
+// Package sites serves several hostnames from one deployment. Each site
+// matches its hosts with gorilla/mux Host templates and has its own route
+// groups, middleware stack and TLS certificate, chosen by SNI. Requests for
+// hosts no site matches go to the default site.
+//
+// Health, readiness and metrics stay on the root router and answer on
+// every host.
+package sites
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/telemetry"
+	"github.com/gorilla/mux"
+)
+
+// Default names the implicit site used when SITE_DEFAULT is not in SITES.
+const Default = "default"
+
+// Middleware is a named part of a site's middleware stack.
+type Middleware struct {
+	Name string
+	Func mux.MiddlewareFunc
+}
+
+// Group is a named set of routes a site may serve.
+type Group struct {
+	Name     string
+	Register func(r *mux.Router)
+}
+
+// Sites holds the configured sites.
+type Sites struct {
+	named []*Site // in name order
+	def   *Site   // nil when unmatched hosts get 404
+}
+
+// Site is one virtual host.
+type Site struct {
+	Name       string
+	Hosts      []string
+	routes     []string // nil serves every group
+	middleware []string // nil uses the whole stack
+	hosts      []*mux.Route
+	cert       *tls.Certificate
+}
+
+// New parses the SITE_* variables.
+func New(cfg config.SitesConfig) (*Sites, error) {
+	s := &Sites{}
+	byName := map[string]*Site{}
+	for name, raw := range cfg.Hosts {
+		site := &Site{Name: name}
+		for _, h := range strings.Split(raw, "|") {
+			if h = strings.TrimSpace(h); h == "" {
+				continue
+			}
+			rt := mux.NewRouter().Host(h)
+			if err := rt.GetError(); err != nil {
+				return nil, fmt.Errorf("sites: SITES %s: host %q: %w", name, h, err)
+			}
+			site.Hosts = append(site.Hosts, h)
+			site.hosts = append(site.hosts, rt)
+		}
+		if len(site.Hosts) == 0 {
+			return nil, fmt.Errorf("sites: SITES %s: no hosts", name)
+		}
+		byName[name] = site
+		s.named = append(s.named, site)
+	}
+	sort.Slice(s.named, func(i, j int) bool { return s.named[i].Name < s.named[j].Name })
+
+	if cfg.Default != "" {
+		s.def = byName[cfg.Default]
+		if s.def == nil {
+			if cfg.Default != Default {
+				return nil, fmt.Errorf("sites: SITE_DEFAULT %q is not in SITES", cfg.Default)
+			}
+			s.def = &Site{Name: Default}
+			byName[Default] = s.def
+		}
+	}
+
+	for name, raw := range cfg.Routes {
+		site := byName[name]
+		if site == nil {
+			return nil, fmt.Errorf("sites: SITE_ROUTES: unknown site %q", name)
+		}
+		site.routes = splitBar(raw)
+	}
+	for name, raw := range cfg.Middleware {
+		site := byName[name]
+		if site == nil {
+			return nil, fmt.Errorf("sites: SITE_MIDDLEWARE: unknown site %q", name)
+		}
+		site.middleware = splitBar(raw)
+	}
+	for name, raw := range cfg.TLS {
+		site := byName[name]
+		if site == nil {
+			return nil, fmt.Errorf("sites: SITE_TLS: unknown site %q", name)
+		}
+		certFile, keyFile, ok := strings.Cut(raw, "|")
+		if !ok {
+			return nil, fmt.Errorf("sites: SITE_TLS %s: want cert.pem|key.pem", name)
+		}
+		cert, err := tls.LoadX509KeyPair(strings.TrimSpace(certFile), strings.TrimSpace(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("sites: SITE_TLS %s: %w", name, err)
+		}
+		site.cert = &cert
+	}
+	return s, nil
+}
+
+// Enabled reports whether any named sites are configured.
+func (s *Sites) Enabled() bool {
+	return len(s.named) > 0
+}
+
+// Mount adds a subrouter per site to r, named sites first and the default
+// site last as the catch-all. Every site runs always, then the parts of
+// stack and the groups its SITE_MIDDLEWARE and SITE_ROUTES select, in the
+// order given here.
+func (s *Sites) Mount(r *mux.Router, always, stack []Middleware, groups []Group) error {
+	known := map[string]bool{}
+	for _, m := range always {
+		known["always "+m.Name] = true
+	}
+	for _, m := range stack {
+		known["middleware "+m.Name] = true
+	}
+	for _, g := range groups {
+		known["route group "+g.Name] = true
+	}
+	sites := s.named
+	if s.def != nil {
+		sites = append(sites[:len(sites):len(sites)], s.def)
+	}
+	for i, site := range sites {
+		for _, name := range site.middleware {
+			if known["always "+name] {
+				return fmt.Errorf("sites: SITE_MIDDLEWARE %s: %s runs on every site and cannot be selected", site.Name, name)
+			}
+			if !known["middleware "+name] {
+				return fmt.Errorf("sites: SITE_MIDDLEWARE %s: unknown middleware %q", site.Name, name)
+			}
+		}
+		for _, name := range site.routes {
+			if !known["route group "+name] {
+				return fmt.Errorf("sites: SITE_ROUTES %s: unknown route group %q", site.Name, name)
+			}
+		}
+
+		// The default site comes last and takes every host, even when it is
+		// also a named site.
+		route := r.NewRoute()
+		if i < len(s.named) {
+			route = route.MatcherFunc(site.match)
+		}
+		sr := route.Subrouter()
+		sr.Use(s.label(site.Name))
+		// Claim unknown paths, so they are not served by the default site.
+		sr.NotFoundHandler = s.label(site.Name)(http.NotFoundHandler())
+		for _, m := range always {
+			sr.Use(m.Func)
+		}
+		for _, m := range stack {
+			if site.uses(m.Name) {
+				sr.Use(m.Func)
+			}
+		}
+		for _, g := range groups {
+			if site.serves(g.Name) {
+				g.Register(sr)
+			}
+		}
+		if s.Enabled() && i < len(s.named) {
+			slog.Info("site mounted", "site", site.Name, "hosts", site.Hosts, "tls", site.cert != nil)
+		}
+	}
+	return nil
+}
+
+// label names the site in the request metrics and, with several sites,
+// the access log.
+func (s *Sites) label(name string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			telemetry.SetSite(r.Context(), name)
+			if s.Enabled() {
+				telemetry.AddLogAttrs(r.Context(), slog.String("site", name))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// match reports whether r is for one of the site's hosts.
+func (site *Site) match(r *http.Request, _ *mux.RouteMatch) bool {
+	for _, h := range site.hosts {
+		if h.Match(r, &mux.RouteMatch{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (site *Site) uses(middleware string) bool {
+	return site.middleware == nil || slices.Contains(site.middleware, middleware)
+}
+
+func (site *Site) serves(group string) bool {
+	return site.routes == nil || slices.Contains(site.routes, group)
+}
+
+// TLSConfig selects each site's certificate by SNI, falling back to the
+// default site's. It returns nil when no site has a certificate.
+func (s *Sites) TLSConfig() *tls.Config {
+	var fallback *tls.Certificate
+	if s.def != nil {
+		fallback = s.def.cert
+	}
+	for _, site := range s.named {
+		if fallback == nil {
+			fallback = site.cert
+		}
+	}
+	if fallback == nil {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			req := &http.Request{Host: hello.ServerName, URL: &url.URL{}}
+			for _, site := range s.named {
+				if site.cert != nil && site.match(req, nil) {
+					return site.cert, nil
+				}
+			}
+			return fallback, nil
+		},
+	}
+}
+
+func splitBar(raw string) []string {
+	out := []string{}
+	for _, s := range strings.Split(raw, "|") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/app/internal/config"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// client sends OTLP export requests to a collector.
+type client interface {
+	exportMetrics(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error
+	exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error
+	close() error
+}
+
+// retryableError marks a failure worth retrying, optionally with the delay
+// the collector asked for.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+func newClient(cfg config.OTLPConfig) (client, error) {
+	if cfg.Protocol == "http" {
+		return newHTTPClient(cfg), nil
+	}
+	return newGRPCClient(cfg)
+}
+
+type grpcClient struct {
+	conn    *grpc.ClientConn
+	metrics colmetricpb.MetricsServiceClient
+	logs    collogspb.LogsServiceClient
+	md      metadata.MD
+}
+
+func newGRPCClient(cfg config.OTLPConfig) (*grpcClient, error) {
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if cfg.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("telemetry: dial %s: %w", cfg.Endpoint, err)
+	}
+	return &grpcClient{
+		conn:    conn,
+		metrics: colmetricpb.NewMetricsServiceClient(conn),
+		logs:    collogspb.NewLogsServiceClient(conn),
+		md:      metadata.New(cfg.Headers),
+	}, nil
+}
+
+func (c *grpcClient) exportMetrics(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	_, err := c.metrics.Export(metadata.NewOutgoingContext(ctx, c.md), req)
+	return grpcError(err)
+}
+
+func (c *grpcClient) exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	_, err := c.logs.Export(metadata.NewOutgoingContext(ctx, c.md), req)
+	return grpcError(err)
+}
+
+func (c *grpcClient) close() error { return c.conn.Close() }
+
+// grpcError classifies status codes per the OTLP specification.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+		return &retryableError{err: err}
+	}
+	return err
+}
+
+type httpClient struct {
+	base    string
+	headers map[string]string
+	http    *http.Client
+}
+
+func newHTTPClient(cfg config.OTLPConfig) *httpClient {
+	base := cfg.Endpoint
+	if !strings.Contains(base, "://") {
+		scheme := "https://"
+		if cfg.Insecure {
+			scheme = "http://"
+		}
+		base = scheme + base
+	}
+	return &httpClient{
+		base:    strings.TrimRight(base, "/"),
+		headers: cfg.Headers,
+		http:    &http.Client{},
+	}
+}
+
+func (c *httpClient) exportMetrics(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) error {
+	return c.post(ctx, "/v1/metrics", req)
+}
+
+func (c *httpClient) exportLogs(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	return c.post(ctx, "/v1/logs", req)
+}
+
+func (c *httpClient) close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+func (c *httpClient) post(ctx context.Context, path string, msg proto.Message) error {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("telemetry: %s returned %s", path, resp.Status)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &retryableError{err: err, after: retryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return err
+}
+
+func retryAfter(v string) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// send calls fn until it succeeds, fails permanently or retries run out,
+// backing off exponentially between attempts.
+func send(ctx context.Context, cfg config.OTLPConfig, fn func(context.Context) error) error {
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		reqCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		err := fn(reqCtx)
+		cancel()
+
+		var re *retryableError
+		if err == nil || !errors.As(err, &re) || attempt >= cfg.MaxRetries {
+			return err
+		}
+		wait := max(backoff, re.after)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
@@ -0,0 +1,105 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// logHandler forwards every record to the wrapped handler and also queues it
+// for OTLP export.
+type logHandler struct {
+	next   slog.Handler
+	exp    *Exporter
+	attrs  []*commonpb.KeyValue
+	prefix string
+}
+
+func newLogHandler(next slog.Handler, exp *Exporter) *logHandler {
+	return &logHandler{next: next, exp: exp}
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := append([]*commonpb.KeyValue(nil), h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendAttr(attrs, h.prefix, a)
+		return true
+	})
+	h.exp.enqueueLog(&logspb.LogRecord{
+		TimeUnixNano:         uint64(r.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severity(r.Level),
+		SeverityText:         r.Level.String(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: r.Message}},
+		Attributes:           attrs,
+	})
+	return h.next.Handle(ctx, r)
+}
+
+func (h *logHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	attrs := append([]*commonpb.KeyValue(nil), h.attrs...)
+	for _, a := range as {
+		attrs = appendAttr(attrs, h.prefix, a)
+	}
+	return &logHandler{next: h.next.WithAttrs(as), exp: h.exp, attrs: attrs, prefix: h.prefix}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &logHandler{next: h.next.WithGroup(name), exp: h.exp, attrs: h.attrs, prefix: h.prefix + name + "."}
+}
+
+// appendAttr flattens groups into dotted keys, the usual OTLP convention.
+func appendAttr(dst []*commonpb.KeyValue, prefix string, a slog.Attr) []*commonpb.KeyValue {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		p := prefix
+		if a.Key != "" {
+			p += a.Key + "."
+		}
+		for _, ga := range v.Group() {
+			dst = appendAttr(dst, p, ga)
+		}
+		return dst
+	}
+	if a.Key == "" {
+		return dst
+	}
+	return append(dst, &commonpb.KeyValue{Key: prefix + a.Key, Value: anyValue(v)})
+}
+
+func anyValue(v slog.Value) *commonpb.AnyValue {
+	switch v.Kind() {
+	case slog.KindBool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.Bool()}}
+	case slog.KindInt64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.Int64()}}
+	case slog.KindUint64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v.Uint64())}}
+	case slog.KindFloat64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.Float64()}}
+	}
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.String()}}
+}
+
+// severity maps slog levels onto the OTLP severity number ranges.
+func severity(l slog.Level) logspb.SeverityNumber {
+	switch {
+	case l < slog.LevelInfo:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case l < slog.LevelWarn:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case l < slog.LevelError:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	}
+	return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+}
@@ -0,0 +1,220 @@
+package telemetry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind identifies the type of a metric family.
+type Kind int
+
+const (
+	KindCounter Kind = iota
+	KindGauge
+	KindHistogram
+)
+
+// DefBuckets are latency buckets in seconds, matching the Prometheus client defaults.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds all metrics of the process. It is the single source for
+// both the Prometheus /metrics endpoint and the OTLP exporter.
+type Registry struct {
+	mu       sync.RWMutex
+	families []*family
+	byName   map[string]*family
+	start    time.Time
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: map[string]*family{}, start: time.Now()}
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    Kind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	count  uint64
+	sum    float64
+	counts []uint64
+}
+
+// Counter is a monotonically increasing value, optionally split by labels.
+type Counter struct{ f *family }
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ f *family }
+
+// Histogram samples observations into buckets.
+type Histogram struct{ f *family }
+
+// Counter registers (or returns the already registered) counter with name.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, KindCounter, nil, labels)}
+}
+
+// Gauge registers (or returns the already registered) gauge with name.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, KindGauge, nil, labels)}
+}
+
+// Histogram registers (or returns the already registered) histogram with
+// name. A nil buckets uses DefBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	return &Histogram{r.register(name, help, KindHistogram, buckets, labels)}
+}
+
+func (r *Registry) register(name, help string, kind Kind, buckets []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.byName[name]; ok {
+		if f.kind != kind || len(f.labels) != len(labels) {
+			panic(fmt.Sprintf("telemetry: metric %s re-registered with a different shape", name))
+		}
+		return f
+	}
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*series{},
+	}
+	r.families = append(r.families, f)
+	r.byName[name] = f
+	return f
+}
+
+// with returns the series for values, creating it on first use.
+// The caller must hold f.mu.
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("telemetry: metric %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == KindHistogram {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("telemetry: counter cannot decrease")
+	}
+	c.f.mu.Lock()
+	c.f.with(values).value += v
+	c.f.mu.Unlock()
+}
+
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.with(values).value = v
+	g.f.mu.Unlock()
+}
+
+func (g *Gauge) Add(v float64, values ...string) {
+	g.f.mu.Lock()
+	g.f.with(values).value += v
+	g.f.mu.Unlock()
+}
+
+func (g *Gauge) Inc(values ...string) { g.Add(1, values...) }
+func (g *Gauge) Dec(values ...string) { g.Add(-1, values...) }
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.with(values)
+	i := sort.SearchFloat64s(h.f.buckets, v)
+	s.counts[i]++
+	s.count++
+	s.sum += v
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Family is a point-in-time copy of one metric and all its series.
+type Family struct {
+	Name    string
+	Help    string
+	Kind    Kind
+	Labels  []string
+	Buckets []float64
+	Points  []Point
+}
+
+// Point is a single series of a Family. For histograms Counts holds the
+// per-bucket (non-cumulative) counts with a trailing +Inf bucket.
+type Point struct {
+	Values []string
+	Value  float64
+	Count  uint64
+	Sum    float64
+	Counts []uint64
+}
+
+// Gather returns a consistent snapshot of every registered metric.
+func (r *Registry) Gather() []Family {
+	r.mu.RLock()
+	families := append([]*family(nil), r.families...)
+	r.mu.RUnlock()
+
+	out := make([]Family, 0, len(families))
+	for _, f := range families {
+		f.mu.Lock()
+		fam := Family{
+			Name:    f.name,
+			Help:    f.help,
+			Kind:    f.kind,
+			Labels:  f.labels,
+			Buckets: f.buckets,
+			Points:  make([]Point, 0, len(f.series)),
+		}
+		for _, s := range f.series {
+			fam.Points = append(fam.Points, Point{
+				Values: s.values,
+				Value:  s.value,
+				Count:  s.count,
+				Sum:    s.sum,
+				Counts: append([]uint64(nil), s.counts...),
+			})
+		}
+		f.mu.Unlock()
+		sort.Slice(fam.Points, func(i, j int) bool {
+			return strings.Join(fam.Points[i].Values, "\xff") < strings.Join(fam.Points[j].Values, "\xff")
+		})
+		out = append(out, fam)
+	}
+	return out
+}
+
+// StartTime is the start of the cumulative aggregation window of every metric.
+func (r *Registry) StartTime() time.Time { return r.start }
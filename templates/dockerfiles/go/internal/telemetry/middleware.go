@@ -0,0 +1,160 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HTTPMetrics holds the standard request metrics.
+type HTTPMetrics struct {
+	requests *Counter
+	duration *Histogram
+	inFlight *Gauge
+}
+
+func NewHTTPMetrics(reg *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: reg.Counter("http_requests_total", "Total HTTP requests by site, method, route and status code.", "site", "method", "route", "code"),
+		duration: reg.Histogram("http_request_duration_seconds", "HTTP request latency by site, method and route.", nil, "site", "method", "route"),
+		inFlight: reg.Gauge("http_requests_in_flight", "HTTP requests currently being served."),
+	}
+}
+
+// Middleware records request count, latency and in-flight requests. It is
+// meant to be installed with mux.Router.Use so the route template is known.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		site := "default"
+		r = r.WithContext(context.WithValue(r.Context(), siteKey{}, &site))
+		rec := NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		route := RouteName(r)
+		m.requests.Inc(site, r.Method, route, strconv.Itoa(rec.Status()))
+		m.duration.ObserveSince(start, site, r.Method, route)
+	})
+}
+
+type siteKey struct{}
+
+// SetSite records which site served the request ctx belongs to, for the
+// site label of the request metrics. It is "default" until set.
+func SetSite(ctx context.Context, name string) {
+	if site, ok := ctx.Value(siteKey{}).(*string); ok {
+		*site = name
+	}
+}
+
+// Site returns the site set with SetSite, or "" outside the request
+// metrics middleware.
+func Site(ctx context.Context) string {
+	if site, ok := ctx.Value(siteKey{}).(*string); ok {
+		return *site
+	}
+	return ""
+}
+
+type logAttrsKey struct{}
+
+// AddLogAttrs adds attributes to the access log line of the request ctx
+// belongs to, e.g. decisions made deep inside a handler.
+func AddLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if extra, ok := ctx.Value(logAttrsKey{}).(*[]slog.Attr); ok {
+		*extra = append(*extra, attrs...)
+	}
+}
+
+// AccessLog logs one line per request.
+func AccessLog(logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := NewResponseRecorder(w)
+			var extra []slog.Attr
+			r = r.WithContext(context.WithValue(r.Context(), logAttrsKey{}, &extra))
+			next.ServeHTTP(rec, r)
+
+			attrs := append([]slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", RouteName(r)),
+				slog.Int("status", rec.Status()),
+				slog.Int64("bytes", rec.Written()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote", r.RemoteAddr),
+			}, extra...)
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+		})
+	}
+}
+
+// RouteName returns the path template of the matched mux route, which keeps
+// metric cardinality bounded.
+func RouteName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+// ResponseRecorder captures the status code and body size written through it.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+func (r *ResponseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.written += int64(n)
+	return n, err
+}
+
+// Flush lets streaming handlers work through the recorder.
+func (r *ResponseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// Status returns the response status, 200 if the handler never set one.
+func (r *ResponseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// WroteHeader reports whether the status line has been sent.
+func (r *ResponseRecorder) WroteHeader() bool { return r.status != 0 }
+
+// Written returns the number of body bytes written.
+func (r *ResponseRecorder) Written() int64 { return r.written }
@@ -0,0 +1,252 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/instance"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	scopeName     = "github.com/example/app"
+	logFlushEvery = 2 * time.Second
+)
+
+// Exporter pushes metrics and logs to an OTLP collector. Records are held in
+// bounded queues and sent in batches from background goroutines, so a slow
+// or unreachable collector never blocks request handling.
+type Exporter struct {
+	cfg      config.OTLPConfig
+	client   client
+	resource *resourcepb.Resource
+	scope    *commonpb.InstrumentationScope
+	reg      *Registry
+
+	metrics *queue[*metricspb.Metric]
+	logs    *queue[*logspb.LogRecord]
+
+	dropped *Counter
+	failed  *Counter
+	sent    *Counter
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewExporter(cfg *config.Config, self *instance.Identity, reg *Registry) (*Exporter, error) {
+	c, err := newClient(cfg.OTLP)
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		cfg:      cfg.OTLP,
+		client:   c,
+		resource: newResource(cfg, self),
+		scope:    &commonpb.InstrumentationScope{Name: scopeName, Version: cfg.Version},
+		reg:      reg,
+		metrics:  newQueue[*metricspb.Metric](cfg.OTLP.QueueSize, cfg.OTLP.BatchSize),
+		logs:     newQueue[*logspb.LogRecord](cfg.OTLP.QueueSize, cfg.OTLP.BatchSize),
+		dropped:  reg.Counter("otlp_dropped_total", "Records dropped because the export buffer was full or retries ran out.", "signal"),
+		failed:   reg.Counter("otlp_export_failures_total", "Export requests that failed after all retries.", "signal"),
+		sent:     reg.Counter("otlp_exported_total", "Records successfully exported.", "signal"),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start launches the background export loops.
+func (e *Exporter) Start() {
+	if e.cfg.Metrics {
+		e.wg.Add(1)
+		go e.loop(e.cfg.ExportInterval, nil, func(ctx context.Context) {
+			e.collect()
+			e.flushMetrics(ctx)
+		})
+	}
+	if e.cfg.Logs {
+		e.wg.Add(1)
+		go e.loop(logFlushEvery, e.logs.ready, e.flushLogs)
+	}
+}
+
+func (e *Exporter) loop(every time.Duration, ready <-chan struct{}, fn func(context.Context)) {
+	defer e.wg.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-e.stop
+		cancel()
+	}()
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-t.C:
+		case <-ready:
+		}
+		fn(ctx)
+	}
+}
+
+// Shutdown stops the loops and makes a final attempt to deliver whatever is
+// still buffered before ctx expires.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	close(e.stop)
+	e.wg.Wait()
+
+	if e.cfg.Metrics {
+		e.collect()
+		e.flushMetrics(ctx)
+	}
+	if e.cfg.Logs {
+		e.flushLogs(ctx)
+	}
+	var err error
+	if n := e.metrics.len() + e.logs.len(); n > 0 {
+		err = errors.New("telemetry: shutdown left records unexported")
+	}
+	return errors.Join(err, e.client.close())
+}
+
+// collect snapshots the registry into the metrics queue.
+func (e *Exporter) collect() {
+	now := uint64(time.Now().UnixNano())
+	start := uint64(e.reg.StartTime().UnixNano())
+	var out []*metricspb.Metric
+	for _, f := range e.reg.Gather() {
+		if len(f.Points) == 0 {
+			continue
+		}
+		out = append(out, toOTLPMetric(f, start, now))
+	}
+	if n := e.metrics.push(out...); n > 0 {
+		e.dropped.Add(float64(n), "metrics")
+	}
+}
+
+// enqueueLog is called from the slog handler on the request path; it never blocks.
+func (e *Exporter) enqueueLog(rec *logspb.LogRecord) {
+	if n := e.logs.push(rec); n > 0 {
+		e.dropped.Add(float64(n), "logs")
+	}
+}
+
+func (e *Exporter) flushMetrics(ctx context.Context) {
+	for batch := e.metrics.pop(); batch != nil; batch = e.metrics.pop() {
+		req := &colmetricpb.ExportMetricsServiceRequest{
+			ResourceMetrics: []*metricspb.ResourceMetrics{{
+				Resource:     e.resource,
+				ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: e.scope, Metrics: batch}},
+			}},
+		}
+		err := send(ctx, e.cfg, func(ctx context.Context) error { return e.client.exportMetrics(ctx, req) })
+		if !e.account("metrics", len(batch), err) {
+			return
+		}
+	}
+}
+
+func (e *Exporter) flushLogs(ctx context.Context) {
+	for batch := e.logs.pop(); batch != nil; batch = e.logs.pop() {
+		req := &collogspb.ExportLogsServiceRequest{
+			ResourceLogs: []*logspb.ResourceLogs{{
+				Resource:  e.resource,
+				ScopeLogs: []*logspb.ScopeLogs{{Scope: e.scope, LogRecords: batch}},
+			}},
+		}
+		err := send(ctx, e.cfg, func(ctx context.Context) error { return e.client.exportLogs(ctx, req) })
+		if !e.account("logs", len(batch), err) {
+			return
+		}
+	}
+}
+
+// account updates the export counters and reports whether flushing should
+// continue with the next batch.
+func (e *Exporter) account(signal string, n int, err error) bool {
+	if err == nil {
+		e.sent.Add(float64(n), signal)
+		return true
+	}
+	// Export errors are deliberately not logged: with log export enabled
+	// that would feed the failure straight back into the queue.
+	e.failed.Inc(signal)
+	e.dropped.Add(float64(n), signal)
+	return false
+}
+
+func toOTLPMetric(f Family, start, now uint64) *metricspb.Metric {
+	m := &metricspb.Metric{Name: f.Name, Description: f.Help}
+	switch f.Kind {
+	case KindCounter:
+		m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+			DataPoints:             numberPoints(f, start, now),
+		}}
+	case KindGauge:
+		m.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: numberPoints(f, start, now),
+		}}
+	case KindHistogram:
+		h := &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}
+		for _, p := range f.Points {
+			sum := p.Sum
+			h.DataPoints = append(h.DataPoints, &metricspb.HistogramDataPoint{
+				Attributes:        pointAttrs(f.Labels, p.Values),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      now,
+				Count:             p.Count,
+				Sum:               &sum,
+				BucketCounts:      p.Counts,
+				ExplicitBounds:    f.Buckets,
+			})
+		}
+		m.Data = &metricspb.Metric_Histogram{Histogram: h}
+	}
+	return m
+}
+
+func numberPoints(f Family, start, now uint64) []*metricspb.NumberDataPoint {
+	out := make([]*metricspb.NumberDataPoint, 0, len(f.Points))
+	for _, p := range f.Points {
+		out = append(out, &metricspb.NumberDataPoint{
+			Attributes:        pointAttrs(f.Labels, p.Values),
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: p.Value},
+		})
+	}
+	return out
+}
+
+func pointAttrs(names, values []string) []*commonpb.KeyValue {
+	out := make([]*commonpb.KeyValue, len(names))
+	for i, n := range names {
+		out[i] = stringAttr(n, values[i])
+	}
+	return out
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler serves the registry in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, f := range r.Gather() {
+			writeFamily(bw, f)
+		}
+		bw.Flush()
+	})
+}
+
+func writeFamily(w *bufio.Writer, f Family) {
+	typ := "counter"
+	switch f.Kind {
+	case KindGauge:
+		typ = "gauge"
+	case KindHistogram:
+		typ = "histogram"
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, typ)
+
+	for _, p := range f.Points {
+		if f.Kind != KindHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.Name, labelString(f.Labels, p.Values, "", ""), formatFloat(p.Value))
+			continue
+		}
+		var cum uint64
+		for i, b := range f.Buckets {
+			cum += p.Counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.Name, labelString(f.Labels, p.Values, "le", formatFloat(b)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.Name, labelString(f.Labels, p.Values, "le", "+Inf"), p.Count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.Name, labelString(f.Labels, p.Values, "", ""), formatFloat(p.Sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.Name, labelString(f.Labels, p.Values, "", ""), p.Count)
+	}
+}
+
+func labelString(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, n, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,65 @@
+package telemetry
+
+import "sync"
+
+// queue is a bounded FIFO buffer. When full, the oldest items are dropped so
+// that a collector outage never blocks the request path or grows memory.
+type queue[T any] struct {
+	mu    sync.Mutex
+	items []T
+	max   int
+	batch int
+	ready chan struct{}
+}
+
+func newQueue[T any](size, batch int) *queue[T] {
+	return &queue[T]{max: size, batch: batch, ready: make(chan struct{}, 1)}
+}
+
+// push appends items and reports how many older items were dropped to make room.
+func (q *queue[T]) push(items ...T) int {
+	q.mu.Lock()
+	q.items = append(q.items, items...)
+	dropped := 0
+	if over := len(q.items) - q.max; over > 0 {
+		var zero T
+		for i := 0; i < over; i++ {
+			q.items[i] = zero
+		}
+		q.items = q.items[over:]
+		dropped = over
+	}
+	full := len(q.items) >= q.batch
+	q.mu.Unlock()
+
+	if full {
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+	}
+	return dropped
+}
+
+// pop removes and returns up to one batch of items.
+func (q *queue[T]) pop() []T {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := min(len(q.items), q.batch)
+	if n == 0 {
+		return nil
+	}
+	out := make([]T, n)
+	copy(out, q.items)
+	q.items = q.items[n:]
+	if len(q.items) == 0 {
+		q.items = nil
+	}
+	return out
+}
+
+func (q *queue[T]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
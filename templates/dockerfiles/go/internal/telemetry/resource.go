@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"runtime"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/instance"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// newResource describes this process using OpenTelemetry semantic
+// convention attribute names. The instance ID is the one responses carry.
+func newResource(cfg *config.Config, self *instance.Identity) *resourcepb.Resource {
+	attrs := map[string]string{
+		"service.name":            cfg.ServiceName,
+		"service.version":         cfg.Version,
+		"deployment.environment":  cfg.Environment,
+		"process.runtime.name":    "go",
+		"process.runtime.version": runtime.Version(),
+		"service.instance.id":     self.ID,
+	}
+	if self.Hostname != "" {
+		attrs["host.name"] = self.Hostname
+	}
+	if self.ContainerID != "" {
+		attrs["container.id"] = self.ContainerID
+	}
+
+	res := &resourcepb.Resource{}
+	for _, k := range sortedKeys(attrs) {
+		res.Attributes = append(res.Attributes, stringAttr(k, attrs[k]))
+	}
+	return res
+}
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   k,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}},
+	}
+}
@@ -0,0 +1,83 @@
+// Package telemetry provides the service's metrics registry, structured
+// logging and optional OTLP push export of both.
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/instance"
+)
+
+// Telemetry bundles the process-wide logger and metrics.
+type Telemetry struct {
+	Registry *Registry
+	Logger   *slog.Logger
+	HTTP     *HTTPMetrics
+
+	exporter *Exporter
+	level    slog.LevelVar
+}
+
+// Setup builds the logger and registry from cfg, starts the OTLP exporter
+// when enabled and installs the logger as the slog (and log) default. self
+// identifies the process in exported telemetry.
+func Setup(cfg *config.Config, self *instance.Identity) (*Telemetry, error) {
+	t := &Telemetry{Registry: NewRegistry()}
+	t.SetLevel(cfg.LogLevel)
+	opts := &slog.HandlerOptions{Level: &t.level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stdout, opts)
+	if cfg.LogFormat == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+
+	t.HTTP = NewHTTPMetrics(t.Registry)
+
+	if cfg.OTLP.Enabled() {
+		exp, err := NewExporter(cfg, self, t.Registry)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.OTLP.Logs {
+			handler = newLogHandler(handler, exp)
+		}
+		exp.Start()
+		t.exporter = exp
+	}
+
+	t.Logger = slog.New(handler).With("service", cfg.ServiceName)
+	slog.SetDefault(t.Logger)
+	return t, nil
+}
+
+// WrapLogger installs mw around the current log handler and makes the
+// result the default logger.
+func (t *Telemetry) WrapLogger(mw func(slog.Handler) slog.Handler) {
+	t.Logger = slog.New(mw(t.Logger.Handler()))
+	slog.SetDefault(t.Logger)
+}
+
+// SetLevel changes the minimum log level (debug, info, warn, error) while
+// running.
+func (t *Telemetry) SetLevel(level string) {
+	t.level.Set(parseLevel(level))
+}
+
+// Shutdown flushes buffered telemetry.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+func parseLevel(s string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(s))); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
@@ -0,0 +1,99 @@
+package usage
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/example/app/internal/admin"
+	"github.com/example/app/internal/problem"
+	"github.com/gorilla/mux"
+)
+
+// ConsumerUsage is a consumer's usage in the current periods.
+type ConsumerUsage struct {
+	Consumer string `json:"consumer"`
+	Today    int64  `json:"today"`
+	Month    int64  `json:"month"`
+	Quota    Quota  `json:"quota"`
+}
+
+// Report is a consumer's usage over a time range.
+type Report struct {
+	Consumer string            `json:"consumer"`
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Total    Counts            `json:"total"`
+	Routes   map[string]Counts `json:"routes"`
+	Buckets  []Bucket          `json:"buckets"`
+}
+
+// RegisterAdmin adds the usage endpoints to the admin router:
+//
+//	GET /usage                       requests per consumer today and this month, with quotas
+//	GET /usage/{consumer}?from=&to=  usage by route and time bucket; this month by default
+//
+// from and to are dates (2006-01-02) or RFC 3339 times, to exclusive.
+func (m *Meter) RegisterAdmin(r *mux.Router) {
+	r.HandleFunc("/usage", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		m.mu.Lock()
+		out := make([]ConsumerUsage, 0, len(m.totals))
+		for consumer := range m.totals {
+			p := m.periods(consumer, now)
+			out = append(out, ConsumerUsage{Consumer: consumer, Today: p.daily, Month: p.monthly, Quota: m.quota(consumer)})
+		}
+		m.mu.Unlock()
+		sort.Slice(out, func(i, j int) bool { return out[i].Consumer < out[j].Consumer })
+		admin.WriteJSON(w, http.StatusOK, out)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/usage/{consumer}", func(w http.ResponseWriter, r *http.Request) {
+		_, month := periodStart(time.Now())
+		from, err := parseTime(r.URL.Query().Get("from"), month)
+		if err != nil {
+			problem.Write(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		to, err := parseTime(r.URL.Query().Get("to"), time.Now().UTC().Add(m.cfg.Bucket))
+		if err != nil {
+			problem.Write(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rep := Report{Consumer: mux.Vars(r)["consumer"], From: from, To: to, Routes: map[string]Counts{}}
+		if rep.Buckets, err = m.Buckets(r.Context(), rep.Consumer, from, to); err != nil {
+			problem.Write(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, b := range rep.Buckets {
+			rt := rep.Routes[b.Route]
+			rt.Requests += b.Requests
+			rt.Bytes += b.Bytes
+			rep.Routes[b.Route] = rt
+			rep.Total.Requests += b.Requests
+			rep.Total.Bytes += b.Bytes
+		}
+		admin.WriteJSON(w, http.StatusOK, rep)
+	}).Methods(http.MethodGet)
+}
+
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a date (2006-01-02) nor an RFC 3339 time", s)
+}
+
+func sortBuckets(b []Bucket) {
+	sort.Slice(b, func(i, j int) bool {
+		if !b[i].Start.Equal(b[j].Start) {
+			return b[i].Start.Before(b[j].Start)
+		}
+		return b[i].Route < b[j].Route
+	})
+}
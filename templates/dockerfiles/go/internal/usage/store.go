@@ -0,0 +1,179 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// schema is created at startup. Buckets of one consumer and route are
+// added to by every replica, so rows are only ever incremented.
+const schema = `CREATE TABLE IF NOT EXISTS api_usage (
+	consumer text        NOT NULL,
+	route    text        NOT NULL,
+	bucket   timestamptz NOT NULL,
+	requests bigint      NOT NULL DEFAULT 0,
+	bytes    bigint      NOT NULL DEFAULT 0,
+	PRIMARY KEY (consumer, route, bucket)
+)`
+
+const upsert = `INSERT INTO api_usage (consumer, route, bucket, requests, bytes) VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (consumer, route, bucket) DO UPDATE
+SET requests = api_usage.requests + excluded.requests, bytes = api_usage.bytes + excluded.bytes`
+
+// Start creates the table and reads this month's totals, so quotas hold
+// across restarts, and then lets requests through. Without a database
+// there is nothing to read.
+func (m *Meter) Start(ctx context.Context) error {
+	if m.db != nil {
+		if _, err := m.db.ExecContext(ctx, schema); err != nil {
+			return fmt.Errorf("usage: create table: %w", err)
+		}
+		if err := m.sync(ctx); err != nil {
+			return err
+		}
+	}
+	m.loaded.Store(true)
+	return nil
+}
+
+// Flush adds the pending usage to the database and reads back the totals
+// of every replica. On failure the usage stays pending for the next one.
+func (m *Meter) Flush(ctx context.Context) error {
+	if m.db == nil {
+		return nil
+	}
+	m.mu.Lock()
+	batch := m.pending
+	m.pending = map[key]*Counts{}
+	m.mu.Unlock()
+
+	if err := m.write(ctx, batch); err != nil {
+		m.failures.Inc()
+		m.mu.Lock()
+		for k, c := range batch {
+			merge(m.pending, k, *c)
+		}
+		m.mu.Unlock()
+		return err
+	}
+	return m.sync(ctx)
+}
+
+func (m *Meter) write(ctx context.Context, batch map[key]*Counts) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, upsert)
+	if err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	defer stmt.Close()
+	for k, c := range batch {
+		if _, err := stmt.ExecContext(ctx, k.consumer, k.route, k.bucket, c.Requests, c.Bytes); err != nil {
+			return fmt.Errorf("usage: write %s: %w", k.consumer, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	return nil
+}
+
+// sync replaces the quota counts with the database totals plus what is
+// still pending.
+func (m *Meter) sync(ctx context.Context) error {
+	day, month := periodStart(time.Now())
+	rows, err := m.db.QueryContext(ctx, `SELECT consumer,
+		COALESCE(SUM(requests) FILTER (WHERE bucket >= $1), 0), COALESCE(SUM(requests), 0)
+		FROM api_usage WHERE bucket >= $2 GROUP BY consumer`, day, month)
+	if err != nil {
+		return fmt.Errorf("usage: read totals: %w", err)
+	}
+	defer rows.Close()
+	totals := map[string]*periods{}
+	for rows.Next() {
+		p := &periods{day: day, month: month}
+		var consumer string
+		if err := rows.Scan(&consumer, &p.daily, &p.monthly); err != nil {
+			return fmt.Errorf("usage: read totals: %w", err)
+		}
+		totals[consumer] = p
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("usage: read totals: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, c := range m.pending {
+		if k.bucket.Before(month) {
+			continue
+		}
+		p := totals[k.consumer]
+		if p == nil {
+			p = &periods{day: day, month: month}
+			totals[k.consumer] = p
+		}
+		p.monthly += c.Requests
+		if !k.bucket.Before(day) {
+			p.daily += c.Requests
+		}
+	}
+	m.totals = totals
+	return nil
+}
+
+// Bucket is a consumer's usage of a route in one time bucket.
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Route string    `json:"route"`
+	Counts
+}
+
+// Buckets returns a consumer's usage in [from, to), including what is not
+// yet written, ordered by time and route.
+func (m *Meter) Buckets(ctx context.Context, consumer string, from, to time.Time) ([]Bucket, error) {
+	merged := map[key]*Counts{}
+	if m.db != nil {
+		rows, err := m.db.QueryContext(ctx, `SELECT route, bucket, requests, bytes FROM api_usage
+			WHERE consumer = $1 AND bucket >= $2 AND bucket < $3`, consumer, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("usage: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			k := key{consumer: consumer}
+			var c Counts
+			if err := rows.Scan(&k.route, &k.bucket, &c.Requests, &c.Bytes); err != nil {
+				return nil, fmt.Errorf("usage: %w", err)
+			}
+			k.bucket = k.bucket.UTC()
+			merge(merged, k, c)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("usage: %w", err)
+		}
+	}
+	m.mu.Lock()
+	for _, src := range []map[key]*Counts{m.pending, m.history} {
+		for k, c := range src {
+			if k.consumer == consumer && !k.bucket.Before(from) && k.bucket.Before(to) {
+				merge(merged, k, *c)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	out := make([]Bucket, 0, len(merged))
+	for k, c := range merged {
+		out = append(out, Bucket{Start: k.bucket, Route: k.route, Counts: *c})
+	}
+	sortBuckets(out)
+	return out, nil
+}
@@ -0,0 +1,301 @@
+// Package usage meters public requests per consumer, for billing internal
+// teams, and enforces daily and monthly request quotas.
+//
+// Requests and response bytes are counted per consumer, route and time
+// bucket in memory and added to the database every USAGE_FLUSH_INTERVAL.
+// After each flush the day's and month's totals are read back, so the
+// replicas of a deployment enforce quotas on their combined usage, lagging
+// by at most one flush interval.
+package usage
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/app/internal/auth"
+	"github.com/example/app/internal/config"
+	"github.com/example/app/internal/problem"
+	"github.com/example/app/internal/telemetry"
+)
+
+// Anonymous is the consumer of requests that carry no identity.
+const Anonymous = "anonymous"
+
+// Other is the consumer of requests from consumers beyond
+// USAGE_MAX_CONSUMERS in a month. They share its quota.
+const Other = "other"
+
+// ErrNotLoaded is reported by the readiness check until Start has read
+// this month's usage.
+var ErrNotLoaded = errors.New("usage not loaded")
+
+// Meter is the metering middleware and the writer of usage records.
+type Meter struct {
+	cfg    config.UsageConfig
+	db     *sql.DB // nil keeps usage in memory only
+	names  map[string]string
+	quotas map[string]Quota
+	def    Quota
+
+	rejected *telemetry.Counter
+	failures *telemetry.Counter
+	overflow *telemetry.Counter
+
+	loaded atomic.Bool // set once Start has succeeded
+
+	mu      sync.Mutex
+	pending map[key]*Counts     // not yet written to the database
+	history map[key]*Counts     // everything, when there is no database
+	totals  map[string]*periods // per consumer, including pending
+}
+
+// Quota limits the requests of a consumer; 0 is unlimited.
+type Quota struct {
+	Daily   int64 `json:"daily"`
+	Monthly int64 `json:"monthly"`
+}
+
+// Counts is metered usage.
+type Counts struct {
+	Requests int64 `json:"requests"`
+	Bytes    int64 `json:"bytes"`
+}
+
+type key struct {
+	consumer string
+	route    string
+	bucket   time.Time
+}
+
+// periods are a consumer's requests today and this month, both UTC.
+type periods struct {
+	day, month     time.Time
+	daily, monthly int64
+}
+
+// New parses the consumer names and quotas. db may be nil.
+func New(cfg config.UsageConfig, db *sql.DB, reg *telemetry.Registry) (*Meter, error) {
+	m := &Meter{
+		cfg:      cfg,
+		db:       db,
+		names:    map[string]string{},
+		quotas:   map[string]Quota{},
+		def:      Quota{Daily: cfg.DailyQuota, Monthly: cfg.MonthlyQuota},
+		rejected: reg.Counter("usage_quota_rejected_total", "Public requests rejected for exceeding a usage quota, by period (daily, monthly).", "period"),
+		failures: reg.Counter("usage_flush_failures_total", "Usage flushes to the database that failed and will be retried."),
+		overflow: reg.Counter("usage_overflow_total", "Public requests metered as other because USAGE_MAX_CONSUMERS consumers were already tracked."),
+		pending:  map[key]*Counts{},
+		history:  map[key]*Counts{},
+		totals:   map[string]*periods{},
+	}
+	for name, token := range cfg.Names {
+		m.names[token] = name
+	}
+	for name, raw := range cfg.Quotas {
+		daily, monthly, ok := strings.Cut(raw, "/")
+		var q Quota
+		var err1, err2 error
+		q.Daily, err1 = strconv.ParseInt(daily, 10, 64)
+		q.Monthly, err2 = strconv.ParseInt(monthly, 10, 64)
+		if !ok || err1 != nil || err2 != nil || q.Daily < 0 || q.Monthly < 0 {
+			return nil, fmt.Errorf("usage: USAGE_QUOTAS %s: want daily/monthly, got %q", name, raw)
+		}
+		m.quotas[name] = q
+	}
+	if db == nil {
+		slog.Warn("usage is kept in memory only; set DATABASE_URL to persist it")
+	}
+	return m, nil
+}
+
+// Middleware counts each request against its consumer's quotas, answering
+// 429 once one is used up, and meters the response size when it is done.
+// Until Start has succeeded no quota is known, so it answers 503. Rejected
+// requests are not metered.
+func (m *Meter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.loaded.Load() {
+			w.Header().Set("Retry-After", "1")
+			problem.Write(w, http.StatusServiceUnavailable, "usage quotas are not loaded yet")
+			return
+		}
+		now := time.Now().UTC()
+		k := key{consumer: m.consumer(r), route: telemetry.RouteName(r), bucket: now.Truncate(m.cfg.Bucket)}
+		k, period, reset := m.admit(k, now)
+		if period != "" {
+			m.rejected.Inc(period)
+			w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			problem.Write(w, http.StatusTooManyRequests, fmt.Sprintf("%s usage quota exceeded", period))
+			return
+		}
+		telemetry.AddLogAttrs(r.Context(), slog.String("consumer", k.consumer))
+		rec := telemetry.NewResponseRecorder(w)
+		defer func() { m.add(k, Counts{Bytes: rec.Written()}) }()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// ReadinessCheck fails until Start has succeeded.
+func (m *Meter) ReadinessCheck() error {
+	if !m.loaded.Load() {
+		return ErrNotLoaded
+	}
+	return nil
+}
+
+// admit counts a request unless it would exceed a quota, in which case it
+// returns the period exceeded and when that period resets. The returned
+// key is metered instead of k: a consumer beyond USAGE_MAX_CONSUMERS
+// becomes Other.
+func (m *Meter) admit(k key, now time.Time) (key, string, time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.totals[k.consumer] == nil && len(m.totals) >= m.cfg.MaxConsumers {
+		k.consumer = Other
+		m.overflow.Inc()
+	}
+	q := m.quota(k.consumer)
+	p := m.periods(k.consumer, now)
+	switch {
+	case q.Daily > 0 && p.daily >= q.Daily:
+		return k, "daily", p.day.AddDate(0, 0, 1)
+	case q.Monthly > 0 && p.monthly >= q.Monthly:
+		return k, "monthly", p.month.AddDate(0, 1, 0)
+	}
+	p.daily++
+	p.monthly++
+	m.addLocked(k, Counts{Requests: 1})
+	return k, "", time.Time{}
+}
+
+func (m *Meter) add(k key, c Counts) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.addLocked(k, c)
+}
+
+func (m *Meter) addLocked(k key, c Counts) {
+	if m.db == nil {
+		merge(m.history, k, c)
+		return
+	}
+	merge(m.pending, k, c)
+}
+
+func merge(into map[key]*Counts, k key, c Counts) {
+	if cur := into[k]; cur != nil {
+		cur.Requests += c.Requests
+		cur.Bytes += c.Bytes
+		return
+	}
+	into[k] = &c
+}
+
+// periods returns the consumer's counts, starting a new day or month when
+// the current one has ended.
+func (m *Meter) periods(consumer string, now time.Time) *periods {
+	day, month := periodStart(now)
+	p := m.totals[consumer]
+	if p == nil {
+		p = &periods{day: day, month: month}
+		m.totals[consumer] = p
+	}
+	if !p.day.Equal(day) {
+		p.day, p.daily = day, 0
+	}
+	if !p.month.Equal(month) {
+		p.month, p.monthly = month, 0
+	}
+	return p
+}
+
+func periodStart(now time.Time) (day, month time.Time) {
+	now = now.UTC()
+	return now.Truncate(24 * time.Hour), time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (m *Meter) quota(consumer string) Quota {
+	if q, ok := m.quotas[consumer]; ok {
+		return q
+	}
+	return m.def
+}
+
+// consumer identifies the caller by USAGE_CONSUMER. Tokens are never
+// stored: unnamed ones are recorded by a hash prefix.
+func (m *Meter) consumer(r *http.Request) string {
+	token, hasToken := auth.BearerToken(r)
+	switch {
+	case m.cfg.Consumer == "token" && hasToken:
+		if name, ok := m.names[token]; ok {
+			return name
+		}
+		sum := sha256.Sum256([]byte(token))
+		return "token-" + hex.EncodeToString(sum[:6])
+	case strings.HasPrefix(m.cfg.Consumer, "header:"):
+		if v := strings.TrimSpace(r.Header.Get(strings.TrimPrefix(m.cfg.Consumer, "header:"))); v != "" {
+			return v
+		}
+	}
+	return Anonymous
+}
+
+// Run flushes usage every USAGE_FLUSH_INTERVAL until ctx ends.
+func (m *Meter) Run(ctx context.Context) {
+	if m.db == nil {
+		m.prune(ctx)
+		return
+	}
+	t := time.NewTicker(m.cfg.Flush)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := m.Flush(ctx); err != nil {
+				slog.Warn("usage not flushed", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// prune drops in-memory usage older than the previous month, which no
+// report needs, and the quota counts of consumers not seen this month.
+// With a database, each flush replaces the quota counts instead.
+func (m *Meter) prune(ctx context.Context) {
+	t := time.NewTicker(time.Hour)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			_, month := periodStart(time.Now())
+			cutoff := month.AddDate(0, -1, 0)
+			m.mu.Lock()
+			for k := range m.history {
+				if k.bucket.Before(cutoff) {
+					delete(m.history, k)
+				}
+			}
+			for consumer, p := range m.totals {
+				if p.month.Before(month) {
+					delete(m.totals, consumer)
+				}
+			}
+			m.mu.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
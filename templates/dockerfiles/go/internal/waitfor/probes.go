@@ -0,0 +1,190 @@
+package waitfor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Parse turns a WAIT_FOR target into a check:
+//
+//	tcp://host:port             the port accepts connections
+//	http(s)://host:port/path    GET answers 2xx or 3xx
+//	postgres://[user@]host/db   the server accepts sessions (like pg_isready)
+//	mysql://host:port           the server sends its handshake
+//
+// Database checks speak just enough of the wire protocol to tell a server
+// that is still starting from one that is ready, so no driver is needed and
+// no password is sent.
+func Parse(target string) (Check, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return Check{}, fmt.Errorf("waitfor: invalid target %q, want scheme://host:port", target)
+	}
+	name := u.Redacted()
+	switch u.Scheme {
+	case "tcp":
+		return Check{Name: name, Probe: func(ctx context.Context) error {
+			conn, err := dial(ctx, u.Host, "")
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}}, nil
+	case "http", "https":
+		return Check{Name: name, Probe: func(ctx context.Context) error { return probeHTTP(ctx, target) }}, nil
+	case "postgres", "postgresql":
+		return Check{Name: name, Probe: func(ctx context.Context) error { return probePostgres(ctx, u) }}, nil
+	case "mysql":
+		return Check{Name: name, Probe: func(ctx context.Context) error { return probeMySQL(ctx, u) }}, nil
+	}
+	return Check{}, fmt.Errorf("waitfor: unsupported scheme in %q (tcp, http, https, postgres, mysql)", name)
+}
+
+// SQL checks a pool the application opened with its own driver.
+func SQL(name string, db *sql.DB) Check {
+	return Check{Name: name, Probe: db.PingContext}
+}
+
+func dial(ctx context.Context, host, defaultPort string) (net.Conn, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil && defaultPort != "" {
+		host = net.JoinHostPort(host, defaultPort)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+func probeHTTP(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("answered %s", resp.Status)
+	}
+	return nil
+}
+
+// probePostgres sends a startup message and reads the first reply. An
+// authentication request, or any error other than "the database system is
+// starting up" (SQLSTATE 57P03), means the server accepts sessions.
+func probePostgres(ctx context.Context, u *url.URL) error {
+	conn, err := dial(ctx, u.Host, "5432")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	user := u.User.Username()
+	if user == "" {
+		user = "postgres"
+	}
+	db := strings.TrimPrefix(u.Path, "/")
+	if db == "" {
+		db = user
+	}
+	var params bytes.Buffer
+	binary.Write(&params, binary.BigEndian, int32(196608)) // protocol 3.0
+	for _, kv := range []string{"user", user, "database", db} {
+		params.WriteString(kv)
+		params.WriteByte(0)
+	}
+	params.WriteByte(0)
+	msg := binary.BigEndian.AppendUint32(nil, uint32(params.Len()+4))
+	if _, err := conn.Write(append(msg, params.Bytes()...)); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	kind, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("no reply to startup message: %w", err)
+	}
+	switch kind {
+	case 'R':
+		return nil
+	case 'E':
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil || n < 4 || n > 64<<10 {
+			return fmt.Errorf("malformed error reply")
+		}
+		body := make([]byte, n-4)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+		code, text := pgError(body)
+		if code == "57P03" {
+			return fmt.Errorf("%s", text)
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected reply %q to startup message", kind)
+}
+
+// pgError extracts the SQLSTATE and message fields of an ErrorResponse.
+func pgError(body []byte) (code, text string) {
+	for _, f := range bytes.Split(body, []byte{0}) {
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case 'C':
+			code = string(f[1:])
+		case 'M':
+			text = string(f[1:])
+		}
+	}
+	return code, text
+}
+
+// probeMySQL reads the greeting a MySQL or MariaDB server sends on connect:
+// protocol version 10 when it accepts clients, an error packet otherwise.
+func probeMySQL(ctx context.Context, u *url.URL) error {
+	conn, err := dial(ctx, u.Host, "3306")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return fmt.Errorf("no greeting: %w", err)
+	}
+	n := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, min(n, 1024))
+	if _, err := io.ReadFull(conn, payload); err != nil || len(payload) == 0 {
+		return fmt.Errorf("no greeting: %v", err)
+	}
+	switch payload[0] {
+	case 10:
+		return nil
+	case 0xff:
+		msg := payload[min(3, len(payload)):]
+		if len(msg) > 6 && msg[0] == '#' {
+			msg = msg[6:] // SQL state
+		}
+		return fmt.Errorf("server refused the connection: %s", msg)
+	}
+	return fmt.Errorf("unexpected greeting (protocol %d)", payload[0])
+}
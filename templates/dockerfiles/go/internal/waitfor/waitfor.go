@@ -0,0 +1,134 @@
+// Package waitfor holds startup until the service's dependencies accept
+// connections, replacing wait-for-it scripts. Compose's depends_on only
+// waits for a container to start, and crash-looping until the database is
+// up hides real failures in the noise.
+package waitfor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/app/internal/config"
+)
+
+// attemptTimeout bounds a single probe, so one hanging connect does not use
+// up the whole deadline.
+const attemptTimeout = 5 * time.Second
+
+// Check probes one dependency. Probe returns nil once it is ready.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// Waiter waits for a set of dependencies.
+type Waiter struct {
+	cfg    config.WaitConfig
+	checks []Check
+
+	mu      sync.Mutex
+	pending map[string]string // name -> last error, while not ready
+}
+
+// New parses the WAIT_FOR targets.
+func New(cfg config.WaitConfig) (*Waiter, error) {
+	w := &Waiter{cfg: cfg, pending: map[string]string{}}
+	for _, t := range cfg.Targets {
+		c, err := Parse(t)
+		if err != nil {
+			return nil, err
+		}
+		w.Add(c)
+	}
+	return w, nil
+}
+
+// Add registers a check in addition to the configured targets, e.g. SQL
+// for a pool the application has already opened.
+func (w *Waiter) Add(c Check) {
+	w.mu.Lock()
+	w.checks = append(w.checks, c)
+	w.pending[c.Name] = "not checked yet"
+	w.mu.Unlock()
+}
+
+// Wait probes every dependency concurrently, backing off exponentially
+// between attempts, until all are ready or WAIT_TIMEOUT passes.
+func (w *Waiter) Wait(ctx context.Context) error {
+	if len(w.checks) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+	slog.Info("waiting for dependencies", "dependencies", len(w.checks), "timeout", w.cfg.Timeout)
+
+	var wg sync.WaitGroup
+	for _, c := range w.checks {
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+			w.wait(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+
+	if err := w.ReadinessCheck(); err != nil {
+		return fmt.Errorf("waitfor: gave up after %s: %w", w.cfg.Timeout, err)
+	}
+	return nil
+}
+
+func (w *Waiter) wait(ctx context.Context, c Check) {
+	start := time.Now()
+	backoff := w.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		actx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err := c.Probe(actx)
+		cancel()
+		if err == nil {
+			w.mu.Lock()
+			delete(w.pending, c.Name)
+			w.mu.Unlock()
+			slog.Info("dependency ready", "dependency", c.Name, "attempts", attempt, "waited", time.Since(start).Round(time.Millisecond))
+			return
+		}
+		w.mu.Lock()
+		w.pending[c.Name] = err.Error()
+		w.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("dependency not ready", "dependency", c.Name, "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, w.cfg.MaxBackoff)
+	}
+}
+
+// ReadinessCheck fails while any dependency is not ready, naming them and
+// their last errors.
+func (w *Waiter) ReadinessCheck() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(w.pending))
+	for name := range w.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + ": " + w.pending[name]
+	}
+	return errors.New("waiting for " + strings.Join(names, "; "))
+}
@@ -0,0 +1,72 @@
+package yamldoc
+
+import "gopkg.in/yaml.v3"
+
+// Merge deep-merges src into dst:
+//
+//   - mappings are merged key by key
+//   - sequences whose items are all mappings with a "name" key (containers,
+//     env, ports, volumes) are merged item by item by name, new items are
+//     appended
+//   - a mapping value of null removes the key
+//   - anything else in src replaces the value in dst
+func Merge(dst, src *yaml.Node) {
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, val := src.Content[i], src.Content[i+1]
+			idx := indexOf(dst, key.Value)
+			switch {
+			case val.Tag == "!!null":
+				if idx >= 0 {
+					dst.Content = append(dst.Content[:idx], dst.Content[idx+2:]...)
+				}
+			case idx >= 0:
+				Merge(dst.Content[idx+1], val)
+			default:
+				dst.Content = append(dst.Content, key, val)
+			}
+		}
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && named(dst) && named(src):
+		for _, item := range src.Content {
+			name := lookup(item, "name").Value
+			if existing := findNamed(dst, name); existing != nil {
+				Merge(existing, item)
+			} else {
+				dst.Content = append(dst.Content, item)
+			}
+		}
+	default:
+		*dst = *src
+	}
+}
+
+func indexOf(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func named(seq *yaml.Node) bool {
+	for _, item := range seq.Content {
+		if item.Kind != yaml.MappingNode {
+			return false
+		}
+		if n := lookup(item, "name"); n == nil || n.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+func findNamed(seq *yaml.Node, name string) *yaml.Node {
+	for _, item := range seq.Content {
+		if lookup(item, "name").Value == name {
+			return item
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package yamldoc builds YAML documents with a stable key order and
+// comments, and merges user overlays into them. It backs the manifest and
+// compose generators.
+package yamldoc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Map builds a mapping node from alternating keys and values. Values may be
+// *yaml.Node, string, int, bool or nil (the pair is skipped).
+func Map(kv ...any) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] == nil {
+			continue
+		}
+		v := Value(kv[i+1])
+		if v == nil {
+			continue
+		}
+		n.Content = append(n.Content, Str(kv[i].(string)), v)
+	}
+	return n
+}
+
+// Seq builds a sequence node.
+func Seq(items ...any) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, it := range items {
+		if v := Value(it); v != nil {
+			n.Content = append(n.Content, v)
+		}
+	}
+	return n
+}
+
+// Str builds a string scalar; it is quoted on output when needed.
+func Str(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+// Value converts a Go value into a node.
+func Value(v any) *yaml.Node {
+	switch v := v.(type) {
+	case *yaml.Node:
+		return v
+	case string:
+		return Str(v)
+	case int:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(v)}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	case []string:
+		n := Seq()
+		for _, s := range v {
+			n.Content = append(n.Content, Str(s))
+		}
+		return n
+	case nil:
+		return nil
+	}
+	panic(fmt.Sprintf("yamldoc: unsupported value %T", v))
+}
+
+// Comment attaches a line comment to n and returns it.
+func Comment(n *yaml.Node, text string) *yaml.Node {
+	n.LineComment = text
+	return n
+}
+
+// Get follows a path of mapping keys and returns the node, or nil.
+func Get(n *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return nil
+		}
+		n = lookup(n, key)
+	}
+	return n
+}
+
+func lookup(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Encode writes docs as a multi-document YAML stream.
+func Encode(w io.Writer, docs ...*yaml.Node) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, d := range docs {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// ReadFile parses every document in a (multi-document) YAML file.
+func ReadFile(path string) ([]*yaml.Node, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var docs []*yaml.Node
+	dec := yaml.NewDecoder(f)
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(doc.Content) > 0 {
+			docs = append(docs, doc.Content[0])
+		}
+	}
+}